@@ -0,0 +1,93 @@
+package daemon
+
+import (
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Admin methods, for inspecting and maintaining the daemon.
+
+// clientRegistry keeps track of the connected clients.
+type clientRegistry struct {
+	mutex   sync.Mutex
+	nextID  int
+	clients map[int]ClientInfo
+}
+
+func newClientRegistry() *clientRegistry {
+	return &clientRegistry{clients: make(map[int]ClientInfo)}
+}
+
+func (r *clientRegistry) add() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.nextID++
+	r.clients[r.nextID] = ClientInfo{ID: r.nextID, Connected: time.Now().UnixNano()}
+	return r.nextID
+}
+
+func (r *clientRegistry) remove(id int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.clients, id)
+}
+
+// list returns the connected clients, ordered by ID.
+func (r *clientRegistry) list() []ClientInfo {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	clients := make([]ClientInfo, 0, len(r.clients))
+	for _, c := range r.clients {
+		clients = append(clients, c)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ID < clients[j].ID })
+	return clients
+}
+
+// Status returns the status of the daemon.
+func (s *Service) Status(req *StatusRequest, res *StatusResponse) error {
+	res.Version = Version
+	res.Pid = syscall.Getpid()
+	res.Started = s.started.UnixNano()
+	res.SockPath = s.sockPath
+	res.DbPath = s.dbPath
+	res.Clients = len(s.clients.list())
+	if s.err != nil {
+		res.StoreError = s.err.Error()
+	}
+	return nil
+}
+
+// Clients returns the connected clients.
+func (s *Service) Clients(req *ClientsRequest, res *ClientsResponse) error {
+	res.Clients = s.clients.list()
+	return nil
+}
+
+func (s *Service) DBStats(req *DBStatsRequest, res *DBStatsResponse) error {
+	if s.err != nil {
+		return s.err
+	}
+	stats, err := s.store.DBStats()
+	res.Stats = stats
+	return err
+}
+
+func (s *Service) Compact(req *CompactRequest, res *CompactResponse) error {
+	if s.err != nil {
+		return s.err
+	}
+	before, after, err := s.store.Compact()
+	res.Before, res.After = before, after
+	return err
+}
+
+// Shutdown makes the daemon quit after removing the socket and closing the
+// database.
+func (s *Service) Shutdown(req *ShutdownRequest, res *ShutdownResponse) error {
+	logger.Println("received shutdown request")
+	s.shutdownOnce.Do(func() { close(s.shutdown) })
+	return nil
+}
@@ -9,7 +9,7 @@ const (
 	ServiceName = "Daemon"
 
 	// Version is the API version. It should be bumped any time the API changes.
-	Version = -97
+	Version = -88
 )
 
 // Basic requests.
@@ -20,12 +20,30 @@ type VersionResponse struct {
 	Version int
 }
 
+// CapabilitiesRequest carries the API version of the client.
+type CapabilitiesRequest struct {
+	Version int
+}
+
+// CapabilitiesResponse carries the API version of the daemon and the names of
+// the RPC methods it supports.
+type CapabilitiesResponse struct {
+	Version int
+	Methods []string
+}
+
 type PidRequest struct{}
 
 type PidResponse struct {
 	Pid int
 }
 
+type SchemaUpgradeRequest struct{}
+
+type SchemaUpgradeResponse struct {
+	Upgrade *storedefs.SchemaUpgrade
+}
+
 // Cmd requests.
 
 type NextCmdSeqRequest struct{}
@@ -42,6 +60,51 @@ type AddCmdResponse struct {
 	Seq int
 }
 
+type AddCmdWithMetaRequest struct {
+	Text string
+	Meta storedefs.CmdMeta
+}
+
+type AddCmdWithMetaResponse struct {
+	Seq int
+}
+
+type AddCmdsRequest struct {
+	Cmds []storedefs.Cmd
+}
+
+type AddCmdsResponse struct{}
+
+type FinishCmdRequest struct {
+	Seq       int
+	Duration  float64
+	Exception string
+}
+
+type FinishCmdResponse struct{}
+
+type RemoveCmdRequest struct {
+	Seq int
+}
+
+type RemoveCmdResponse struct{}
+
+type RemoveCmdsMatchingRequest struct {
+	Pattern string
+}
+
+type RemoveCmdsMatchingResponse struct {
+	Seqs []int
+}
+
+type SearchCmdsRequest struct {
+	Query storedefs.CmdQuery
+}
+
+type SearchCmdsResponse struct {
+	Cmds []storedefs.Cmd
+}
+
 type CmdRequest struct {
 	Seq int
 }
@@ -59,6 +122,15 @@ type CmdsResponse struct {
 	Cmds []string
 }
 
+type CmdsWithMetaRequest struct {
+	From int
+	Upto int
+}
+
+type CmdsWithMetaResponse struct {
+	Cmds []storedefs.Cmd
+}
+
 type NextCmdRequest struct {
 	From   int
 	Prefix string
@@ -88,6 +160,12 @@ type AddDirRequest struct {
 
 type AddDirResponse struct{}
 
+type RemoveDirRequest struct {
+	Dir string
+}
+
+type RemoveDirResponse struct{}
+
 type DirsRequest struct {
 	Blacklist map[string]struct{}
 }
@@ -118,3 +196,86 @@ type DelSharedVarRequest struct {
 }
 
 type DelSharedVarResponse struct{}
+
+type CompareAndSwapSharedVarRequest struct {
+	Name string
+	Old  string
+	New  string
+}
+
+type CompareAndSwapSharedVarResponse struct {
+	Swapped bool
+}
+
+type IncSharedVarRequest struct {
+	Name  string
+	Delta float64
+}
+
+type IncSharedVarResponse struct {
+	Value string
+}
+
+// WatchSharedVarsRequest asks for changes to the shared variable Name, or to
+// shared variables whose names start with Name if Prefix is true, with
+// sequence numbers greater than After. If After is negative, the current
+// sequence number is returned without waiting.
+type WatchSharedVarsRequest struct {
+	Name   string
+	Prefix bool
+	After  int
+}
+
+type WatchSharedVarsResponse struct {
+	Changes []SharedVarChange
+	Seq     int
+}
+
+// Admin requests.
+
+type StatusRequest struct{}
+
+type StatusResponse struct {
+	Version int
+	Pid     int
+	// Time the daemon started, in nanoseconds since the Unix epoch.
+	Started  int64
+	SockPath string
+	DbPath   string
+	// Number of connected clients.
+	Clients int
+	// The error opening the database, if any.
+	StoreError string
+}
+
+type ClientsRequest struct{}
+
+type ClientsResponse struct {
+	Clients []ClientInfo
+}
+
+// ClientInfo describes a connection to the daemon.
+type ClientInfo struct {
+	ID int
+	// Time of connection, in nanoseconds since the Unix epoch.
+	Connected int64
+}
+
+type DBStatsRequest struct{}
+
+type DBStatsResponse struct {
+	Stats storedefs.DBStats
+}
+
+type CompactRequest struct{}
+
+// CompactResponse carries the sizes of the database file before and after
+// compaction.
+type CompactResponse struct {
+	Before int64
+	After  int64
+}
+
+type ShutdownRequest struct{}
+
+type ShutdownResponse struct{}
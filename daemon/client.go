@@ -2,13 +2,26 @@ package daemon
 
 import (
 	"errors"
+	"net"
 	"net/rpc"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/elves/elvish/store/storedefs"
 )
 
-const retriesOnShutdown = 3
+var (
+	// Number of attempts to reconnect to the daemon in one call.
+	reconnectAttempts = 8
+	// Time to wait before the first reconnection attempt. It is doubled after
+	// each attempt, up to maxReconnectWait.
+	reconnectWait    = 10 * time.Millisecond
+	maxReconnectWait = 500 * time.Millisecond
+	// How long calls fail fast after a failed reconnection. Reconnection is
+	// retried in the background in the meanwhile.
+	reconnectCooldown = 5 * time.Second
+)
 
 var (
 	// ErrClientNotInitialized is returned when the Client is not initialized.
@@ -16,13 +29,42 @@ var (
 	// ErrDaemonUnreachable is returned when the daemon cannot be reached after
 	// several retries.
 	ErrDaemonUnreachable = errors.New("daemon offline")
+	// ErrUnsupported is returned when calling a method that the daemon does
+	// not support.
+	ErrUnsupported = errors.New("method not supported by daemon")
+
+	errClientClosed = errors.New("client closed")
 )
 
 // Client is a client to the Elvish daemon. A nil *Client is safe to use.
+//
+// The Client connects to the daemon lazily, and reconnects with backoff when
+// the connection is lost, e.g. when the daemon is restarted. If a spawner is
+// set with SetSpawner, it is used to start a new daemon when none is running.
+// When reconnecting fails, calls fail with ErrDaemonUnreachable right away for
+// a while, during which reconnection is retried in the background.
+//
+// Upon connecting, the Client asks the daemon about its capabilities, so that
+// calls to methods unknown to the daemon fail early with ErrUnsupported.
 type Client struct {
-	sockPath  string
+	sockPath string
+	waits    sync.WaitGroup
+
+	// Protects the fields below.
+	mutex     sync.Mutex
 	rpcClient *rpc.Client
-	waits     sync.WaitGroup
+	spawn     func() error
+	// Version and methods of the daemon, learned when connecting. If methods
+	// is nil, the daemon does not report its methods and all calls are
+	// attempted.
+	daemonVersion int
+	methods       map[string]bool
+	closed        bool
+	// Closed when the running connection attempt finishes, or nil if there is
+	// none. Connection attempts are made without holding the mutex.
+	connecting chan struct{}
+	// Calls fail fast until this time after a failed reconnection.
+	failUntil time.Time
 }
 
 var _ storedefs.Store = (*Client)(nil)
@@ -30,7 +72,7 @@ var _ storedefs.Store = (*Client)(nil)
 // NewClient creates a new Client instance that talks to the socket. Connection
 // creation is deferred to the first request.
 func NewClient(sockPath string) *Client {
-	return &Client{sockPath, nil, sync.WaitGroup{}}
+	return &Client{sockPath: sockPath}
 }
 
 // SockPath returns the socket path that the Client talks to. If the client is
@@ -42,14 +84,35 @@ func (c *Client) SockPath() string {
 	return c.sockPath
 }
 
+// SetSpawner sets the function used for spawning a new daemon when the daemon
+// cannot be reached. If the client is nil, it does nothing.
+func (c *Client) SetSpawner(spawn func() error) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.spawn = spawn
+}
+
 // ResetConn resets the current connection. A new connection will be established
 // the next time a request is made. If the client is nil, it does nothing.
 func (c *Client) ResetConn() error {
-	if c == nil || c.rpcClient == nil {
+	if c == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.resetConn()
+}
+
+func (c *Client) resetConn() error {
+	if c.rpcClient == nil {
 		return nil
 	}
 	rc := c.rpcClient
 	c.rpcClient = nil
+	c.daemonVersion, c.methods = 0, nil
 	return rc.Close()
 }
 
@@ -59,34 +122,264 @@ func (c *Client) Close() error {
 	if c == nil {
 		return nil
 	}
+	c.mutex.Lock()
+	c.closed = true
+	c.mutex.Unlock()
 	c.waits.Wait()
 	return c.ResetConn()
 }
 
+// Supports returns whether the daemon supports the RPC method, connecting to
+// the daemon if needed. It returns true if the daemon does not report the
+// methods it supports.
+func (c *Client) Supports(method string) bool {
+	if c == nil {
+		return false
+	}
+	if _, err := c.conn(); err != nil {
+		return false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.methods == nil || c.methods[method]
+}
+
+// DaemonVersion returns the API version of the daemon, connecting to the
+// daemon if needed.
+func (c *Client) DaemonVersion() (int, error) {
+	if c == nil {
+		return 0, ErrClientNotInitialized
+	}
+	if _, err := c.conn(); err != nil {
+		return 0, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.daemonVersion, nil
+}
+
+// Compatible returns whether the daemon can serve this client, connecting to
+// the daemon if needed. A daemon is compatible if its API version is not older
+// than that of the client, or if it supports all the methods the client knows
+// about.
+func (c *Client) Compatible() bool {
+	if c == nil {
+		return false
+	}
+	if _, err := c.conn(); err != nil {
+		return false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.daemonVersion >= Version {
+		return true
+	}
+	if c.methods == nil {
+		return false
+	}
+	for _, method := range serviceMethods() {
+		if !c.methods[method] {
+			return false
+		}
+	}
+	return true
+}
+
+// conn returns the current connection, establishing one if needed. When the
+// daemon cannot be reached, it spawns a new daemon if a spawner is set, and
+// retries with backoff. If that fails too, it keeps retrying in the background
+// for reconnectCooldown, and calls made in the meanwhile fail right away.
+func (c *Client) conn() (*rpc.Client, error) {
+	c.mutex.Lock()
+	for {
+		if c.rpcClient != nil {
+			rpcClient := c.rpcClient
+			c.mutex.Unlock()
+			return rpcClient, nil
+		}
+		if c.closed {
+			c.mutex.Unlock()
+			return nil, errClientClosed
+		}
+		if time.Now().Before(c.failUntil) {
+			c.mutex.Unlock()
+			return nil, ErrDaemonUnreachable
+		}
+		if c.connecting == nil {
+			break
+		}
+		// Wait for the connection attempt made by another call.
+		connecting := c.connecting
+		c.mutex.Unlock()
+		<-connecting
+		c.mutex.Lock()
+	}
+	connecting := make(chan struct{})
+	c.connecting = connecting
+	spawn := c.spawn
+	c.mutex.Unlock()
+
+	conn, err := dial(c.sockPath)
+	if err != nil {
+		logger.Printf("cannot connect to daemon: %v", err)
+		if spawn != nil {
+			c.spawnDaemon(spawn, err)
+		}
+		wait := reconnectWait
+		for i := 0; i < reconnectAttempts && err != nil; i++ {
+			time.Sleep(wait)
+			wait = nextWait(wait)
+			conn, err = dial(c.sockPath)
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.connecting = nil
+	close(connecting)
+	if err != nil {
+		c.failUntil = time.Now().Add(reconnectCooldown)
+		go c.reconnect(c.failUntil)
+		return nil, err
+	}
+	if !c.setConn(conn) {
+		return nil, errClientClosed
+	}
+	return c.rpcClient, nil
+}
+
+// reconnect retries connecting to the daemon with backoff until it succeeds,
+// the deadline passes or the Client is closed.
+func (c *Client) reconnect(deadline time.Time) {
+	wait := reconnectWait
+	for time.Now().Add(wait).Before(deadline) {
+		time.Sleep(wait)
+		wait = nextWait(wait)
+		c.mutex.Lock()
+		closed := c.closed
+		c.mutex.Unlock()
+		if closed {
+			return
+		}
+		conn, err := dial(c.sockPath)
+		if err != nil {
+			continue
+		}
+		logger.Println("reconnected to daemon")
+		c.mutex.Lock()
+		if c.setConn(conn) {
+			c.failUntil = time.Time{}
+		}
+		c.mutex.Unlock()
+		return
+	}
+}
+
+// setConn makes conn the current connection and negotiates with the daemon,
+// unless the Client is closed or already connected, in which case conn is
+// closed. It returns whether conn is used. It must be called with the mutex
+// locked.
+func (c *Client) setConn(conn net.Conn) bool {
+	if c.closed || c.rpcClient != nil {
+		conn.Close()
+		return !c.closed
+	}
+	c.rpcClient = rpc.NewClient(conn)
+	c.negotiate()
+	return true
+}
+
+// spawnDaemon spawns a new daemon with spawn if the error from dialing shows
+// that no daemon is listening on the socket. A socket file left behind by a
+// daemon that died is removed first, since the new daemon cannot listen on it
+// otherwise.
+func (c *Client) spawnDaemon(spawn func() error, dialErr error) {
+	missing, stale := classifyDialError(dialErr)
+	if stale {
+		logger.Println("removing stale socket file", c.sockPath)
+		err := os.Remove(c.sockPath)
+		if err != nil && !os.IsNotExist(err) {
+			logger.Println("failed to remove socket file:", err)
+			return
+		}
+	} else if !missing {
+		return
+	}
+	logger.Println("spawning a new daemon")
+	if err := spawn(); err != nil {
+		logger.Println("failed to spawn daemon:", err)
+	}
+}
+
+// negotiate learns the version and methods of the daemon. Daemons that predate
+// the Capabilities method are asked for their version only, and are assumed to
+// support all methods.
+func (c *Client) negotiate() {
+	req := &CapabilitiesRequest{Version}
+	res := &CapabilitiesResponse{}
+	err := c.rpcClient.Call(ServiceName+".Capabilities", req, res)
+	if err != nil {
+		logger.Println("failed to get capabilities of daemon:", err)
+		versionRes := &VersionResponse{}
+		err = c.rpcClient.Call(ServiceName+".Version", &VersionRequest{}, versionRes)
+		if err != nil {
+			logger.Println("failed to get version of daemon:", err)
+			return
+		}
+		c.daemonVersion = versionRes.Version
+		return
+	}
+	c.daemonVersion = res.Version
+	c.methods = make(map[string]bool, len(res.Methods))
+	for _, method := range res.Methods {
+		c.methods[method] = true
+	}
+}
+
+func nextWait(wait time.Duration) time.Duration {
+	wait *= 2
+	if wait > maxReconnectWait {
+		wait = maxReconnectWait
+	}
+	return wait
+}
+
 func (c *Client) call(f string, req, res interface{}) error {
 	if c == nil {
 		return ErrClientNotInitialized
 	}
 	c.waits.Add(1)
 	defer c.waits.Done()
+	return c.invoke(f, req, res)
+}
 
-	for attempt := 0; attempt < retriesOnShutdown; attempt++ {
-		if c.rpcClient == nil {
-			conn, err := dial(c.sockPath)
-			if err != nil {
-				return err
-			}
-			c.rpcClient = rpc.NewClient(conn)
+// invoke calls an RPC method, reconnecting when the connection is shut down.
+func (c *Client) invoke(f string, req, res interface{}) error {
+	wait := reconnectWait
+	for attempt := 0; attempt < reconnectAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(wait)
+			wait = nextWait(wait)
+		}
+		rpcClient, err := c.conn()
+		if err != nil {
+			return err
+		}
+		if !c.Supports(f) {
+			return ErrUnsupported
 		}
 
-		err := c.rpcClient.Call(ServiceName+"."+f, req, res)
+		err = rpcClient.Call(ServiceName+"."+f, req, res)
 		if err == rpc.ErrShutdown {
 			// Clear rpcClient so as to reconnect next time
-			c.rpcClient = nil
+			c.mutex.Lock()
+			if c.rpcClient == rpcClient {
+				c.resetConn()
+			}
+			c.mutex.Unlock()
 			continue
-		} else {
-			return err
 		}
+		return err
 	}
 	return ErrDaemonUnreachable
 }
@@ -102,6 +395,13 @@ func (c *Client) Version() (int, error) {
 	return res.Version, err
 }
 
+func (c *Client) Capabilities() (*CapabilitiesResponse, error) {
+	req := &CapabilitiesRequest{Version}
+	res := &CapabilitiesResponse{}
+	err := c.call("Capabilities", req, res)
+	return res, err
+}
+
 func (c *Client) Pid() (int, error) {
 	req := &PidRequest{}
 	res := &PidResponse{}
@@ -109,6 +409,13 @@ func (c *Client) Pid() (int, error) {
 	return res.Pid, err
 }
 
+func (c *Client) SchemaUpgrade() (*storedefs.SchemaUpgrade, error) {
+	req := &SchemaUpgradeRequest{}
+	res := &SchemaUpgradeResponse{}
+	err := c.call("SchemaUpgrade", req, res)
+	return res.Upgrade, err
+}
+
 func (c *Client) NextCmdSeq() (int, error) {
 	req := &NextCmdRequest{}
 	res := &NextCmdSeqResponse{}
@@ -123,6 +430,45 @@ func (c *Client) AddCmd(text string) (int, error) {
 	return res.Seq, err
 }
 
+func (c *Client) AddCmdWithMeta(text string, meta storedefs.CmdMeta) (int, error) {
+	req := &AddCmdWithMetaRequest{text, meta}
+	res := &AddCmdWithMetaResponse{}
+	err := c.call("AddCmdWithMeta", req, res)
+	return res.Seq, err
+}
+
+func (c *Client) AddCmds(cmds []storedefs.Cmd) error {
+	req := &AddCmdsRequest{cmds}
+	res := &AddCmdsResponse{}
+	return c.call("AddCmds", req, res)
+}
+
+func (c *Client) FinishCmd(seq int, duration float64, exception string) error {
+	req := &FinishCmdRequest{seq, duration, exception}
+	res := &FinishCmdResponse{}
+	return c.call("FinishCmd", req, res)
+}
+
+func (c *Client) RemoveCmd(seq int) error {
+	req := &RemoveCmdRequest{seq}
+	res := &RemoveCmdResponse{}
+	return c.call("RemoveCmd", req, res)
+}
+
+func (c *Client) RemoveCmdsMatching(pattern string) ([]int, error) {
+	req := &RemoveCmdsMatchingRequest{pattern}
+	res := &RemoveCmdsMatchingResponse{}
+	err := c.call("RemoveCmdsMatching", req, res)
+	return res.Seqs, err
+}
+
+func (c *Client) SearchCmds(q storedefs.CmdQuery) ([]storedefs.Cmd, error) {
+	req := &SearchCmdsRequest{q}
+	res := &SearchCmdsResponse{}
+	err := c.call("SearchCmds", req, res)
+	return res.Cmds, err
+}
+
 func (c *Client) Cmd(seq int) (string, error) {
 	req := &CmdRequest{seq}
 	res := &CmdResponse{}
@@ -137,6 +483,13 @@ func (c *Client) Cmds(from, upto int) ([]string, error) {
 	return res.Cmds, err
 }
 
+func (c *Client) CmdsWithMeta(from, upto int) ([]storedefs.Cmd, error) {
+	req := &CmdsWithMetaRequest{from, upto}
+	res := &CmdsWithMetaResponse{}
+	err := c.call("CmdsWithMeta", req, res)
+	return res.Cmds, err
+}
+
 func (c *Client) NextCmd(from int, prefix string) (int, string, error) {
 	req := &NextCmdRequest{from, prefix}
 	res := &NextCmdResponse{}
@@ -158,6 +511,13 @@ func (c *Client) AddDir(dir string, incFactor float64) error {
 	return err
 }
 
+func (c *Client) RemoveDir(dir string) error {
+	req := &RemoveDirRequest{dir}
+	res := &RemoveDirResponse{}
+	err := c.call("RemoveDir", req, res)
+	return err
+}
+
 func (c *Client) Dirs(blacklist map[string]struct{}) ([]storedefs.Dir, error) {
 	req := &DirsRequest{blacklist}
 	res := &DirsResponse{}
@@ -179,7 +539,69 @@ func (c *Client) SetSharedVar(name, value string) error {
 }
 
 func (c *Client) DelSharedVar(name string) error {
-	req := &DelSharedVarRequest{}
+	req := &DelSharedVarRequest{name}
 	res := &DelSharedVarResponse{}
 	return c.call("DelSharedVar", req, res)
 }
+
+func (c *Client) CompareAndSwapSharedVar(name, old, new string) (bool, error) {
+	req := &CompareAndSwapSharedVarRequest{name, old, new}
+	res := &CompareAndSwapSharedVarResponse{}
+	err := c.call("CompareAndSwapSharedVar", req, res)
+	return res.Swapped, err
+}
+
+func (c *Client) IncSharedVar(name string, delta float64) (string, error) {
+	req := &IncSharedVarRequest{name, delta}
+	res := &IncSharedVarResponse{}
+	err := c.call("IncSharedVar", req, res)
+	return res.Value, err
+}
+
+func (c *Client) Status() (*StatusResponse, error) {
+	req := &StatusRequest{}
+	res := &StatusResponse{}
+	err := c.call("Status", req, res)
+	return res, err
+}
+
+func (c *Client) Clients() ([]ClientInfo, error) {
+	req := &ClientsRequest{}
+	res := &ClientsResponse{}
+	err := c.call("Clients", req, res)
+	return res.Clients, err
+}
+
+func (c *Client) DBStats() (storedefs.DBStats, error) {
+	req := &DBStatsRequest{}
+	res := &DBStatsResponse{}
+	err := c.call("DBStats", req, res)
+	return res.Stats, err
+}
+
+func (c *Client) Compact() (int64, int64, error) {
+	req := &CompactRequest{}
+	res := &CompactResponse{}
+	err := c.call("Compact", req, res)
+	return res.Before, res.After, err
+}
+
+// Shutdown asks the daemon to quit. Unlike other calls, it does not reconnect
+// or respawn the daemon when the connection is shut down.
+func (c *Client) Shutdown() error {
+	if c == nil {
+		return ErrClientNotInitialized
+	}
+	c.waits.Add(1)
+	defer c.waits.Done()
+	rpcClient, err := c.conn()
+	if err != nil {
+		return err
+	}
+	err = rpcClient.Call(ServiceName+".Shutdown", &ShutdownRequest{}, &ShutdownResponse{})
+	if err == rpc.ErrShutdown {
+		// The daemon quit before responding.
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,92 @@
+package daemon
+
+import (
+	"net"
+	"net/rpc"
+	"testing"
+	"time"
+
+	"github.com/elves/elvish/util"
+)
+
+// oldService mimics a daemon that predates the Capabilities method.
+type oldService struct{}
+
+func (oldService) Version(req *VersionRequest, res *VersionResponse) error {
+	res.Version = Version - 1
+	return nil
+}
+
+// serveFake serves service on the socket at path with its own RPC server, and
+// returns the listener.
+func serveFake(t *testing.T, path string, service interface{}) net.Listener {
+	server := rpc.NewServer()
+	err := server.RegisterName(ServiceName, service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Accept(listener)
+	return listener
+}
+
+func TestClientWithOldDaemon(t *testing.T) {
+	util.InTempDir(func(string) {
+		listener := serveFake(t, "sock", oldService{})
+		defer listener.Close()
+		client := NewClient("sock")
+		defer client.Close()
+
+		if version, err := client.DaemonVersion(); version != Version-1 || err != nil {
+			t.Errorf("client.DaemonVersion() -> (%v, %v), want (%v, nil)",
+				version, err, Version-1)
+		}
+		if client.Compatible() {
+			t.Errorf("client.Compatible() -> true for old daemon, want false")
+		}
+		if !client.Supports("Pid") {
+			t.Errorf("client.Supports() -> false for daemon not reporting methods")
+		}
+	})
+}
+
+func TestClientFailsFastAndReconnectsInBackground(t *testing.T) {
+	defer func(attempts int, cooldown time.Duration) {
+		reconnectAttempts, reconnectCooldown = attempts, cooldown
+	}(reconnectAttempts, reconnectCooldown)
+	reconnectAttempts, reconnectCooldown = 1, 10*time.Second
+
+	util.InTempDir(func(string) {
+		client := NewClient("sock")
+		defer client.Close()
+
+		if _, err := client.Version(); err == nil || err == ErrDaemonUnreachable {
+			t.Errorf("client.Version() -> error %v, want error from dialing", err)
+		}
+		// Calls fail fast after a failed reconnection.
+		if _, err := client.Version(); err != ErrDaemonUnreachable {
+			t.Errorf("client.Version() -> error %v, want ErrDaemonUnreachable", err)
+		}
+
+		// The daemon is reconnected to in the background once it is up.
+		listener := serveFake(t, "sock", oldService{})
+		defer listener.Close()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			version, err := client.Version()
+			if err == nil {
+				if version != Version-1 {
+					t.Errorf("client.Version() -> %v, want %v", version, Version-1)
+				}
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("not reconnected in the background, last error %v", err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
@@ -10,26 +10,58 @@ import (
 func TestDaemon(t *testing.T) {
 	util.InTempDir(func(string) {
 		serverDone := make(chan struct{})
-		go func() {
-			Serve("sock", "db")
-			close(serverDone)
-		}()
-
 		client := NewClient("sock")
-		for i := 0; i < 10; i++ {
-			client.ResetConn()
-			_, err := client.Version()
-			if err == nil {
-				break
-			} else if i == 9 {
-				t.Fatal("Failed to connect after 100ms")
-			}
-			time.Sleep(10 * time.Millisecond)
-		}
+		// The daemon is spawned by the first request.
+		client.SetSpawner(func() error {
+			go func() {
+				Serve("sock", "db")
+				close(serverDone)
+			}()
+			return nil
+		})
 		_, err := client.AddCmd("test cmd")
 		if err != nil {
 			t.Errorf("client.AddCmd -> error %v", err)
 		}
+
+		if !client.Compatible() {
+			t.Errorf("client.Compatible() -> false, want true")
+		}
+		if !client.Supports("AddCmd") || client.Supports("NoSuchMethod") {
+			t.Errorf("client.Supports reports wrong methods")
+		}
+		changes := make(chan SharedVarChange, 1)
+		stop := client.WatchSharedVars("x", false, func(c SharedVarChange) {
+			changes <- c
+		})
+		// Wait until the watch is set up; only later changes are reported.
+		time.Sleep(50 * time.Millisecond)
+		client.SetSharedVar("x", "foo")
+		select {
+		case c := <-changes:
+			if c.Name != "x" || c.Value != "foo" {
+				t.Errorf("watched change %v, want x = foo", c)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("change to watched variable not reported")
+		}
+		stop()
+
+		var res struct{}
+		if err := client.call("NoSuchMethod", &res, &res); err != ErrUnsupported {
+			t.Errorf("calling unsupported method -> error %v, want %v", err, ErrUnsupported)
+		}
+
+		status, err := client.Status()
+		if err != nil || status.Version != Version || status.Clients != 1 {
+			t.Errorf("client.Status() -> (%v, %v)", status, err)
+		}
+		if clients, err := client.Clients(); len(clients) != 1 || err != nil {
+			t.Errorf("client.Clients() -> (%v, %v), want one client", clients, err)
+		}
+		if err := client.Shutdown(); err != nil {
+			t.Errorf("client.Shutdown() -> error %v", err)
+		}
 		client.Close()
 		// Wait for server to quit before returning
 		<-serverDone
@@ -4,16 +4,19 @@ import (
 	"net/rpc"
 	"os"
 	"os/signal"
+	"reflect"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/elves/elvish/store"
 	"github.com/elves/elvish/store/storedefs"
 )
 
 // Serve runs the daemon service, listening on the socket specified by sockpath
-// and serving data from dbpath. It quits upon receiving SIGTERM, SIGINT or when
-// all active clients have disconnected.
+// and serving data from dbpath, which may select a storage backend with a URL
+// scheme as accepted by store.Open. It quits upon receiving SIGTERM, SIGINT, a
+// Shutdown request, or when all active clients have disconnected.
 func Serve(sockpath, dbpath string) {
 	logger.Println("pid is", syscall.Getpid())
 	logger.Println("going to listen", sockpath)
@@ -24,12 +27,19 @@ func Serve(sockpath, dbpath string) {
 		os.Exit(2)
 	}
 
-	st, err := store.NewStore(dbpath)
+	st, err := store.Open(dbpath)
 	if err != nil {
 		logger.Printf("failed to create storage: %v", err)
 		logger.Printf("serving anyway")
 	}
 
+	service := &Service{store: st, err: err, hub: newSharedVarHub(),
+		started: time.Now(), sockPath: sockpath, dbPath: dbpath,
+		clients: newClientRegistry(), shutdown: make(chan struct{})}
+	if err == nil {
+		service.upgrade = st.SchemaUpgrade()
+	}
+
 	quitSignals := make(chan os.Signal)
 	quitChan := make(chan struct{})
 	signal.Notify(quitSignals, syscall.SIGTERM, syscall.SIGINT)
@@ -39,14 +49,18 @@ func Serve(sockpath, dbpath string) {
 			logger.Printf("received signal %s", sig)
 		case <-quitChan:
 			logger.Printf("No active client, daemon exit")
+		case <-service.shutdown:
+			logger.Printf("shutdown requested")
 		}
 		err := os.Remove(sockpath)
 		if err != nil {
 			logger.Printf("failed to remove socket %s: %v", sockpath, err)
 		}
-		err = st.Close()
-		if err != nil {
-			logger.Printf("failed to close storage: %v", err)
+		if st != nil {
+			err = st.Close()
+			if err != nil {
+				logger.Printf("failed to close storage: %v", err)
+			}
 		}
 		err = listener.Close()
 		if err != nil {
@@ -55,7 +69,6 @@ func Serve(sockpath, dbpath string) {
 		logger.Println("listener closed, waiting to exit")
 	}()
 
-	service := &Service{st, err}
 	rpc.RegisterName(ServiceName, service)
 
 	logger.Println("starting to serve RPC calls")
@@ -82,7 +95,9 @@ func Serve(sockpath, dbpath string) {
 			activeClient.Add(1)
 		}
 		go func() {
+			id := service.clients.add()
 			rpc.DefaultServer.ServeConn(conn)
+			service.clients.remove(id)
 			activeClient.Done()
 		}()
 	}
@@ -95,6 +110,22 @@ func Serve(sockpath, dbpath string) {
 type Service struct {
 	store storedefs.Store
 	err   error
+
+	// The schema upgrade done when opening the database. It is reported to
+	// the first client that asks for it.
+	upgrade      *storedefs.SchemaUpgrade
+	upgradeMutex sync.Mutex
+
+	// Recent changes to shared variables, for watchers.
+	hub *sharedVarHub
+
+	// Information reported by admin methods.
+	started          time.Time
+	sockPath, dbPath string
+	clients          *clientRegistry
+	// Closed to request the daemon to quit.
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
 }
 
 // Implementations of RPC methods.
@@ -108,12 +139,48 @@ func (s *Service) Version(req *VersionRequest, res *VersionResponse) error {
 	return nil
 }
 
+// Capabilities returns the API version and the supported methods.
+func (s *Service) Capabilities(req *CapabilitiesRequest, res *CapabilitiesResponse) error {
+	if req.Version != Version {
+		logger.Printf("client has API version %d, daemon has %d", req.Version, Version)
+	}
+	res.Version = Version
+	res.Methods = serviceMethods()
+	return nil
+}
+
+// serviceMethods returns the names of all RPC methods of Service.
+func serviceMethods() []string {
+	var names []string
+	t := reflect.TypeOf((*Service)(nil))
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	for i := 0; i < t.NumMethod(); i++ {
+		m := t.Method(i)
+		// Methods suitable for net/rpc have a receiver, a request and a
+		// response, and return an error.
+		if m.Type.NumIn() == 3 && m.Type.NumOut() == 1 && m.Type.Out(0) == errorType {
+			names = append(names, m.Name)
+		}
+	}
+	return names
+}
+
 // Pid returns the process ID of the daemon.
 func (s *Service) Pid(req *PidRequest, res *PidResponse) error {
 	res.Pid = syscall.Getpid()
 	return nil
 }
 
+// SchemaUpgrade returns the schema upgrade done when the daemon opened the
+// database, if it has not been returned before.
+func (s *Service) SchemaUpgrade(req *SchemaUpgradeRequest, res *SchemaUpgradeResponse) error {
+	s.upgradeMutex.Lock()
+	defer s.upgradeMutex.Unlock()
+	res.Upgrade = s.upgrade
+	s.upgrade = nil
+	return nil
+}
+
 func (s *Service) NextCmdSeq(req *NextCmdSeqRequest, res *NextCmdSeqResponse) error {
 	if s.err != nil {
 		return s.err
@@ -132,6 +199,54 @@ func (s *Service) AddCmd(req *AddCmdRequest, res *AddCmdResponse) error {
 	return err
 }
 
+func (s *Service) AddCmdWithMeta(req *AddCmdWithMetaRequest, res *AddCmdWithMetaResponse) error {
+	if s.err != nil {
+		return s.err
+	}
+	seq, err := s.store.AddCmdWithMeta(req.Text, req.Meta)
+	res.Seq = seq
+	return err
+}
+
+func (s *Service) AddCmds(req *AddCmdsRequest, res *AddCmdsResponse) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.store.AddCmds(req.Cmds)
+}
+
+func (s *Service) FinishCmd(req *FinishCmdRequest, res *FinishCmdResponse) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.store.FinishCmd(req.Seq, req.Duration, req.Exception)
+}
+
+func (s *Service) RemoveCmd(req *RemoveCmdRequest, res *RemoveCmdResponse) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.store.RemoveCmd(req.Seq)
+}
+
+func (s *Service) RemoveCmdsMatching(req *RemoveCmdsMatchingRequest, res *RemoveCmdsMatchingResponse) error {
+	if s.err != nil {
+		return s.err
+	}
+	seqs, err := s.store.RemoveCmdsMatching(req.Pattern)
+	res.Seqs = seqs
+	return err
+}
+
+func (s *Service) SearchCmds(req *SearchCmdsRequest, res *SearchCmdsResponse) error {
+	if s.err != nil {
+		return s.err
+	}
+	cmds, err := s.store.SearchCmds(req.Query)
+	res.Cmds = cmds
+	return err
+}
+
 func (s *Service) Cmd(req *CmdRequest, res *CmdResponse) error {
 	if s.err != nil {
 		return s.err
@@ -150,6 +265,15 @@ func (s *Service) Cmds(req *CmdsRequest, res *CmdsResponse) error {
 	return err
 }
 
+func (s *Service) CmdsWithMeta(req *CmdsWithMetaRequest, res *CmdsWithMetaResponse) error {
+	if s.err != nil {
+		return s.err
+	}
+	cmds, err := s.store.CmdsWithMeta(req.From, req.Upto)
+	res.Cmds = cmds
+	return err
+}
+
 func (s *Service) NextCmd(req *NextCmdRequest, res *NextCmdResponse) error {
 	if s.err != nil {
 		return s.err
@@ -175,6 +299,13 @@ func (s *Service) AddDir(req *AddDirRequest, res *AddDirResponse) error {
 	return s.store.AddDir(req.Dir, req.IncFactor)
 }
 
+func (s *Service) RemoveDir(req *RemoveDirRequest, res *RemoveDirResponse) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.store.RemoveDir(req.Dir)
+}
+
 func (s *Service) Dirs(req *DirsRequest, res *DirsResponse) error {
 	if s.err != nil {
 		return s.err
@@ -197,12 +328,44 @@ func (s *Service) SetSharedVar(req *SetSharedVarRequest, res *SetSharedVarRespon
 	if s.err != nil {
 		return s.err
 	}
-	return s.store.SetSharedVar(req.Name, req.Value)
+	err := s.store.SetSharedVar(req.Name, req.Value)
+	if err == nil {
+		s.hub.publish(req.Name, req.Value, false)
+	}
+	return err
 }
 
 func (s *Service) DelSharedVar(req *DelSharedVarRequest, res *DelSharedVarResponse) error {
 	if s.err != nil {
 		return s.err
 	}
-	return s.store.DelSharedVar(req.Name)
+	err := s.store.DelSharedVar(req.Name)
+	if err == nil {
+		s.hub.publish(req.Name, "", true)
+	}
+	return err
+}
+
+func (s *Service) CompareAndSwapSharedVar(req *CompareAndSwapSharedVarRequest, res *CompareAndSwapSharedVarResponse) error {
+	if s.err != nil {
+		return s.err
+	}
+	swapped, err := s.store.CompareAndSwapSharedVar(req.Name, req.Old, req.New)
+	res.Swapped = swapped
+	if swapped {
+		s.hub.publish(req.Name, req.New, false)
+	}
+	return err
+}
+
+func (s *Service) IncSharedVar(req *IncSharedVarRequest, res *IncSharedVarResponse) error {
+	if s.err != nil {
+		return s.err
+	}
+	value, err := s.store.IncSharedVar(req.Name, req.Delta)
+	res.Value = value
+	if err == nil {
+		s.hub.publish(req.Name, value, false)
+	}
+	return err
 }
@@ -2,7 +2,11 @@
 
 package daemon
 
-import "net"
+import (
+	"net"
+	"os"
+	"syscall"
+)
 
 func listen(path string) (net.Listener, error) {
 	return net.Listen("unix", path)
@@ -11,3 +15,15 @@ func listen(path string) (net.Listener, error) {
 func dial(path string) (net.Conn, error) {
 	return net.Dial("unix", path)
 }
+
+// classifyDialError reports whether an error from dial shows that the socket
+// file is missing, or that it is left behind by a daemon that is no longer
+// listening on it.
+func classifyDialError(err error) (missing, stale bool) {
+	if opErr, ok := err.(*net.OpError); ok {
+		if sysErr, ok := opErr.Err.(*os.SyscallError); ok {
+			return sysErr.Err == syscall.ENOENT, sysErr.Err == syscall.ECONNREFUSED
+		}
+	}
+	return false, false
+}
@@ -0,0 +1,33 @@
+// +build !windows,!plan9
+
+package daemon
+
+import (
+	"net"
+	"testing"
+
+	"github.com/elves/elvish/util"
+)
+
+func TestClientRemovesStaleSocket(t *testing.T) {
+	util.InTempDir(func(string) {
+		// Leave a socket file behind, as a daemon that was killed does.
+		listener, err := listen("sock")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listener.(*net.UnixListener).SetUnlinkOnClose(false)
+		listener.Close()
+
+		client := NewClient("sock")
+		defer client.Close()
+		client.SetSpawner(func() error {
+			listener = serveFake(t, "sock", oldService{})
+			return nil
+		})
+		if _, err := client.Version(); err != nil {
+			t.Errorf("client.Version() -> error %v, want nil", err)
+		}
+		listener.Close()
+	})
+}
@@ -46,3 +46,14 @@ func dial(path string) (net.Conn, error) {
 	}
 	return net.Dial("tcp", string(buf))
 }
+
+// classifyDialError reports whether an error from dial shows that the socket
+// file is missing, or that it is left behind by a daemon that is no longer
+// listening on the address in it.
+func classifyDialError(err error) (missing, stale bool) {
+	if os.IsNotExist(err) {
+		return true, false
+	}
+	_, isNetErr := err.(*net.OpError)
+	return false, isNetErr
+}
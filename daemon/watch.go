@@ -0,0 +1,165 @@
+package daemon
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Watching shared variables.
+//
+// net/rpc has no streaming calls, so changes are delivered by long polling:
+// the WatchSharedVars method blocks until there are changes newer than the
+// sequence number the client has seen, or until watchTimeout has passed. The
+// daemon keeps the most recent changes in memory; a client that falls too far
+// behind misses the older ones.
+
+const (
+	// How long a WatchSharedVars call waits for changes.
+	watchTimeout = 30 * time.Second
+	// Number of recent changes kept by the daemon.
+	maxSharedVarChanges = 1024
+)
+
+// SharedVarChange is a change to a shared variable.
+type SharedVarChange struct {
+	Seq     int
+	Name    string
+	Value   string
+	Deleted bool
+}
+
+// Matches returns whether the change is to the variable name, or to a variable
+// whose name starts with name if prefix is true.
+func (c SharedVarChange) Matches(name string, prefix bool) bool {
+	if prefix {
+		return strings.HasPrefix(c.Name, name)
+	}
+	return c.Name == name
+}
+
+// sharedVarHub keeps recent changes to shared variables and wakes up watchers
+// when new changes are published.
+type sharedVarHub struct {
+	mutex   sync.Mutex
+	seq     int
+	changes []SharedVarChange
+	// Closed and replaced when a change is published.
+	changed chan struct{}
+}
+
+func newSharedVarHub() *sharedVarHub {
+	return &sharedVarHub{changed: make(chan struct{})}
+}
+
+func (h *sharedVarHub) publish(name, value string, deleted bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.seq++
+	h.changes = append(h.changes, SharedVarChange{h.seq, name, value, deleted})
+	if len(h.changes) > maxSharedVarChanges {
+		h.changes = h.changes[len(h.changes)-maxSharedVarChanges:]
+	}
+	close(h.changed)
+	h.changed = make(chan struct{})
+}
+
+// watch returns the matching changes newer than after, waiting up to timeout
+// for them, and the current sequence number. If after is negative or newer
+// than the current sequence number, it returns immediately.
+func (h *sharedVarHub) watch(name string, prefix bool, after int, timeout time.Duration) ([]SharedVarChange, int) {
+	deadline := time.After(timeout)
+	for {
+		h.mutex.Lock()
+		seq, changed := h.seq, h.changed
+		if after < 0 || after > seq {
+			h.mutex.Unlock()
+			return nil, seq
+		}
+		var changes []SharedVarChange
+		for _, c := range h.changes {
+			if c.Seq > after && c.Matches(name, prefix) {
+				changes = append(changes, c)
+			}
+		}
+		h.mutex.Unlock()
+		if len(changes) > 0 {
+			return changes, seq
+		}
+		// Changes to other variables are skipped, but still advance the
+		// sequence number seen.
+		after = seq
+		select {
+		case <-changed:
+		case <-deadline:
+			return nil, seq
+		}
+	}
+}
+
+// WatchSharedVars waits for changes to shared variables.
+func (s *Service) WatchSharedVars(req *WatchSharedVarsRequest, res *WatchSharedVarsResponse) error {
+	res.Changes, res.Seq = s.hub.watch(req.Name, req.Prefix, req.After, watchTimeout)
+	return nil
+}
+
+// WatchSharedVars calls f with each change to the shared variable name, or to
+// shared variables whose names start with name if prefix is true, in a
+// separate goroutine. Only changes made after the call are reported. Watching
+// stops when the returned function is called or the Client is closed.
+//
+// Connection errors are retried with backoff, so watching survives restarts
+// of the daemon.
+func (c *Client) WatchSharedVars(name string, prefix bool, f func(SharedVarChange)) (stop func()) {
+	done := make(chan struct{})
+	var once sync.Once
+	stop = func() { once.Do(func() { close(done) }) }
+	if c == nil {
+		return stop
+	}
+	go func() {
+		after := -1
+		wait := reconnectWait
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			req := &WatchSharedVarsRequest{name, prefix, after}
+			res := &WatchSharedVarsResponse{}
+			// Long-polling calls are not registered in c.waits, so that
+			// closing the Client does not wait for them.
+			err := c.invoke("WatchSharedVars", req, res)
+			if err == errClientClosed || err == ErrUnsupported {
+				return
+			} else if err != nil {
+				logger.Println("failed to watch shared variables:", err)
+				select {
+				case <-done:
+					return
+				case <-time.After(wait):
+				}
+				wait = nextWait(wait)
+				continue
+			}
+			wait = reconnectWait
+			if after >= 0 && res.Seq < after {
+				// The daemon has been restarted and its sequence numbers
+				// start over; get all changes it has.
+				after = 0
+				continue
+			}
+			for _, change := range res.Changes {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				f(change)
+			}
+			after = res.Seq
+		}
+	}()
+	return stop
+}
@@ -0,0 +1,43 @@
+package daemon
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSharedVarHub(t *testing.T) {
+	h := newSharedVarHub()
+	if changes, seq := h.watch("a", false, -1, time.Second); changes != nil || seq != 0 {
+		t.Errorf("watch from now -> (%v, %d), want (nil, 0)", changes, seq)
+	}
+
+	h.publish("a", "1", false)
+	h.publish("b", "2", false)
+	h.publish("ab", "", true)
+	changes, seq := h.watch("a", true, 0, time.Second)
+	want := []SharedVarChange{{1, "a", "1", false}, {3, "ab", "", true}}
+	if !reflect.DeepEqual(changes, want) || seq != 3 {
+		t.Errorf("watch prefix -> (%v, %d), want (%v, 3)", changes, seq, want)
+	}
+
+	// A watch waits for matching changes, skipping others.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		h.publish("b", "3", false)
+		h.publish("a", "4", false)
+	}()
+	changes, seq = h.watch("a", false, 3, time.Second)
+	want = []SharedVarChange{{5, "a", "4", false}}
+	if !reflect.DeepEqual(changes, want) || seq != 5 {
+		t.Errorf("waiting watch -> (%v, %d), want (%v, 5)", changes, seq, want)
+	}
+
+	if changes, seq := h.watch("a", false, 5, 10*time.Millisecond); changes != nil || seq != 5 {
+		t.Errorf("watch timing out -> (%v, %d), want (nil, 5)", changes, seq)
+	}
+	// A sequence number from a previous daemon is newer than the current one.
+	if changes, seq := h.watch("a", false, 100, time.Second); changes != nil || seq != 5 {
+		t.Errorf("watch with future seq -> (%v, %d), want (nil, 5)", changes, seq)
+	}
+}
@@ -3,6 +3,7 @@ package edit
 import (
 	"errors"
 	"strconv"
+	"strings"
 	"unicode/utf8"
 	"unsafe"
 
@@ -77,9 +78,12 @@ func installModules(builtin eval.Ns, ed *Editor) {
 	// TODO(xiaq): Everything here should be registered to some registry instead
 	// of centralized here.
 
-	// Editor configurations.
+	// Editor configurations. Variables with names like mode:name belong to
+	// submodules, and are added below.
 	for name, variable := range ed.variables {
-		ns[name] = variable
+		if !strings.ContainsRune(name, ':') {
+			ns[name] = variable
+		}
 	}
 
 	// Internal states.
@@ -144,6 +148,9 @@ func installModules(builtin eval.Ns, ed *Editor) {
 	for _, bac := range argCompletersData {
 		ns[bac.name+eval.FnSuffix] = vartypes.NewRo(bac)
 	}
+	for _, bac := range externalArgCompleters {
+		ns[bac.name+eval.FnSuffix] = vartypes.NewRo(bac)
+	}
 
 	// Matchers.
 	eval.AddBuiltinFns(ns, matchers...)
@@ -153,8 +160,14 @@ func installModules(builtin eval.Ns, ed *Editor) {
 		&eval.BuiltinFn{"edit:binding-table", makeBindingTable},
 		&eval.BuiltinFn{"edit:command-history", CommandHistory},
 		&eval.BuiltinFn{"edit:complete-getopt", complGetopt},
+		&eval.BuiltinFn{"edit:complete-spec", complSpecBuiltin},
 		&eval.BuiltinFn{"edit:complex-candidate", outputComplexCandidate},
+		&eval.BuiltinFn{"edit:delete-history", deleteHistory},
+		&eval.BuiltinFn{"edit:export-history", exportHistory},
+		&eval.BuiltinFn{"edit:import-history", importHistory},
 		&eval.BuiltinFn{"edit:insert-at-dot", InsertAtDot},
+		&eval.BuiltinFn{"edit:pick", pick},
+		&eval.BuiltinFn{"edit:prompt-refresh", PromptRefresh},
 		&eval.BuiltinFn{"edit:replace-input", ReplaceInput},
 		&eval.BuiltinFn{"edit:styled", styled},
 		&eval.BuiltinFn{"edit:key", ui.KeyBuiltin},
@@ -163,6 +176,20 @@ func installModules(builtin eval.Ns, ed *Editor) {
 		&eval.BuiltinFn{"edit:-narrow-read", NarrowRead},
 	)
 
+	// Options of the functions, for completion.
+	optNames := map[string][]string{
+		"edit:complex-candidate": {
+			"code-suffix", "display-suffix", "style", "description", "group"},
+		"edit:delete-history": {"pattern"},
+		"edit:import-history": {"format"},
+		"edit:-narrow-read":   eval.StructOptNames(&narrowOptions{}),
+		"edit:pick":           eval.StructOptNames(&narrowOptions{}),
+	}
+	for _, matcher := range matchers {
+		optNames[matcher.Name] = eval.StructOptNames(&matcherOptions{})
+	}
+	eval.AddBuiltinOptNames(optNames)
+
 	builtin["edit"+eval.NsSuffix] = vartypes.NewValidatedPtr(ns, eval.ShouldBeNs)
 	submods := make(map[string]eval.Ns)
 	// Install other modules.
@@ -172,6 +199,16 @@ func installModules(builtin eval.Ns, ed *Editor) {
 		}
 	}
 
+	for name, variable := range ed.variables {
+		if i := strings.IndexRune(name, ':'); i != -1 {
+			module := name[:i]
+			if submods[module] == nil {
+				submods[module] = make(eval.Ns)
+			}
+			submods[module][name[i+1:]] = variable
+		}
+	}
+
 	// Add $edit:{mode}:binding variables.
 	for mode, bindingVar := range ed.bindings {
 		submod, ok := submods[mode]
@@ -99,7 +99,7 @@ func (ed *Editor) argCompleter() types.Map {
 // completeArg calls the correct argument completers according to the command
 // name. It is used by complArg and can also be useful when further dispatching
 // based on command name is needed -- e.g. in the argument completer for "sudo".
-func completeArg(words []string, ev *eval.Evaler, rawCands chan<- rawCandidate) error {
+func completeArg(words []string, ev *eval.Evaler, interrupts <-chan struct{}, rawCands chan<- rawCandidate) error {
 	logger.Printf("completing argument: %q", words)
 	// XXX(xiaq): not the best way to get argCompleter.
 	m := ev.Editor.(*Editor).argCompleter()
@@ -113,12 +113,12 @@ func completeArg(words []string, ev *eval.Evaler, rawCands chan<- rawCandidate)
 	if !ok {
 		return ErrCompleterMustBeFn
 	}
-	return callArgCompleter(fn, ev, words, rawCands)
+	return callArgCompleter(fn, ev, interrupts, words, rawCands)
 }
 
 type builtinArgCompleter struct {
 	name string
-	impl func([]string, *eval.Evaler, chan<- rawCandidate) error
+	impl func([]string, *eval.Evaler, <-chan struct{}, chan<- rawCandidate) error
 }
 
 var _ eval.Fn = &builtinArgCompleter{}
@@ -155,7 +155,7 @@ func (bac *builtinArgCompleter) Call(ec *eval.Frame, args []types.Value, opts ma
 	var err error
 	go func() {
 		defer close(rawCands)
-		err = bac.impl(words, ec.Evaler, rawCands)
+		err = bac.impl(words, ec.Evaler, ec.Interrupts(), rawCands)
 	}()
 
 	output := ec.OutputChan()
@@ -165,32 +165,32 @@ func (bac *builtinArgCompleter) Call(ec *eval.Frame, args []types.Value, opts ma
 	maybeThrow(err)
 }
 
-func complFilename(words []string, ev *eval.Evaler, rawCands chan<- rawCandidate) error {
+func complFilename(words []string, ev *eval.Evaler, interrupts <-chan struct{}, rawCands chan<- rawCandidate) error {
 	if len(words) < 1 {
 		return ErrTooFewArguments
 	}
 	return complFilenameInner(words[len(words)-1], false, rawCands)
 }
 
-func complSudo(words []string, ev *eval.Evaler, rawCands chan<- rawCandidate) error {
+func complSudo(words []string, ev *eval.Evaler, interrupts <-chan struct{}, rawCands chan<- rawCandidate) error {
 	if len(words) < 2 {
 		return ErrTooFewArguments
 	}
 	if len(words) == 2 {
 		return complFormHeadInner(words[1], ev, rawCands)
 	}
-	return completeArg(words[1:], ev, rawCands)
+	return completeArg(words[1:], ev, interrupts, rawCands)
 }
 
 // callArgCompleter calls a Fn, assuming that it is an arg completer. It calls
 // the Fn with specified arguments and closed input, and converts its output to
 // candidate objects.
-func callArgCompleter(fn eval.Fn,
-	ev *eval.Evaler, words []string, rawCands chan<- rawCandidate) error {
+func callArgCompleter(fn eval.Fn, ev *eval.Evaler,
+	interrupts <-chan struct{}, words []string, rawCands chan<- rawCandidate) error {
 
 	// Quick path for builtin arg completers.
 	if builtin, ok := fn.(*builtinArgCompleter); ok {
-		return builtin.impl(words, ev, rawCands)
+		return builtin.impl(words, ev, interrupts, rawCands)
 	}
 
 	args := make([]types.Value, len(words))
@@ -235,6 +235,7 @@ func callArgCompleter(fn eval.Fn,
 
 	// XXX There is no source to pass to NewTopEvalCtx.
 	ec := eval.NewTopFrame(ev, eval.NewInternalSource("[editor completer]"), ports)
+	ec.SetInterrupts(interrupts)
 	err := ec.PCaptureOutputInner(fn, args, eval.NoOpts, valuesCb, bytesCb)
 	if err != nil {
 		err = errors.New("completer error: " + err.Error())
@@ -3,7 +3,6 @@ package edit
 import (
 	"fmt"
 	"os"
-	"sort"
 
 	"github.com/elves/elvish/edit/ui"
 	"github.com/elves/elvish/eval"
@@ -13,8 +12,11 @@ import (
 )
 
 type candidate struct {
-	code string    // This is what will be substituted on the command line.
-	menu ui.Styled // This is what is displayed in the completion menu.
+	code        string    // This is what will be substituted on the command line.
+	menu        ui.Styled // This is what is displayed in the completion menu.
+	description string    // Shown next to the menu text. May be empty.
+	group       string    // Heading of the group in the menu. May be empty.
+	matched     []int     // Byte offsets of runes in the menu text matching the seed.
 }
 
 // rawCandidate is what can be converted to a candidate.
@@ -66,13 +68,15 @@ type complexCandidate struct {
 	codeSuffix    string    // Appended to the code.
 	displaySuffix string    // Appended to the display.
 	style         ui.Styles // Used in the menu.
+	description   string    // Shown in a column next to the menu.
+	group         string    // Candidates are grouped under this heading.
 }
 
 func (c *complexCandidate) Kind() string { return "map" }
 
 func (c *complexCandidate) Equal(a interface{}) bool {
 	rhs, ok := a.(*complexCandidate)
-	return ok && c.stem == rhs.stem && c.codeSuffix == rhs.codeSuffix && c.displaySuffix == rhs.displaySuffix && c.style.Eq(rhs.style)
+	return ok && c.stem == rhs.stem && c.codeSuffix == rhs.codeSuffix && c.displaySuffix == rhs.displaySuffix && c.style.Eq(rhs.style) && c.description == rhs.description && c.group == rhs.group
 }
 
 func (c *complexCandidate) Hash() uint32 {
@@ -81,14 +85,17 @@ func (c *complexCandidate) Hash() uint32 {
 	h = hash.DJBCombine(h, hash.String(c.codeSuffix))
 	h = hash.DJBCombine(h, hash.String(c.displaySuffix))
 	h = hash.DJBCombine(h, c.style.Hash())
+	h = hash.DJBCombine(h, hash.String(c.description))
+	h = hash.DJBCombine(h, hash.String(c.group))
 	return h
 }
 
 func (c *complexCandidate) Repr(indent int) string {
 	// TODO(xiaq): Pretty-print when indent >= 0
-	return fmt.Sprintf("(edit:complex-candidate %s &code-suffix=%s &display-suffix=%s style=%s)",
+	return fmt.Sprintf("(edit:complex-candidate %s &code-suffix=%s &display-suffix=%s style=%s &description=%s &group=%s)",
 		parse.Quote(c.stem), parse.Quote(c.codeSuffix),
-		parse.Quote(c.displaySuffix), parse.Quote(c.style.String()))
+		parse.Quote(c.displaySuffix), parse.Quote(c.style.String()),
+		parse.Quote(c.description), parse.Quote(c.group))
 }
 
 func (c *complexCandidate) text() string { return c.stem }
@@ -96,8 +103,10 @@ func (c *complexCandidate) text() string { return c.stem }
 func (c *complexCandidate) cook(q parse.PrimaryType) *candidate {
 	quoted, _ := parse.QuoteAs(c.stem, q)
 	return &candidate{
-		code: quoted + c.codeSuffix,
-		menu: ui.Styled{c.stem + c.displaySuffix, c.style},
+		code:        quoted + c.codeSuffix,
+		menu:        ui.Styled{c.stem + c.displaySuffix, c.style},
+		description: c.description,
+		group:       c.group,
 	}
 }
 
@@ -113,6 +122,8 @@ func outputComplexCandidate(ec *eval.Frame,
 		eval.OptToScan{"code-suffix", &c.codeSuffix, types.String("")},
 		eval.OptToScan{"display-suffix", &c.displaySuffix, types.String("")},
 		eval.OptToScan{"style", &style, types.String("")},
+		eval.OptToScan{"description", &c.description, types.String("")},
+		eval.OptToScan{"group", &c.group, types.String("")},
 	)
 	if style != "" {
 		c.style = ui.StylesFromString(style)
@@ -121,43 +132,44 @@ func outputComplexCandidate(ec *eval.Frame,
 	ec.OutputChan() <- c
 }
 
-func filterRawCandidates(ev *eval.Evaler, matcher eval.Fn,
-	seed string, chanRawCandidate <-chan rawCandidate) ([]rawCandidate, error) {
+// filterRawCandidates calls the matcher on the texts of the raw candidates, and
+// returns those accepted by the matcher. Closing the interrupts channel
+// interrupts the matcher.
+func filterRawCandidates(ev *eval.Evaler, matcher eval.Fn, seed string,
+	rawCands []rawCandidate, interrupts <-chan struct{}) ([]rawCandidate, error) {
 
 	matcherInput := make(chan types.Value)
-	stopCollector := make(chan struct{})
-	var collected []rawCandidate
+	stopFeeder := make(chan struct{})
 	go func() {
 		defer close(matcherInput)
-		for rc := range chanRawCandidate {
-			collected = append(collected, rc)
+		for _, rc := range rawCands {
 			select {
 			case matcherInput <- types.String(rc.text()):
-			case <-stopCollector:
+			case <-stopFeeder:
 				return
 			}
 		}
 	}()
-	defer close(stopCollector)
+	defer close(stopFeeder)
 
 	ports := []*eval.Port{
 		{Chan: matcherInput, File: eval.DevNull}, {File: os.Stdout}, {File: os.Stderr}}
 	ec := eval.NewTopFrame(ev, eval.NewInternalSource("[editor matcher]"), ports)
+	ec.SetInterrupts(interrupts)
 
 	args := []types.Value{types.String(seed)}
 	values, err := ec.PCaptureOutput(matcher, args, eval.NoOpts)
 	if err != nil {
 		return nil, err
-	} else if len(values) != len(collected) {
+	} else if len(values) != len(rawCands) {
 		return nil, errIncorrectNumOfResults
 	}
 
 	var filtered []rawCandidate
 	for i, value := range values {
 		if types.ToBool(value) {
-			filtered = append(filtered, collected[i])
+			filtered = append(filtered, rawCands[i])
 		}
 	}
-	sort.Sort(rawCandidates(filtered))
 	return filtered, nil
 }
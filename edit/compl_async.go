@@ -0,0 +1,223 @@
+package edit
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/parse"
+	"github.com/elves/elvish/util"
+)
+
+// Completion candidates are generated in the background, so that slow
+// completers do not freeze the editor. When completion starts, the editor waits
+// a short while for the candidates; if they are not all ready by then, the
+// completion menu is shown with the candidates generated so far, and populated
+// as more arrive. Leaving the completion mode cancels the completion, which
+// interrupts the completers and the matcher.
+//
+// Candidates for arguments that are not ready within the wait are cached, keyed
+// by the working directory, the quoting of the seed and the words, including
+// the seed. The cache is cleared when the working directory changes. Fast
+// completions are not cached, so that, for instance, newly created files still
+// show up when completing filenames.
+
+var _ = registerBuiltins(modeCompletion, map[string]func(*Editor){
+	"close":       complClose,
+	"clear-cache": complClearCache,
+})
+
+var (
+	// complMaxWait is how long starting completion waits for all candidates
+	// to be generated.
+	complMaxWait = 100 * time.Millisecond
+	// complUpdateInterval is the minimal interval between two updates to the
+	// completion menu while candidates are being generated.
+	complUpdateInterval = 50 * time.Millisecond
+)
+
+// complJob is a completion running in the background.
+type complJob struct {
+	completer  string
+	begin, end int
+	cacheKey   string
+	started    time.Time
+	// Closed when the job is cancelled.
+	cancel chan struct{}
+	// Receives the candidates generated so far, and finally a complUpdate with
+	// done set to true.
+	updates chan complUpdate
+}
+
+type complUpdate struct {
+	candidates []*candidate
+	done       bool
+	err        error
+	// All the entries, set when the job is done.
+	entries []complEntry
+}
+
+// startComplJob starts a completion job in the background. Any running job is
+// cancelled.
+func (ed *Editor) startComplJob(ctx complContext, matcher eval.Fn) *complJob {
+	ed.cancelComplJob()
+	common := ctx.common()
+	job := &complJob{
+		completer: ctx.name(),
+		begin:     common.begin, end: common.end,
+		started: time.Now(),
+		cancel:  make(chan struct{}),
+		updates: make(chan complUpdate),
+	}
+	if argCtx, ok := ctx.(*argComplContext); ok {
+		cwd, err := os.Getwd()
+		if err != nil {
+			cwd = ""
+		}
+		if cwd != ed.complCacheDir {
+			ed.complCache = make(map[string][]complEntry)
+			ed.complCacheDir = cwd
+		}
+		job.cacheKey = complCacheKey(cwd, common.quoting, argCtx.words)
+		if entries, ok := ed.complCache[job.cacheKey]; ok {
+			go job.send(complUpdate{sortedCandidates(entries), true, nil, entries})
+			ed.complJob = job
+			return job
+		}
+	}
+	ed.complJob = job
+	go job.run(ed.evaler, ctx, matcher)
+	return job
+}
+
+// complCacheKey returns the key of cached candidates for the given words
+// completed in the given directory with the given quoting.
+func complCacheKey(cwd string, quoting parse.PrimaryType, words []string) string {
+	return strings.Join(append([]string{cwd, quoting.String()}, words...), "\x00")
+}
+
+// cancelComplJob cancels the running completion job, if any.
+func (ed *Editor) cancelComplJob() {
+	if ed.complJob != nil {
+		close(ed.complJob.cancel)
+		ed.complJob = nil
+	}
+}
+
+// complUpdates returns the channel of updates from the running completion job,
+// or nil if there is none.
+func (ed *Editor) complUpdates() <-chan complUpdate {
+	if ed.complJob == nil {
+		return nil
+	}
+	return ed.complJob.updates
+}
+
+// send sends an update, unless the job is cancelled first. It returns whether
+// the update was sent.
+func (job *complJob) send(u complUpdate) bool {
+	select {
+	case job.updates <- u:
+		return true
+	case <-job.cancel:
+		return false
+	}
+}
+
+// run generates and filters the candidates, sending updates periodically.
+func (job *complJob) run(ev *eval.Evaler, ctx complContext, matcher eval.Fn) {
+	common := ctx.common()
+	rawCands := make(chan rawCandidate)
+	errGenerate := make(chan error, 1)
+	go func() {
+		err := ctx.generate(ev, job.cancel, rawCands)
+		close(rawCands)
+		errGenerate <- err
+	}()
+
+	var (
+		entries []complEntry
+		batch   []rawCandidate
+		changed bool
+		err     error
+	)
+	filterBatch := func() {
+		if len(batch) == 0 {
+			return
+		}
+		filtered, errFilter := filterRawCandidates(ev, matcher, common.seed, batch, job.cancel)
+		batch = nil
+		if errFilter != nil {
+			err = errFilter
+			return
+		}
+		if len(filtered) > 0 {
+			entries = append(entries, cookRawCandidates(filtered, common.quoting, common.seed)...)
+			changed = true
+		}
+	}
+
+	ticker := time.NewTicker(complUpdateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case rc, ok := <-rawCands:
+			if !ok {
+				filterBatch()
+				err = util.Errors(<-errGenerate, err)
+				job.send(complUpdate{sortedCandidates(entries), true, err, entries})
+				return
+			}
+			if err == nil {
+				batch = append(batch, rc)
+			}
+		case <-ticker.C:
+			filterBatch()
+			if changed && job.send(complUpdate{sortedCandidates(entries), false, nil, nil}) {
+				changed = false
+			}
+		case <-job.cancel:
+			// Let the generator run to its end.
+			go func() {
+				for range rawCands {
+				}
+			}()
+			return
+		}
+	}
+}
+
+// receiveCompl applies an update from the running completion job to the
+// completion mode.
+func (ed *Editor) receiveCompl(u complUpdate) {
+	job := ed.complJob
+	c := &ed.completion
+	c.setCandidates(u.candidates)
+	if !u.done {
+		return
+	}
+	ed.complJob = nil
+	c.loading = false
+	if u.err == nil && job.cacheKey != "" && time.Since(job.started) > complMaxWait {
+		ed.complCache[job.cacheKey] = u.entries
+	}
+	if u.err != nil {
+		ed.addComplErrorTip(u.err)
+	}
+	if len(u.candidates) == 0 {
+		if u.err == nil {
+			ed.addTip("no candidate for %s", job.completer)
+		}
+		ed.mode = &ed.insert
+	}
+}
+
+func complClose(ed *Editor) {
+	ed.cancelComplJob()
+	ed.mode = &ed.insert
+}
+
+func complClearCache(ed *Editor) {
+	ed.complCache = make(map[string][]complEntry)
+}
@@ -0,0 +1,165 @@
+package edit
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/parse"
+	"github.com/elves/elvish/util"
+)
+
+type fakeComplContext struct {
+	complContextCommon
+	gen func(<-chan struct{}, chan<- rawCandidate) error
+}
+
+func (*fakeComplContext) name() string { return "fake" }
+
+func (ctx *fakeComplContext) generate(ev *eval.Evaler, interrupts <-chan struct{}, ch chan<- rawCandidate) error {
+	return ctx.gen(interrupts, ch)
+}
+
+func newComplTestEditor() *Editor {
+	ed := &Editor{
+		evaler: eval.NewEvaler(), variables: makeVariables(),
+		complCache: make(map[string][]complEntry),
+	}
+	ed.evaler.Editor = ed
+	return ed
+}
+
+func candidateTexts(cands []*candidate) []string {
+	var texts []string
+	for _, cand := range cands {
+		texts = append(texts, cand.menu.Text)
+	}
+	return texts
+}
+
+func TestComplJob(t *testing.T) {
+	ed := newComplTestEditor()
+	ctx := &fakeComplContext{gen: func(_ <-chan struct{}, ch chan<- rawCandidate) error {
+		ch <- plainCandidate("b")
+		ch <- plainCandidate("a")
+		return nil
+	}}
+	job := ed.startComplJob(ctx, matchPrefix)
+	var u complUpdate
+	for !u.done {
+		u = <-job.updates
+	}
+	if got := candidateTexts(u.candidates); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("got candidates %v, want [a b]", got)
+	}
+}
+
+func TestComplJobCancel(t *testing.T) {
+	ed := newComplTestEditor()
+	generatorDone := make(chan struct{})
+	ctx := &fakeComplContext{gen: func(interrupts <-chan struct{}, ch chan<- rawCandidate) error {
+		defer close(generatorDone)
+		ch <- plainCandidate("a")
+		// Block like a slow completer, until interrupted.
+		<-interrupts
+		return nil
+	}}
+	job := ed.startComplJob(ctx, matchPrefix)
+
+	// The candidates generated so far are sent before the completer finishes.
+	u := <-job.updates
+	if u.done || !reflect.DeepEqual(candidateTexts(u.candidates), []string{"a"}) {
+		t.Errorf("got update %v, want partial update with [a]", u)
+	}
+
+	ed.cancelComplJob()
+	select {
+	case <-generatorDone:
+	case <-time.After(time.Second):
+		t.Errorf("completer not interrupted after cancelling")
+	}
+	if ed.complUpdates() != nil {
+		t.Errorf("updates channel not nil after cancelling")
+	}
+}
+
+func TestComplJobReplaced(t *testing.T) {
+	ed := newComplTestEditor()
+	generatorDone := make(chan struct{})
+	slow := &fakeComplContext{gen: func(interrupts <-chan struct{}, ch chan<- rawCandidate) error {
+		defer close(generatorDone)
+		<-interrupts
+		return nil
+	}}
+	ed.startComplJob(slow, matchPrefix)
+
+	// Starting another job interrupts the completer of the old one, and not
+	// that of the new one.
+	fast := &fakeComplContext{gen: func(interrupts <-chan struct{}, ch chan<- rawCandidate) error {
+		select {
+		case <-interrupts:
+			t.Errorf("completer of new job interrupted")
+		default:
+		}
+		ch <- plainCandidate("a")
+		return nil
+	}}
+	job := ed.startComplJob(fast, matchPrefix)
+	select {
+	case <-generatorDone:
+	case <-time.After(time.Second):
+		t.Errorf("completer of old job not interrupted after starting new job")
+	}
+	var u complUpdate
+	for !u.done {
+		u = <-job.updates
+	}
+	if got := candidateTexts(u.candidates); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("got candidates %v from new job, want [a]", got)
+	}
+}
+
+func TestComplJobCache(t *testing.T) {
+	util.InTempDir(func(dir string) {
+		ed := newComplTestEditor()
+		ctx := &argComplContext{words: []string{"cmd", "x"}}
+		ctx.quoting = parse.Bareword
+		entries := cookRawCandidates([]rawCandidate{plainCandidate("x1")}, 0, "x")
+		cwd, _ := os.Getwd()
+		key := complCacheKey(cwd, parse.Bareword, ctx.words)
+
+		// A fast completion is not cached.
+		ed.complJob = &complJob{cacheKey: key, started: time.Now()}
+		ed.receiveCompl(complUpdate{sortedCandidates(entries), true, nil, entries})
+		if len(ed.complCache) != 0 {
+			t.Errorf("fast completion cached")
+		}
+
+		// A slow completion is cached, and used for the same words.
+		ed.complCacheDir = cwd
+		ed.complJob = &complJob{cacheKey: key, started: time.Now().Add(-time.Second)}
+		ed.receiveCompl(complUpdate{sortedCandidates(entries), true, nil, entries})
+		job := ed.startComplJob(ctx, matchPrefix)
+		u := <-job.updates
+		if !u.done || !reflect.DeepEqual(candidateTexts(u.candidates), []string{"x1"}) {
+			t.Errorf("got update %v, want cached [x1]", u)
+		}
+		ed.complJob = nil
+
+		// The cache is not used for a different quoting.
+		if complCacheKey(cwd, parse.SingleQuoted, ctx.words) == key {
+			t.Errorf("cache key does not depend on quoting")
+		}
+
+		// The cache is cleared when the working directory changes.
+		os.Mkdir("d", 0700)
+		os.Chdir("d")
+		ed.startComplJob(&argComplContext{words: []string{"cmd", "y"}}, matchPrefix)
+		ed.cancelComplJob()
+		if len(ed.complCache) != 0 {
+			t.Errorf("cache not cleared after changing directory")
+		}
+	})
+}
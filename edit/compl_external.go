@@ -0,0 +1,356 @@
+package edit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/getopt"
+	"github.com/elves/elvish/util"
+)
+
+// Argument completers that reuse completion knowledge from outside Elvish:
+// completion functions of bash-completion, and options listed in the output of
+// "cmd --help" or the man page of the command.
+//
+// None of them is used by default, since they run external programs. To use
+// them for all commands without a dedicated argument completer, set the
+// fallback argument completer:
+//
+//     edit:arg-completer[''] = $edit:complete-auto~
+//
+// To avoid running arbitrary programs, "cmd --help" is only run for commands
+// found by searching PATH; the options of other commands can only be found in
+// their man pages.
+
+var (
+	errNoBashCompletion = errors.New("no bash completion function")
+	errNoHelpOptions    = errors.New("no options found in help text or man page")
+)
+
+var externalArgCompleters = []*builtinArgCompleter{
+	{"complete-auto", complAuto},
+	{"complete-bash", complBash},
+	{"complete-help", complHelp},
+}
+
+// externalComplTimeout is the maximum time external programs are allowed to
+// run when generating candidates.
+var externalComplTimeout = 2 * time.Second
+
+// externalComplContext returns a context for running external programs, which
+// is cancelled after externalComplTimeout or when the completion is
+// interrupted.
+func externalComplContext(interrupts <-chan struct{}) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), externalComplTimeout)
+	go func() {
+		select {
+		case <-interrupts:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// complAuto tries complBash, and then complHelp when completing an option, and
+// then falls back to completing filenames.
+func complAuto(words []string, ev *eval.Evaler, interrupts <-chan struct{}, rawCands chan<- rawCandidate) error {
+	if len(words) < 1 {
+		return ErrTooFewArguments
+	}
+	err := complBash(words, ev, interrupts, rawCands)
+	if err != errNoBashCompletion {
+		return err
+	}
+	// Running "cmd --help" is only worth it for options.
+	if strings.HasPrefix(words[len(words)-1], "-") {
+		err = complHelp(words, ev, interrupts, rawCands)
+		if err != errNoHelpOptions {
+			return err
+		}
+	}
+	return complFilename(words, ev, interrupts, rawCands)
+}
+
+// bashComplScript finds and calls the bash completion function for a command,
+// and prints the candidates one per line. The words are passed as positional
+// arguments. It exits with 100 if there is no completion function.
+const bashComplScript = `
+for f in /usr/share/bash-completion/bash_completion /etc/bash_completion \
+         /usr/local/share/bash-completion/bash_completion; do
+    if [ -r "$f" ]; then . "$f"; break; fi
+done
+COMP_WORDS=("$@")
+COMP_CWORD=$(( $# - 1 ))
+COMP_LINE="$*"
+COMP_POINT=${#COMP_LINE}
+COMP_TYPE=9
+if ! complete -p -- "$1" >/dev/null 2>&1; then
+    declare -F _completion_loader >/dev/null && _completion_loader "$1"
+fi
+spec=$(complete -p -- "$1" 2>/dev/null)
+fn=$(printf '%s\n' "$spec" | sed -n 's/.* -F \([^ ]*\) .*/\1/p')
+[ -n "$fn" ] || exit 100
+"$fn" "$1" "${COMP_WORDS[COMP_CWORD]}" "${COMP_WORDS[COMP_CWORD-1]}" >/dev/null 2>&1
+printf '%s\n' "${COMPREPLY[@]}"
+`
+
+var (
+	// Commands known to have no bash completion function, so that the helper
+	// bash process is not started again for them.
+	noBashCompl      = map[string]bool{}
+	noBashComplMutex sync.Mutex
+)
+
+// complBash runs the bash completion function for the command in a helper
+// bash process.
+func complBash(words []string, ev *eval.Evaler, interrupts <-chan struct{}, rawCands chan<- rawCandidate) error {
+	if len(words) < 1 {
+		return ErrTooFewArguments
+	}
+	noBashComplMutex.Lock()
+	known := noBashCompl[words[0]]
+	noBashComplMutex.Unlock()
+	if known {
+		return errNoBashCompletion
+	}
+
+	ctx, cancel := externalComplContext(interrupts)
+	defer cancel()
+	args := append([]string{"-c", bashComplScript, "bash"}, words...)
+	out, err := exec.CommandContext(ctx, "bash", args...).Output()
+	if err != nil {
+		if ctx.Err() == context.Canceled {
+			return ctx.Err()
+		}
+		exit, isExit := err.(*exec.ExitError)
+		if _, notFound := err.(*exec.Error); notFound || ctx.Err() != nil ||
+			(isExit && !exit.Success() && len(out) == 0) {
+			// There is no completion function, or bash is not available or
+			// too slow.
+			noBashComplMutex.Lock()
+			noBashCompl[words[0]] = true
+			noBashComplMutex.Unlock()
+			return errNoBashCompletion
+		}
+		return err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			rawCands <- plainCandidate(line)
+		}
+	}
+	return nil
+}
+
+// complHelp completes options found in the output of "cmd --help" or the man
+// page of the command; positional arguments are completed as filenames.
+func complHelp(words []string, ev *eval.Evaler, interrupts <-chan struct{}, rawCands chan<- rawCandidate) error {
+	if len(words) < 1 {
+		return ErrTooFewArguments
+	}
+	spec := helpGetoptSpec(ev, words[0], interrupts)
+	if spec == nil {
+		return errNoHelpOptions
+	}
+	return spec.complete(words[1:], ev, interrupts, rawCands)
+}
+
+var (
+	helpSpecs      = map[string]*getoptSpec{}
+	helpSpecsMutex sync.Mutex
+)
+
+// helpGetoptSpec returns the getoptSpec derived from the man page or help text
+// of a command, or nil if no options can be found. Results are cached, unless
+// the completion was interrupted.
+func helpGetoptSpec(ev *eval.Evaler, name string, interrupts <-chan struct{}) *getoptSpec {
+	helpSpecsMutex.Lock()
+	spec, ok := helpSpecs[name]
+	helpSpecsMutex.Unlock()
+	if ok {
+		return spec
+	}
+
+	// The external programs are run without holding the lock, so that a slow
+	// command does not block the completion of other commands.
+	ctx, cancel := externalComplContext(interrupts)
+	defer cancel()
+	texts := []func() string{
+		func() string { return manText(ctx, name) },
+		func() string { return helpText(ctx, ev, name) },
+	}
+	for _, text := range texts {
+		opts, desc := parseHelpOptions(text())
+		if len(opts) > 0 {
+			spec = &getoptSpec{opts, desc,
+				[]eval.Fn{filesArgCompleter}, true}
+			break
+		}
+	}
+	select {
+	case <-interrupts:
+	default:
+		helpSpecsMutex.Lock()
+		helpSpecs[name] = spec
+		helpSpecsMutex.Unlock()
+	}
+	return spec
+}
+
+// helpText returns the output of "cmd --help", or "" if cmd is not an external
+// command found by searching PATH. Commands given as paths, like project
+// scripts, and functions are never run, since they may ignore the argument.
+func helpText(ctx context.Context, ev *eval.Evaler, name string) string {
+	if util.DontSearch(name) || eval.IsBuiltinSpecial[name] || ev.PurelyResolveFn(name) != nil {
+		return ""
+	}
+	path, err := exec.LookPath(name)
+	if err != nil || !filepath.IsAbs(path) {
+		// A relative path is found when PATH has relative directories.
+		return ""
+	}
+	return runForText(exec.CommandContext(ctx, path, "--help"))
+}
+
+func manText(ctx context.Context, name string) string {
+	if util.DontSearch(name) {
+		// man would read the file as a man page.
+		return ""
+	}
+	cmd := exec.CommandContext(ctx, "man", name)
+	cmd.Env = append(os.Environ(), "MANPAGER=cat", "PAGER=cat", "MANWIDTH=80")
+	return stripOverstrike(runForText(cmd))
+}
+
+// runForText runs a command with its stdin connected to the null device, and
+// returns its combined stdout and stderr; some programs print help to stderr.
+// The command should be created with exec.CommandContext, so that it is
+// killed on timeout.
+func runForText(cmd *exec.Cmd) string {
+	var buf bytes.Buffer
+	cmd.Stdin = nil
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	cmd.Run()
+	return buf.String()
+}
+
+// stripOverstrike removes the overstrike sequences used by man for bold and
+// underlined text, like "b\bb" and "_\bu".
+func stripOverstrike(s string) string {
+	if !strings.ContainsRune(s, '\b') {
+		return s
+	}
+	var buf bytes.Buffer
+	for _, r := range s {
+		if r == '\b' {
+			_, w := utf8.DecodeLastRune(buf.Bytes())
+			buf.Truncate(buf.Len() - w)
+		} else {
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+var (
+	// An option line starts with an option, optionally followed by a
+	// description separated by at least two spaces.
+	helpOptionLine = regexp.MustCompile(`^\s+(-[^\s].*?)(?:\s{2,}(\S.*))?$`)
+	helpOption     = regexp.MustCompile(
+		`^(?:--([\w][\w-]*)|-(\w))(\[=[^\]]*\]|=\S*|\[\S*\]|\s+[A-Z<][\w<>\-.]*)?$`)
+)
+
+// parseHelpOptions extracts options from the help text or man page of a
+// command. It recognizes lines like:
+//
+//     -a, --all                  do not ignore entries starting with .
+//         --block-size=SIZE      scale sizes by SIZE
+//     -o FILE, --output FILE
+//         write output to FILE
+//
+// where the description may also come on the next line, indented further.
+func parseHelpOptions(text string) ([]*getopt.Option, map[*getopt.Option]string) {
+	var opts []*getopt.Option
+	desc := make(map[*getopt.Option]string)
+	seen := make(map[string]bool)
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		m := helpOptionLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		description := m[2]
+		if description == "" && i+1 < len(lines) {
+			next := lines[i+1]
+			trimmed := strings.TrimSpace(next)
+			if indentOf(next) > indentOf(line) && !strings.HasPrefix(trimmed, "-") {
+				description = trimmed
+			}
+		}
+
+		var lineOpts []*getopt.Option
+		for _, field := range strings.Split(m[1], ",") {
+			om := helpOption.FindStringSubmatch(strings.TrimSpace(field))
+			if om == nil {
+				// Not an option list, e.g. "-- end of options".
+				lineOpts = nil
+				break
+			}
+			opt := &getopt.Option{Long: om[1]}
+			if om[2] != "" {
+				opt.Short, _ = utf8.DecodeRuneInString(om[2])
+			}
+			switch {
+			case om[3] == "":
+				opt.HasArg = getopt.NoArgument
+			case strings.HasPrefix(om[3], "["):
+				opt.HasArg = getopt.OptionalArgument
+			default:
+				opt.HasArg = getopt.RequiredArgument
+			}
+			lineOpts = append(lineOpts, opt)
+		}
+
+		if len(lineOpts) == 2 && lineOpts[0].Long == "" && lineOpts[1].Short == 0 {
+			// A short option and its long form, like "-a, --all".
+			short, long := lineOpts[0], lineOpts[1]
+			long.Short = short.Short
+			if long.HasArg == getopt.NoArgument {
+				long.HasArg = short.HasArg
+			}
+			lineOpts = lineOpts[1:]
+		}
+
+		for _, opt := range lineOpts {
+			shortKey, longKey := "-"+string(opt.Short), "--"+opt.Long
+			if (opt.Short == 0 || seen[shortKey]) && (opt.Long == "" || seen[longKey]) {
+				continue
+			}
+			seen[shortKey], seen[longKey] = true, true
+			opts = append(opts, opt)
+			if description != "" {
+				desc[opt] = description
+			}
+		}
+	}
+	return opts, desc
+}
+
+func indentOf(s string) int {
+	return len(s) - len(strings.TrimLeft(s, " \t"))
+}
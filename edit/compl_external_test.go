@@ -0,0 +1,61 @@
+package edit
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/elves/elvish/getopt"
+)
+
+var helpText1 = `Usage: ls [OPTION]... [FILE]...
+List information about the FILEs (the current directory by default).
+
+  -a, --all                  do not ignore entries starting with .
+      --block-size=SIZE      with -l, scale sizes by SIZE when printing them
+      --color[=WHEN]         colorize the output
+  -o FILE, --output FILE
+                             write output to FILE
+  -1                         list one file per line
+  -a                         duplicate of --all
+`
+
+var manText1 = "N\bNA\bAM\bME\bE\n" +
+	"       -v, --verbose\n" +
+	"              explain what is being done\n"
+
+func TestParseHelpOptions(t *testing.T) {
+	opts, desc := parseHelpOptions(helpText1)
+	wantOpts := []*getopt.Option{
+		{'a', "all", getopt.NoArgument},
+		{0, "block-size", getopt.RequiredArgument},
+		{0, "color", getopt.OptionalArgument},
+		{'o', "output", getopt.RequiredArgument},
+		{'1', "", getopt.NoArgument},
+	}
+	wantDescs := []string{
+		"do not ignore entries starting with .",
+		"with -l, scale sizes by SIZE when printing them",
+		"colorize the output", "write output to FILE", "list one file per line",
+	}
+	if !reflect.DeepEqual(opts, wantOpts) {
+		t.Errorf("parseHelpOptions -> %v, want %v", opts, wantOpts)
+	} else {
+		for i, opt := range opts {
+			if desc[opt] != wantDescs[i] {
+				t.Errorf("desc of %v = %q, want %q", opt, desc[opt], wantDescs[i])
+			}
+		}
+	}
+
+	opts, desc = parseHelpOptions(stripOverstrike(manText1))
+	if len(opts) != 1 || opts[0].Short != 'v' || opts[0].Long != "verbose" ||
+		desc[opts[0]] != "explain what is being done" {
+		t.Errorf("parseHelpOptions on man text -> %v, %v", opts, desc)
+	}
+}
+
+func TestStripOverstrike(t *testing.T) {
+	if s := stripOverstrike("N\bNA\bAM\bME\bE _\bf_\bo_\bo"); s != "NAME foo" {
+		t.Errorf("stripOverstrike -> %q, want %q", s, "NAME foo")
+	}
+}
@@ -0,0 +1,71 @@
+// +build !windows,!plan9
+
+package edit
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/util"
+)
+
+func TestRunForText(t *testing.T) {
+	// The stdin is the null device, so cat exits immediately.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if text := runForText(exec.CommandContext(ctx, "cat")); text != "" {
+		t.Errorf("runForText(cat) -> %q, want empty", text)
+	}
+	if ctx.Err() != nil {
+		t.Errorf("runForText(cat) does not return before timeout")
+	}
+
+	// Commands are killed when the context is done.
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	runForText(exec.CommandContext(ctx, "sleep", "10"))
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("runForText(sleep 10) returns after %v", d)
+	}
+}
+
+func TestHelpGetoptSpecInterrupted(t *testing.T) {
+	interrupts := make(chan struct{})
+	close(interrupts)
+	name := "elvish-test-no-such-command"
+	ev := eval.NewEvaler()
+	defer ev.Close()
+	if spec := helpGetoptSpec(ev, name, interrupts); spec != nil {
+		t.Errorf("helpGetoptSpec(%q) -> %v, want nil", name, spec)
+	}
+	helpSpecsMutex.Lock()
+	_, cached := helpSpecs[name]
+	helpSpecsMutex.Unlock()
+	if cached {
+		t.Errorf("result of interrupted helpGetoptSpec is cached")
+	}
+}
+
+func TestHelpTextOnlyRunsCommandsInPath(t *testing.T) {
+	ev := eval.NewEvaler()
+	defer ev.Close()
+	util.InTempDir(func(dir string) {
+		// A script that does something when run, whatever the arguments are.
+		ioutil.WriteFile("script", []byte("#!/bin/sh\ntouch ran\n"), 0755)
+		for _, name := range []string{"./script", filepath.Join(dir, "script")} {
+			if text := helpText(context.Background(), ev, name); text != "" {
+				t.Errorf("helpText(%q) -> %q, want empty", name, text)
+			}
+		}
+		if _, err := os.Stat("ran"); err == nil {
+			t.Errorf("helpText runs commands given as paths")
+		}
+	})
+}
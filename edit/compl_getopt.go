@@ -15,13 +15,7 @@ func complGetopt(ec *eval.Frame, a []types.Value, o map[string]types.Value) {
 	eval.ScanArgs(a, &elemsv, &optsv, &argsv)
 	eval.TakeNoOpt(o)
 
-	var (
-		elems    []string
-		opts     []*getopt.Option
-		args     []eval.Fn
-		variadic bool
-	)
-	desc := make(map[*getopt.Option]string)
+	var elems []string
 	// Convert arguments.
 	elemsv.Iterate(func(v types.Value) bool {
 		elem, ok := v.(types.String)
@@ -31,6 +25,30 @@ func complGetopt(ec *eval.Frame, a []types.Value, o map[string]types.Value) {
 		elems = append(elems, string(elem))
 		return true
 	})
+	opts, desc := convertGetoptOpts(optsv)
+	args, variadic := convertArgHandlers(argsv)
+
+	spec := &getoptSpec{opts, desc, args, variadic}
+	rawCands := make(chan rawCandidate)
+	var err error
+	go func() {
+		defer close(rawCands)
+		err = spec.complete(elems, ec.Evaler, ec.Interrupts(), rawCands)
+	}()
+
+	out := ec.OutputChan()
+	for rc := range rawCands {
+		out <- rc
+	}
+	maybeThrow(err)
+}
+
+// convertGetoptOpts converts a list of maps to options and their descriptions.
+// Each map may have the following keys: short, long, desc, arg-required and
+// arg-optional.
+func convertGetoptOpts(optsv types.IteratorValue) ([]*getopt.Option, map[*getopt.Option]string) {
+	var opts []*getopt.Option
+	desc := make(map[*getopt.Option]string)
 	optsv.Iterate(func(v types.Value) bool {
 		m, ok := v.(types.MapLike)
 		if !ok {
@@ -49,6 +67,10 @@ func complGetopt(ec *eval.Frame, a []types.Value, o map[string]types.Value) {
 				panic("unreachable")
 			}
 		}
+		getBool := func(ks string) bool {
+			kv := types.String(ks)
+			return m.HasKey(kv) && types.ToBool(m.IndexOne(kv))
+		}
 
 		opt := &getopt.Option{}
 		if s, ok := get("short"); ok {
@@ -67,9 +89,26 @@ func complGetopt(ec *eval.Frame, a []types.Value, o map[string]types.Value) {
 		if s, ok := get("desc"); ok {
 			desc[opt] = s
 		}
+		switch {
+		case getBool("arg-required"):
+			opt.HasArg = getopt.RequiredArgument
+		case getBool("arg-optional"):
+			opt.HasArg = getopt.OptionalArgument
+		}
 		opts = append(opts, opt)
 		return true
 	})
+	return opts, desc
+}
+
+// convertArgHandlers converts a list of argument handlers. The list may end
+// with a "...", meaning that the last handler is used for all remaining
+// arguments.
+func convertArgHandlers(argsv types.IteratorValue) ([]eval.Fn, bool) {
+	var (
+		args     []eval.Fn
+		variadic bool
+	)
 	argsv.Iterate(func(v types.Value) bool {
 		sv, ok := v.(types.String)
 		if ok {
@@ -86,24 +125,39 @@ func complGetopt(ec *eval.Frame, a []types.Value, o map[string]types.Value) {
 		args = append(args, arg)
 		return true
 	})
+	return args, variadic
+}
+
+// getoptSpec specifies the options and arguments of a command, used for
+// completing them.
+type getoptSpec struct {
+	opts []*getopt.Option
+	// Descriptions of options, shown in the menu.
+	desc map[*getopt.Option]string
+	// Argument completers for positional arguments.
+	args []eval.Fn
+	// If true, the last argument completer is used for all remaining
+	// positional arguments.
+	variadic bool
+}
+
+// complete generates candidates for the last element of elems, which are the
+// arguments to a command, not including the command name.
+func (spec *getoptSpec) complete(elems []string, ev *eval.Evaler, interrupts <-chan struct{}, rawCands chan<- rawCandidate) error {
+	opts, desc, args, variadic := spec.opts, spec.desc, spec.args, spec.variadic
 	// TODO Configurable config
 	g := getopt.Getopt{opts, getopt.GNUGetoptLong}
 	_, parsedArgs, ctx := g.Parse(elems)
-	out := ec.OutputChan()
 
 	putShortOpt := func(opt *getopt.Option) {
-		c := &complexCandidate{stem: "-" + string(opt.Short)}
-		if d, ok := desc[opt]; ok {
-			c.displaySuffix = " (" + d + ")"
-		}
-		out <- c
+		c := &complexCandidate{stem: "-" + string(opt.Short), group: "options"}
+		c.description = desc[opt]
+		rawCands <- c
 	}
 	putLongOpt := func(opt *getopt.Option) {
-		c := &complexCandidate{stem: "--" + string(opt.Long)}
-		if d, ok := desc[opt]; ok {
-			c.displaySuffix = " (" + d + ")"
-		}
-		out <- c
+		c := &complexCandidate{stem: "--" + string(opt.Long), group: "options"}
+		c.description = desc[opt]
+		rawCands <- c
 	}
 
 	switch ctx.Type {
@@ -116,15 +170,7 @@ func complGetopt(ec *eval.Frame, a []types.Value, o map[string]types.Value) {
 			argCompl = args[len(args)-1]
 		}
 		if argCompl != nil {
-			rawCands := make(chan rawCandidate)
-			defer close(rawCands)
-			go func() {
-				for rc := range rawCands {
-					out <- rc
-				}
-			}()
-			err := callArgCompleter(argCompl, ec.Evaler, []string{ctx.Text}, rawCands)
-			maybeThrow(err)
+			return callArgCompleter(argCompl, ev, interrupts, []string{ctx.Text}, rawCands)
 		}
 		// TODO Notify that there is no suitable argument completer
 	case getopt.NewOption:
@@ -157,4 +203,5 @@ func complGetopt(ec *eval.Frame, a []types.Value, o map[string]types.Value) {
 		}
 	case getopt.OptionArgument:
 	}
+	return nil
 }
@@ -0,0 +1,246 @@
+package edit
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
+	"github.com/elves/elvish/getopt"
+	"github.com/elves/elvish/parse"
+)
+
+// Declarative completion specs for commands with subcommands, like git or
+// docker. A spec is a map with the following optional keys:
+//
+// desc: Description of the (sub)command, shown in the menu.
+//
+// opts: A list of options, in the same format as the options accepted by
+// edit:complete-getopt.
+//
+// args: A list of generators for positional arguments, each of which is one of
+// 'files', 'dirs', a list of fixed words, or an argument completer function.
+// The list may end with '...', meaning that the last generator is used for all
+// remaining arguments.
+//
+// subcommands: A map from subcommand names to their specs.
+//
+// The edit:complete-spec builtin compiles a spec into an argument completer:
+//
+//     edit:arg-completer[git] = (edit:complete-spec [
+//         &opts=[[&short=C &arg-required=$true &desc='run as if in path']]
+//         &subcommands=[
+//             &add=[&desc='add file contents' &args=[files ...]]
+//             &checkout=[&desc='switch branches' &args=[{ git branch ... }]]
+//         ]
+//     ])
+
+type cmdComplSpec struct {
+	description string
+	getoptSpec
+	subcmds map[string]*cmdComplSpec
+}
+
+var (
+	filesArgCompleter = argCompletersData[""]
+	dirsArgCompleter  = &builtinArgCompleter{"complete-dirname", complDirname}
+)
+
+func complSpecBuiltin(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+	var specv types.MapLike
+	eval.ScanArgs(args, &specv)
+	eval.TakeNoOpt(opts)
+
+	spec := convertCmdComplSpec(specv)
+	ec.OutputChan() <- &builtinArgCompleter{"complete-spec-compiled",
+		func(words []string, ev *eval.Evaler, interrupts <-chan struct{}, rawCands chan<- rawCandidate) error {
+			if len(words) < 1 {
+				return ErrTooFewArguments
+			}
+			return spec.complete(words[1:], ev, interrupts, rawCands)
+		}}
+}
+
+func convertCmdComplSpec(m types.MapLike) *cmdComplSpec {
+	spec := &cmdComplSpec{}
+	get := func(k string) (types.Value, bool) {
+		kv := types.String(k)
+		if !m.HasKey(kv) {
+			return nil, false
+		}
+		return m.IndexOne(kv), true
+	}
+
+	if v, ok := get("desc"); ok {
+		spec.description = types.ToString(v)
+	}
+	if v, ok := get("opts"); ok {
+		optsv, ok := v.(types.IteratorValue)
+		if !ok {
+			throwf("opts should be list, got %s", v.Kind())
+		}
+		spec.opts, spec.getoptSpec.desc = convertGetoptOpts(optsv)
+	}
+	if v, ok := get("args"); ok {
+		argsv, ok := v.(types.IteratorValue)
+		if !ok {
+			throwf("args should be list, got %s", v.Kind())
+		}
+		spec.args, spec.variadic = convertSpecArgs(argsv)
+	}
+	if v, ok := get("subcommands"); ok {
+		subcmdsv, ok := v.(types.MapLike)
+		if !ok {
+			throwf("subcommands should be map, got %s", v.Kind())
+		}
+		spec.subcmds = make(map[string]*cmdComplSpec)
+		subcmdsv.IteratePair(func(k, v types.Value) bool {
+			subspecv, ok := v.(types.MapLike)
+			if !ok {
+				throwf("spec of subcommand %s should be map, got %s",
+					parse.Quote(types.ToString(k)), v.Kind())
+			}
+			spec.subcmds[types.ToString(k)] = convertCmdComplSpec(subspecv)
+			return true
+		})
+	}
+	return spec
+}
+
+// convertSpecArgs converts the positional argument generators of a spec.
+func convertSpecArgs(argsv types.IteratorValue) ([]eval.Fn, bool) {
+	var (
+		args     []eval.Fn
+		variadic bool
+	)
+	argsv.Iterate(func(v types.Value) bool {
+		switch v := v.(type) {
+		case types.String:
+			switch string(v) {
+			case "...":
+				variadic = true
+			case "files":
+				args = append(args, filesArgCompleter)
+			case "dirs":
+				args = append(args, dirsArgCompleter)
+			default:
+				throwf("argument generator should be files, dirs or ..., got %s", parse.Quote(string(v)))
+			}
+		case eval.Fn:
+			args = append(args, v)
+		case types.IteratorValue:
+			var words []string
+			v.Iterate(func(w types.Value) bool {
+				words = append(words, types.ToString(w))
+				return true
+			})
+			args = append(args, fixedArgCompleter(words))
+		default:
+			throwf("argument generator should be string, list or fn, got %s", v.Kind())
+		}
+		return true
+	})
+	return args, variadic
+}
+
+func fixedArgCompleter(words []string) *builtinArgCompleter {
+	return &builtinArgCompleter{"complete-fixed",
+		func(_ []string, _ *eval.Evaler, interrupts <-chan struct{}, rawCands chan<- rawCandidate) error {
+			for _, word := range words {
+				rawCands <- plainCandidate(word)
+			}
+			return nil
+		}}
+}
+
+func complDirname(words []string, ev *eval.Evaler, interrupts <-chan struct{}, rawCands chan<- rawCandidate) error {
+	if len(words) < 1 {
+		return ErrTooFewArguments
+	}
+	files := make(chan rawCandidate)
+	var err error
+	go func() {
+		defer close(files)
+		err = complFilenameInner(words[len(words)-1], false, files)
+	}()
+	for rc := range files {
+		if c, ok := rc.(*complexCandidate); ok && c.codeSuffix != " " {
+			rawCands <- rc
+		}
+	}
+	return err
+}
+
+// complete generates candidates for the last element of elems, which are the
+// arguments to the (sub)command, not including its name.
+func (spec *cmdComplSpec) complete(elems []string, ev *eval.Evaler, interrupts <-chan struct{}, rawCands chan<- rawCandidate) error {
+	// Find the innermost subcommand that has been typed. Options before it are
+	// skipped, along with their arguments.
+	for i := 0; i < len(elems)-1; i++ {
+		elem := elems[i]
+		if elem == "--" {
+			break
+		} else if strings.HasPrefix(elem, "-") && elem != "-" {
+			if spec.optionTakesNextArg(elem) {
+				i++
+			}
+		} else if subspec, ok := spec.subcmds[elem]; ok {
+			return subspec.complete(elems[i+1:], ev, interrupts, rawCands)
+		} else {
+			// A positional argument; subcommands can no longer follow.
+			break
+		}
+	}
+
+	if len(spec.subcmds) > 0 && len(elems) > 0 && !hasPositional(spec, elems) {
+		last := elems[len(elems)-1]
+		if !strings.HasPrefix(last, "-") {
+			names := make([]string, 0, len(spec.subcmds))
+			for name := range spec.subcmds {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				rawCands <- &complexCandidate{stem: name, group: "subcommands",
+					description: spec.subcmds[name].description}
+			}
+			return nil
+		}
+	}
+	return spec.getoptSpec.complete(elems, ev, interrupts, rawCands)
+}
+
+// hasPositional returns whether there are positional arguments before the last
+// element.
+func hasPositional(spec *cmdComplSpec, elems []string) bool {
+	g := getopt.Getopt{spec.opts, getopt.GNUGetoptLong}
+	_, args, _ := g.Parse(elems)
+	return len(args) > 0
+}
+
+// optionTakesNextArg returns whether an option element, like "-o" or
+// "--output", is followed by its argument as the next element.
+func (spec *cmdComplSpec) optionTakesNextArg(elem string) bool {
+	if strings.HasPrefix(elem, "--") {
+		if strings.Contains(elem, "=") {
+			return false
+		}
+		for _, opt := range spec.opts {
+			if opt.Long == elem[2:] {
+				return opt.HasArg == getopt.RequiredArgument
+			}
+		}
+		return false
+	}
+	// A chain of short options; only the last one can take the next element
+	// as its argument.
+	for i, r := range elem[1:] {
+		for _, opt := range spec.opts {
+			if opt.Short == r && opt.HasArg == getopt.RequiredArgument {
+				return i+utf8.RuneLen(r) == len(elem)-1
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package edit
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
+)
+
+var testCmdComplSpecCode = `
+spec = [
+    &opts=[[&short=C &arg-required=$true] [&long=verbose]]
+    &subcommands=[
+        &add=[&desc='add files' &args=[[a1 a2] ...]
+              &opts=[[&long=force &desc='force it']]]
+        &remote=[&subcommands=[&show=[&] &prune=[&]]]
+    ]
+]
+`
+
+var (
+	cmdComplSpecTests = []struct {
+		elems []string
+		want  []string
+	}{
+		{[]string{""}, []string{"add (add files)", "remote"}},
+		{[]string{"--verbose", "-C", "dir", ""}, []string{"add (add files)", "remote"}},
+		{[]string{"-"}, []string{"-C", "--verbose"}},
+		{[]string{"add", ""}, []string{"a1", "a2"}},
+		{[]string{"add", "x", "y", ""}, []string{"a1", "a2"}},
+		{[]string{"add", "--"}, []string{"--force (force it)"}},
+		{[]string{"remote", ""}, []string{"prune", "show"}},
+		{[]string{"-C", "remote", ""}, []string{"add (add files)", "remote"}},
+	}
+)
+
+func TestCmdComplSpec(t *testing.T) {
+	ev := eval.NewEvaler()
+	err := ev.SourceText(eval.NewScriptSource("[test]", "[test]", testCmdComplSpecCode))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := convertCmdComplSpec(ev.Global["spec"].Get().(types.MapLike))
+
+	for _, test := range cmdComplSpecTests {
+		rawCands := make(chan rawCandidate)
+		go func() {
+			defer close(rawCands)
+			spec.complete(test.elems, nil, nil, rawCands)
+		}()
+		var got []string
+		for rc := range rawCands {
+			c := rc.cook(0)
+			text := c.menu.Text
+			if c.description != "" {
+				text += " (" + c.description + ")"
+			}
+			got = append(got, text)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("complete(%q) -> %q, want %q", test.elems, got, test.want)
+		}
+	}
+}
@@ -57,7 +57,7 @@ func findCommandComplContext(n parse.Node, ev pureEvaler) complContext {
 
 func (*commandComplContext) name() string { return "command" }
 
-func (ctx *commandComplContext) generate(ev *eval.Evaler, ch chan<- rawCandidate) error {
+func (ctx *commandComplContext) generate(ev *eval.Evaler, interrupts <-chan struct{}, ch chan<- rawCandidate) error {
 	return complFormHeadInner(ctx.seed, ev, ch)
 }
 
@@ -79,7 +79,7 @@ func complFormHeadInner(head string, ev *eval.Evaler, rawCands chan<- rawCandida
 				got(eval.MakeVariableName(false, ns, varname[:len(varname)-len(eval.FnSuffix)]))
 			} else {
 				name := eval.MakeVariableName(false, ns, varname)
-				rawCands <- &complexCandidate{name, " = ", " = ", ui.Styles{}}
+				rawCands <- &complexCandidate{name, " = ", " = ", ui.Styles{}, "", ""}
 			}
 		})
 	}
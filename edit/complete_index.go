@@ -6,6 +6,7 @@ import (
 	"github.com/elves/elvish/eval"
 	"github.com/elves/elvish/eval/types"
 	"github.com/elves/elvish/parse"
+	"github.com/elves/elvish/util"
 )
 
 var errCannotIterateKey = errors.New("indexee does not support iterating keys")
@@ -19,20 +20,19 @@ func (*indexComplContext) name() string { return "index" }
 
 // Find context information for complIndex.
 //
-// Right now we only support cases where there is only one level of indexing,
-// e.g. $a[<Tab> is supported but $a[x][<Tab> is not.
+// Indexing may be nested, e.g. $a[x][<Tab>; the indexee is then found by
+// indexing the head with all the preceding indicies, as long as all of them can
+// be evaluated statically.
 func findIndexComplContext(n parse.Node, ev pureEvaler) complContext {
 	if parse.IsSep(n) {
 		if parse.IsIndexing(n.Parent()) {
 			// We are just after an opening bracket.
 			indexing := parse.GetIndexing(n.Parent())
-			if len(indexing.Indicies) == 1 {
-				if indexee := ev.PurelyEvalPrimary(indexing.Head); indexee != nil {
-					return &indexComplContext{
-						complContextCommon{
-							"", quotingForEmptySeed, n.End(), n.End()},
-						indexee,
-					}
+			if indexee := purelyEvalIndexee(indexing, ev); indexee != nil {
+				return &indexComplContext{
+					complContextCommon{
+						"", quotingForEmptySeed, n.End(), n.End()},
+					indexee,
 				}
 			}
 		}
@@ -41,13 +41,11 @@ func findIndexComplContext(n parse.Node, ev pureEvaler) complContext {
 			if parse.IsIndexing(array.Parent()) {
 				// We are after an existing index and spaces.
 				indexing := parse.GetIndexing(array.Parent())
-				if len(indexing.Indicies) == 1 {
-					if indexee := ev.PurelyEvalPrimary(indexing.Head); indexee != nil {
-						return &indexComplContext{
-							complContextCommon{
-								"", quotingForEmptySeed, n.End(), n.End()},
-							indexee,
-						}
+				if indexee := purelyEvalIndexee(indexing, ev); indexee != nil {
+					return &indexComplContext{
+						complContextCommon{
+							"", quotingForEmptySeed, n.End(), n.End()},
+						indexee,
 					}
 				}
 			}
@@ -63,13 +61,11 @@ func findIndexComplContext(n parse.Node, ev pureEvaler) complContext {
 				if parse.IsIndexing(array.Parent()) {
 					// We are just after an incomplete index.
 					indexing := parse.GetIndexing(array.Parent())
-					if len(indexing.Indicies) == 1 {
-						if indexee := ev.PurelyEvalPrimary(indexing.Head); indexee != nil {
-							return &indexComplContext{
-								complContextCommon{
-									seed, primary.Type, compound.Begin(), compound.End()},
-								indexee,
-							}
+					if indexee := purelyEvalIndexee(indexing, ev); indexee != nil {
+						return &indexComplContext{
+							complContextCommon{
+								seed, primary.Type, compound.Begin(), compound.End()},
+							indexee,
 						}
 					}
 				}
@@ -80,7 +76,37 @@ func findIndexComplContext(n parse.Node, ev pureEvaler) complContext {
 	return nil
 }
 
-func (ctx *indexComplContext) generate(ev *eval.Evaler, ch chan<- rawCandidate) error {
+// purelyEvalIndexee evaluates the value that the last index of an indexing
+// node applies to, without causing any side effects. It returns nil if this
+// cannot be done.
+func purelyEvalIndexee(indexing *parse.Indexing, ev pureEvaler) types.Value {
+	if len(indexing.Indicies) == 0 {
+		return nil
+	}
+	indexee := ev.PurelyEvalPrimary(indexing.Head)
+	for _, index := range indexing.Indicies[:len(indexing.Indicies)-1] {
+		if indexee == nil || len(index.Compounds) != 1 {
+			return nil
+		}
+		key, err := ev.PurelyEvalCompound(index.Compounds[0])
+		if err != nil {
+			return nil
+		}
+		indexer, ok := types.GetIndexer(indexee)
+		if !ok {
+			return nil
+		}
+		err = util.PCall(func() {
+			indexee = indexer.Index([]types.Value{types.String(key)})[0]
+		})
+		if err != nil {
+			return nil
+		}
+	}
+	return indexee
+}
+
+func (ctx *indexComplContext) generate(ev *eval.Evaler, interrupts <-chan struct{}, ch chan<- rawCandidate) error {
 	m, ok := ctx.indexee.(types.IterateKeyer)
 	if !ok {
 		return errCannotIterateKey
@@ -0,0 +1,91 @@
+package edit
+
+import (
+	"errors"
+
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/parse"
+)
+
+var errNoOptions = errors.New("function has no known options")
+
+type optionComplContext struct {
+	complContextCommon
+	fn eval.Fn
+}
+
+func (*optionComplContext) name() string { return "option" }
+
+// Find context information for complOption.
+//
+// Options are completed after "&" in a form whose head can be resolved to a
+// function statically, e.g. echo &<Tab> or $f &s<Tab>. The option names come
+// from the function: closures keep the names of their options, and builtin
+// functions declare them with eval.AddBuiltinOptNames.
+func findOptionComplContext(n parse.Node, ev pureEvaler) complContext {
+	if parse.IsSep(n) && parse.IsPipeline(n.Parent()) {
+		// A lone "&" after a form is parsed as the background indicator of
+		// the pipeline.
+		pipeline := parse.GetPipeline(n.Parent())
+		if pipeline.Background && len(pipeline.Forms) > 0 && n.End() == pipeline.End() {
+			form := pipeline.Forms[len(pipeline.Forms)-1]
+			if fn := formHeadFn(form, ev); fn != nil {
+				return &optionComplContext{
+					complContextCommon{"", quotingForEmptySeed, n.End(), n.End()},
+					fn,
+				}
+			}
+		}
+	}
+
+	if primary, ok := n.(*parse.Primary); ok {
+		compound, seed := primaryInSimpleCompound(primary, ev)
+		if compound != nil && parse.IsMapPair(compound.Parent()) {
+			mapPair := parse.GetMapPair(compound.Parent())
+			if mapPair.Key == compound && parse.IsForm(mapPair.Parent()) {
+				form := parse.GetForm(mapPair.Parent())
+				if fn := formHeadFn(form, ev); fn != nil {
+					return &optionComplContext{
+						complContextCommon{
+							seed, primary.Type, compound.Begin(), compound.End()},
+						fn,
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// formHeadFn resolves the head of a form to a function without causing any
+// side effects. It returns nil if this cannot be done.
+func formHeadFn(form *parse.Form, ev pureEvaler) eval.Fn {
+	head := form.Head
+	if head == nil {
+		return nil
+	}
+	if len(head.Indexings) == 1 {
+		indexing := head.Indexings[0]
+		if len(indexing.Indicies) == 0 && indexing.Head.Type == parse.Variable {
+			fn, _ := ev.PurelyEvalPrimary(indexing.Head).(eval.Fn)
+			return fn
+		}
+	}
+	name, err := ev.PurelyEvalCompound(head)
+	if err != nil {
+		return nil
+	}
+	return ev.PurelyResolveFn(name)
+}
+
+func (ctx *optionComplContext) generate(ev *eval.Evaler, interrupts <-chan struct{}, ch chan<- rawCandidate) error {
+	optNames := eval.FnOptNames(ctx.fn)
+	if len(optNames) == 0 {
+		return errNoOptions
+	}
+	for _, name := range optNames {
+		ch <- plainCandidate(name)
+	}
+	return nil
+}
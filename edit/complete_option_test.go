@@ -0,0 +1,58 @@
+package edit
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/parse"
+)
+
+func TestFindOptionComplContext(t *testing.T) {
+	echo := eval.NewEvaler().PurelyResolveFn("echo")
+	testComplContextFinder(t, "findOptionComplContext", findOptionComplContext, []complContextFinderTest{
+		{"echo &", &optionComplContext{
+			complContextCommon{"", quotingForEmptySeed, 6, 6}, echo}},
+		{"echo a &se", &optionComplContext{
+			complContextCommon{"se", parse.Bareword, 8, 10}, echo}},
+		// Not supported when the head cannot be resolved statically
+		{"(x) &se", nil},
+		{"no-such-command &se", nil},
+		// Not the key of an option
+		{"echo &sep=x", nil},
+	})
+}
+
+func TestOptionComplContextGenerate(t *testing.T) {
+	ev := eval.NewEvaler()
+	defer ev.Close()
+	tests := []struct {
+		fn   eval.Fn
+		want []string
+	}{
+		{ev.PurelyResolveFn("echo"), []string{"sep"}},
+		{ev.PurelyResolveFn("range"), []string{"step"}},
+		{&eval.Closure{OptNames: []string{"foo", "bar"}}, []string{"foo", "bar"}},
+		{ev.PurelyResolveFn("put"), nil},
+	}
+	for _, test := range tests {
+		ctx := &optionComplContext{fn: test.fn}
+		ch := make(chan rawCandidate)
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- ctx.generate(ev, nil, ch)
+			close(ch)
+		}()
+		var got []string
+		for c := range ch {
+			got = append(got, c.text())
+		}
+		err := <-errCh
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("generate for %v -> %v, want %v", test.fn, got, test.want)
+		}
+		if (err == nil) != (test.want != nil) {
+			t.Errorf("generate for %v -> error %v", test.fn, err)
+		}
+	}
+}
@@ -32,16 +32,18 @@ package edit
 // details.
 
 import (
+	"math"
+	"sort"
+
 	"github.com/elves/elvish/eval"
 	"github.com/elves/elvish/eval/types"
 	"github.com/elves/elvish/parse"
-	"github.com/elves/elvish/util"
 )
 
 type complContext interface {
 	name() string
 	common() *complContextCommon
-	generate(*eval.Evaler, chan<- rawCandidate) error
+	generate(*eval.Evaler, <-chan struct{}, chan<- rawCandidate) error
 }
 
 type complContextCommon struct {
@@ -69,50 +71,97 @@ type pureEvaler interface {
 	PurelyEvalCompound(*parse.Compound) (string, error)
 	PurelyEvalPartialCompound(cn *parse.Compound, upto *parse.Indexing) (string, error)
 	PurelyEvalPrimary(*parse.Primary) types.Value
+	PurelyResolveFn(string) eval.Fn
 }
 
 var complContextFinders = []complContextFinder{
 	findVariableComplContext,
 	findCommandComplContext,
 	findIndexComplContext,
+	findOptionComplContext,
 	findRedirComplContext,
 	findArgComplContext,
 }
 
-// complete takes a Node and Evaler and tries all complContexts. It returns the
-// name of the complContext, and the result and error it gave. If no complContext is
-// available, it returns an empty complContext name.
-func complete(n parse.Node, ev *eval.Evaler) (string, *complSpec, error) {
-	ed := ev.Editor.(*Editor)
+// findComplContext tries all complContextFinders, and returns the first
+// complContext found, or nil if none applies.
+func findComplContext(n parse.Node, ev pureEvaler) complContext {
 	for _, finder := range complContextFinders {
-		ctx := finder(n, ev)
-		if ctx == nil {
-			continue
+		if ctx := finder(n, ev); ctx != nil {
+			return ctx
 		}
-		name := ctx.name()
-		ctxCommon := ctx.common()
+	}
+	return nil
+}
+
+// complEntry is a cooked candidate, along with what is needed to sort it.
+type complEntry struct {
+	text  string // Text of the raw candidate.
+	score int    // Score of fuzzily matching the seed.
+	cand  *candidate
+}
+
+type complEntries []complEntry
+
+func (es complEntries) Len() int      { return len(es) }
+func (es complEntries) Swap(i, j int) { es[i], es[j] = es[j], es[i] }
+func (es complEntries) Less(i, j int) bool {
+	if es[i].score != es[j].score {
+		return es[i].score > es[j].score
+	}
+	return es[i].text < es[j].text
+}
 
-		matcher, ok := ed.lookupMatcher(name)
+// cookRawCandidates cooks raw candidates, and scores them by how well their
+// menu texts fuzzily match the seed, recording the matched positions for
+// highlighting. Candidates that the matcher accepted but do not fuzzily match
+// the seed get the lowest score.
+func cookRawCandidates(rawCands []rawCandidate, q parse.PrimaryType, seed string) []complEntry {
+	ignoreCase := smartCase(seed)
+	entries := make([]complEntry, len(rawCands))
+	var fm fuzzyMatcher
+	for i, raw := range rawCands {
+		cand := raw.cook(q)
+		score, matched, ok := fm.match(cand.menu.Text, seed, ignoreCase)
 		if !ok {
-			return name, nil, errMatcherMustBeFn
+			score = math.MinInt32
 		}
+		cand.matched = matched
+		entries[i] = complEntry{raw.text(), score, cand}
+	}
+	return entries
+}
 
-		chanRawCandidate := make(chan rawCandidate)
-		chanErrGenerate := make(chan error)
-		go func() {
-			err := ctx.generate(ev, chanRawCandidate)
-			close(chanRawCandidate)
-			chanErrGenerate <- err
-		}()
-
-		rawCandidates, errFilter := filterRawCandidates(ev, matcher, ctxCommon.seed, chanRawCandidate)
-		candidates := make([]*candidate, len(rawCandidates))
-		for i, raw := range rawCandidates {
-			candidates[i] = raw.cook(ctxCommon.quoting)
-		}
-		spec := &complSpec{ctxCommon.begin, ctxCommon.end, candidates}
-		return name, spec, util.Errors(<-chanErrGenerate, errFilter)
+// sortedCandidates returns the candidates of the entries, sorted by their
+// scores, and then alphabetically, and then grouped. The entries are not
+// modified.
+func sortedCandidates(entries []complEntry) []*candidate {
+	sorted := make(complEntries, len(entries))
+	copy(sorted, entries)
+	sort.Stable(sorted)
+	candidates := make([]*candidate, len(sorted))
+	for i, entry := range sorted {
+		candidates[i] = entry.cand
+	}
+	groupCandidates(candidates, func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	return candidates
+}
 
+// groupCandidates stably sorts candidates so that candidates in the same group
+// are adjacent, with groups ordered by their first appearances. The swap
+// function should swap candidates i and j, along with any parallel data.
+func groupCandidates(candidates []*candidate, swap func(i, j int)) {
+	order := make(map[string]int)
+	keys := make([]int, len(candidates))
+	for i, cand := range candidates {
+		if _, ok := order[cand.group]; !ok {
+			order[cand.group] = len(order)
+		}
+		keys[i] = -order[cand.group]
+	}
+	if len(order) > 1 {
+		rankByScores(keys, swap)
 	}
-	return "", nil, nil
 }
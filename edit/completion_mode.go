@@ -2,7 +2,7 @@ package edit
 
 import (
 	"fmt"
-	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/elves/elvish/edit/ui"
@@ -33,9 +33,13 @@ type completion struct {
 	complSpec
 	completer string
 
+	// Whether candidates are still being generated.
+	loading bool
+
 	filtering       bool
 	filter          string
 	filtered        []*candidate
+	filterMatched   [][]int
 	selected        int
 	firstShown      int
 	lastShownInFull int
@@ -51,7 +55,11 @@ func (c *completion) needScrollbar() bool {
 }
 
 func (c *completion) ModeLine() ui.Renderer {
-	ml := modeLineRenderer{fmt.Sprintf(" COMPLETING %s ", c.completer), c.filter}
+	title := fmt.Sprintf(" COMPLETING %s ", c.completer)
+	if c.loading {
+		title += "(loading) "
+	}
+	ml := modeLineRenderer{title, c.filter}
 	if !c.needScrollbar() {
 		return ml
 	}
@@ -175,52 +183,84 @@ func startCompletionInner(ed *Editor, acceptPrefix bool) {
 		return
 	}
 
-	completer, complSpec, err := complete(node, ed.evaler)
-
-	if err != nil {
-		ed.addTip("%v", err)
-		// We don't show the full stack trace. To make debugging still possible,
-		// we log it.
-		if pprinter, ok := err.(util.Pprinter); ok {
-			logger.Println("matcher error:")
-			logger.Println(pprinter.Pprint(""))
-		}
-	} else if completer == "" {
+	ctx := findComplContext(node, ed.evaler)
+	if ctx == nil {
 		ed.addTip("unsupported completion :(")
 		logger.Println("path to current leaf, leaf first")
 		for n := node; n != nil; n = n.Parent() {
 			logger.Printf("%T (%d-%d)", n, n.Begin(), n.End())
 		}
-	} else if len(complSpec.candidates) == 0 {
-		ed.addTip("no candidate for %s", completer)
-	} else {
-		if acceptPrefix {
-			// If there is a non-empty longest common prefix, insert it and
-			// don't start completion mode.
-			//
-			// As a special case, when there is exactly one candidate, it is
-			// immeidately accepted.
-			prefix := complSpec.candidates[0].code
-			for _, cand := range complSpec.candidates[1:] {
-				prefix = commonPrefix(prefix, cand.code)
-				if prefix == "" {
-					break
-				}
-			}
+		return
+	}
+	matcher, ok := ed.lookupMatcher(ctx.name())
+	if !ok {
+		ed.addTip("%v", errMatcherMustBeFn)
+		return
+	}
 
-			if prefix != "" && len(prefix) > complSpec.end-complSpec.begin {
-				ed.buffer = ed.buffer[:complSpec.begin] + prefix + ed.buffer[complSpec.end:]
-				ed.dot = complSpec.begin + len(prefix)
+	job := ed.startComplJob(ctx, matcher)
+	ed.completion = completion{
+		completer: job.completer,
+		complSpec: complSpec{job.begin, job.end, nil},
+		loading:   true,
+	}
 
+	// Wait for the candidates for a while. If they are not all ready by then,
+	// start the completion mode and let the main loop receive the rest.
+	timeout := time.After(complMaxWait)
+	for {
+		select {
+		case u := <-job.updates:
+			ed.receiveCompl(u)
+			if !u.done {
+				continue
+			}
+			if len(ed.completion.candidates) == 0 {
+				return
+			}
+			if acceptPrefix && acceptCommonPrefix(ed) {
 				return
 			}
+			ed.mode = &ed.completion
+			return
+		case <-timeout:
+			ed.mode = &ed.completion
+			return
 		}
-		ed.completion = completion{
-			completer: completer,
-			complSpec: *complSpec,
-			filtered:  complSpec.candidates,
+	}
+}
+
+// acceptCommonPrefix inserts the longest common prefix of all candidates, if it
+// is longer than the text being completed. It returns whether the prefix was
+// inserted.
+//
+// As a special case, when there is exactly one candidate, it is immediately
+// accepted.
+func acceptCommonPrefix(ed *Editor) bool {
+	c := &ed.completion
+	prefix := c.candidates[0].code
+	for _, cand := range c.candidates[1:] {
+		prefix = commonPrefix(prefix, cand.code)
+		if prefix == "" {
+			break
 		}
-		ed.mode = &ed.completion
+	}
+
+	if prefix != "" && len(prefix) > c.end-c.begin {
+		ed.buffer = ed.buffer[:c.begin] + prefix + ed.buffer[c.end:]
+		ed.dot = c.begin + len(prefix)
+		return true
+	}
+	return false
+}
+
+func (ed *Editor) addComplErrorTip(err error) {
+	ed.addTip("%v", err)
+	// We don't show the full stack trace. To make debugging still possible,
+	// we log it.
+	if pprinter, ok := err.(util.Pprinter); ok {
+		logger.Println("matcher error:")
+		logger.Println(pprinter.Pprint(""))
 	}
 }
 
@@ -265,7 +305,11 @@ func (c *completion) ListRender(width, maxHeight int) *ui.Buffer {
 	b := ui.NewBuffer(width)
 	cands := c.filtered
 	if len(cands) == 0 {
-		b.WriteString(util.TrimWcwidth("(no result)", width), "")
+		if c.loading {
+			b.WriteString(util.TrimWcwidth("(loading)", width), "")
+		} else {
+			b.WriteString(util.TrimWcwidth("(no result)", width), "")
+		}
 		return b
 	}
 	if maxHeight <= 1 || width <= 2 {
@@ -276,6 +320,10 @@ func (c *completion) ListRender(width, maxHeight int) *ui.Buffer {
 	// Reserve the the rightmost row as margins.
 	width--
 
+	if c.hasDetails() {
+		return c.listRenderDetailed(b, width, maxHeight)
+	}
+
 	// Determine comp.height and comp.firstShown.
 	// First determine whether all candidates can be fit in the screen,
 	// assuming that they are all of maximum width. If that is the case, we use
@@ -334,7 +382,11 @@ func (c *completion) ListRender(width, maxHeight int) *ui.Buffer {
 				if j == c.selected {
 					s = append(s, styleForSelectedCompletion.String())
 				}
-				col.WriteString(util.ForceWcwidth(cands[j].menu.Text, colWidth), s.String())
+				matched := cands[j].matched
+				if c.filter != "" {
+					matched = c.filterMatched[j]
+				}
+				writeHighlighted(col, util.ForceWcwidth(cands[j].menu.Text, colWidth), s, matched)
 				col.WriteSpaces(completionColMarginRight, styleForCompletion.String())
 				if !trimmed {
 					c.lastShownInFull = j
@@ -363,18 +415,162 @@ func (c *completion) ListRender(width, maxHeight int) *ui.Buffer {
 	return b
 }
 
+// hasDetails returns whether any of the candidates has a description or a
+// group, in which case candidates are shown one per line.
+func (c *completion) hasDetails() bool {
+	for _, cand := range c.candidates {
+		if cand.description != "" || cand.group != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// complRow is a row in the detailed completion listing, either the heading of
+// a group or a candidate.
+type complRow struct {
+	group string
+	index int // Index of the candidate, or -1 for group headings.
+}
+
+// listRenderDetailed renders the candidates one per line, with their
+// descriptions in a second column, under the headings of their groups.
+func (c *completion) listRenderDetailed(b *ui.Buffer, width, maxHeight int) *ui.Buffer {
+	cands := c.filtered
+	var rows []complRow
+	selectedRow, firstRow := 0, 0
+	for i, cand := range cands {
+		if cand.group != "" && (i == 0 || cands[i-1].group != cand.group) {
+			rows = append(rows, complRow{cand.group, -1})
+		}
+		if i == c.selected {
+			selectedRow = len(rows)
+		}
+		if i == c.firstShown {
+			firstRow = len(rows)
+		}
+		rows = append(rows, complRow{"", i})
+	}
+	// Show the heading along with the first candidate of a group.
+	if selectedRow > 0 && rows[selectedRow-1].index == -1 {
+		selectedRow--
+	}
+	if firstRow > 0 && rows[firstRow-1].index == -1 {
+		firstRow--
+	}
+
+	// Scroll the minimal amount to keep the selected candidate visible.
+	height := min(maxHeight, len(rows))
+	if selectedRow < firstRow {
+		firstRow = selectedRow
+	} else if selectedRow >= firstRow+height {
+		firstRow = selectedRow - height + 1
+	}
+	if firstRow+height > len(rows) {
+		firstRow = len(rows) - height
+	}
+	shown := rows[firstRow : firstRow+height]
+
+	labelWidth, descWidth := 0, 0
+	for _, row := range rows {
+		if row.index >= 0 {
+			labelWidth = max(labelWidth, util.Wcswidth(cands[row.index].menu.Text))
+			descWidth = max(descWidth, util.Wcswidth(cands[row.index].description))
+		}
+	}
+	const gap = 2
+	contentWidth := width - completionColMarginTotal
+	if descWidth > 0 {
+		// Give the description column at least a third of the width.
+		labelWidth = min(labelWidth, contentWidth-max(contentWidth/3, 1)-gap)
+	}
+	labelWidth = max(min(labelWidth, contentWidth), 1)
+	if descWidth > 0 {
+		descWidth = contentWidth - labelWidth - gap
+	}
+
+	c.height = height
+	c.firstShown, c.lastShownInFull = len(cands), -1
+	for i, row := range shown {
+		if i > 0 {
+			b.Newline()
+		}
+		if row.index == -1 {
+			b.WriteSpaces(completionColMarginLeft, styleForCompletion.String())
+			b.WriteString(util.ForceWcwidth(row.group, width-completionColMarginLeft),
+				ui.JoinStyles(styleForCompletion, styleForCompletionGroup).String())
+			continue
+		}
+		j := row.index
+		c.firstShown = min(c.firstShown, j)
+		c.lastShownInFull = max(c.lastShownInFull, j)
+
+		s := ui.JoinStyles(styleForCompletion, cands[j].menu.Styles)
+		sDesc := ui.JoinStyles(styleForCompletion, styleForCompletionDescription)
+		sMargin := styleForCompletion
+		if j == c.selected {
+			s = append(s, styleForSelectedCompletion.String())
+			sDesc = append(sDesc, styleForSelectedCompletion.String())
+			sMargin = ui.JoinStyles(sMargin, styleForSelectedCompletion)
+		}
+		matched := cands[j].matched
+		if c.filter != "" {
+			matched = c.filterMatched[j]
+		}
+		b.WriteSpaces(completionColMarginLeft, sMargin.String())
+		writeHighlighted(b, util.ForceWcwidth(cands[j].menu.Text, labelWidth), s, matched)
+		if descWidth > 0 {
+			b.WriteSpaces(gap, sMargin.String())
+			b.WriteString(util.ForceWcwidth(cands[j].description, descWidth), sDesc.String())
+		}
+		b.WriteSpaces(completionColMarginRight, sMargin.String())
+	}
+	return b
+}
+
+// setCandidates replaces the candidates, keeping the filter and, if possible,
+// the selected candidate.
+func (c *completion) setCandidates(cands []*candidate) {
+	var selected *candidate
+	if 0 <= c.selected && c.selected < len(c.filtered) {
+		selected = c.filtered[c.selected]
+	}
+	c.candidates = cands
+	c.changeFilter(c.filter)
+	for i, cand := range c.filtered {
+		if cand == selected {
+			c.selected = i
+			break
+		}
+	}
+	if c.selected == -1 && len(c.filtered) > 0 {
+		c.selected = 0
+	}
+}
+
 func (c *completion) changeFilter(f string) {
 	c.filter = f
 	if f == "" {
 		c.filtered = c.candidates
 		return
 	}
-	c.filtered = nil
+	c.filtered, c.filterMatched = nil, nil
+	var scores []int
+	ignoreCase := smartCase(f)
+	var fm fuzzyMatcher
 	for _, cand := range c.candidates {
-		if strings.Contains(cand.menu.Text, f) {
+		if score, matched, ok := fm.match(cand.menu.Text, f, ignoreCase); ok {
 			c.filtered = append(c.filtered, cand)
+			c.filterMatched = append(c.filterMatched, matched)
+			scores = append(scores, score)
 		}
 	}
+	swap := func(i, j int) {
+		c.filtered[i], c.filtered[j] = c.filtered[j], c.filtered[i]
+		c.filterMatched[i], c.filterMatched[j] = c.filterMatched[j], c.filterMatched[i]
+	}
+	rankByScores(scores, swap)
+	groupCandidates(c.filtered, swap)
 	if len(c.filtered) > 0 {
 		c.selected = 0
 	} else {
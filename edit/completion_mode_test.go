@@ -0,0 +1,69 @@
+package edit
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/elves/elvish/edit/ui"
+)
+
+func bufferText(b *ui.Buffer) []string {
+	var lines []string
+	for _, line := range b.Lines {
+		s := ""
+		for _, cell := range line {
+			s += cell.Text
+		}
+		lines = append(lines, s)
+	}
+	return lines
+}
+
+func TestCompletionListRenderDetailed(t *testing.T) {
+	cands := []*candidate{
+		{code: "-a", menu: ui.Unstyled("-a"), description: "all", group: "options"},
+		{code: "--long", menu: ui.Unstyled("--long"), group: "options"},
+		{code: "add", menu: ui.Unstyled("add"), description: "add files", group: "subcommands"},
+		{code: "rm", menu: ui.Unstyled("rm"), description: "remove files", group: "subcommands"},
+	}
+	c := &completion{complSpec: complSpec{candidates: cands}, filtered: cands}
+
+	got := bufferText(c.ListRender(21, 10))
+	want := []string{
+		" options            ",
+		" -a      all        ",
+		" --long             ",
+		" subcommands        ",
+		" add     add files  ",
+		" rm      remove fil ",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListRender ->\n%q\nwant\n%q", got, want)
+	}
+
+	// When the height is not enough, the listing scrolls to show the selected
+	// candidate.
+	c.selected = 3
+	got = bufferText(c.ListRender(21, 3))
+	if !reflect.DeepEqual(got, want[3:]) {
+		t.Errorf("ListRender ->\n%q\nwant\n%q", got, want[3:])
+	}
+	if c.firstShown != 2 || c.lastShownInFull != 3 {
+		t.Errorf("shown candidates are %d to %d, want 2 to 3",
+			c.firstShown, c.lastShownInFull)
+	}
+}
+
+func TestGroupCandidates(t *testing.T) {
+	cands := []*candidate{
+		{code: "a", group: "x"}, {code: "b", group: "y"}, {code: "c", group: "x"},
+	}
+	groupCandidates(cands, func(i, j int) { cands[i], cands[j] = cands[j], cands[i] })
+	var got []string
+	for _, cand := range cands {
+		got = append(got, cand.code)
+	}
+	if want := []string{"a", "c", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("grouped %v, want %v", got, want)
+	}
+}
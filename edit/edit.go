@@ -45,6 +45,17 @@ type Editor struct {
 
 	historyFuser *history.Fuser
 	historyMutex sync.RWMutex
+	// The sequence number of the last command added to the history, or 0 if
+	// there is none. Its result is recorded when it finishes. Guarded by
+	// historyMutex.
+	lastCmdSeq int
+	// The host name and session ID recorded with each command.
+	hostname string
+	session  string
+
+	// cutBuffer keeps the text last killed or copied from the region. It
+	// survives across ReadLine calls.
+	cutBuffer string
 
 	// notifyPort is a write-only port that turns data written to it into editor
 	// notifications.
@@ -52,6 +63,20 @@ type Editor struct {
 	// notifyRead is the read end of notifyPort.File.
 	notifyRead *os.File
 
+	// Updaters of the prompt and rprompt. They live across ReadLine calls, so
+	// that the last prompts can be reused while new ones are being evaluated.
+	promptUpdater  *prompt.Updater
+	rpromptUpdater *prompt.Updater
+	// promptRefresh receives requests to re-evaluate the prompts.
+	promptRefresh chan struct{}
+
+	// The running completion job, the cache of candidates of slow completions
+	// and the working directory the cache is for. They are only accessed from
+	// the main goroutine.
+	complJob      *complJob
+	complCache    map[string][]complEntry
+	complCacheDir string
+
 	editorState
 }
 
@@ -66,6 +91,11 @@ type editorState struct {
 
 	buffer string
 	dot    int
+	// The other end of the region, only meaningful when hasMark is true.
+	mark    int
+	hasMark bool
+	// Whether the mark was set by a select-* builtin.
+	markShifted bool
 
 	chunk           *parse.Chunk
 	styling         *highlight.Styling
@@ -105,6 +135,12 @@ func NewEditor(in *os.File, out *os.File, sigs chan os.Signal, ev *eval.Evaler)
 
 		bindings:  makeBindings(),
 		variables: makeVariables(),
+
+		promptUpdater:  prompt.NewUpdater(prompt.Prompt),
+		rpromptUpdater: prompt.NewUpdater(prompt.Rprompt),
+		promptRefresh:  make(chan struct{}, 1),
+
+		complCache: make(map[string][]complEntry),
 	}
 
 	notifyChan := make(chan types.Value)
@@ -141,6 +177,8 @@ func NewEditor(in *os.File, out *os.File, sigs chan os.Signal, ev *eval.Evaler)
 			fmt.Fprintln(os.Stderr, "Failed to initialize command history. Disabled.")
 		} else {
 			ed.historyFuser = f
+			ed.hostname, _ = os.Hostname()
+			ed.session = fmt.Sprintf("%d@%d", os.Getpid(), time.Now().Unix())
 		}
 	}
 	ev.Editor = ed
@@ -274,16 +312,23 @@ func (ed *Editor) startReadLine() error {
 }
 
 // finishReadLine puts the terminal in a state suitable for other programs to
-// use.
-func (ed *Editor) finishReadLine() error {
+// use. The after-readline hooks are called if callHooks is true.
+func (ed *Editor) finishReadLine(callAfterHooks bool) error {
 	ed.activeMutex.Lock()
 	defer ed.activeMutex.Unlock()
 	ed.active = false
 
+	ed.cancelComplJob()
+
 	// Refresh the terminal for the last time in a clean-ish state.
 	ed.mode = &ed.insert
 	ed.tips = nil
 	ed.dot = len(ed.buffer)
+	// The region is not highlighted in the accepted line.
+	ed.hasMark = false
+	if content, ok := prompt.TransientContent(ed); ok {
+		ed.promptContent = content
+	}
 	if !prompt.RpromptPersistent(ed) {
 		ed.rpromptContent = nil
 	}
@@ -300,25 +345,34 @@ func (ed *Editor) finishReadLine() error {
 	line := ed.buffer
 	ed.editorState = editorState{}
 
-	callHooks(ed.evaler, ed.afterReadLine(), types.String(line))
+	if callAfterHooks {
+		callHooks(ed.evaler, ed.afterReadLine(), types.String(line))
+	}
 
 	return util.Errors(errRefresh, errRestore)
 }
 
 // ReadLine reads a line interactively.
 func (ed *Editor) ReadLine() (string, error) {
+	return ed.readLine(&ed.insert, false)
+}
+
+// readLine runs the editor, starting in the given mode. If modal is true, the
+// editor returns as soon as it leaves the mode, and the readline hooks are not
+// called; this is used for running a single mode, like in edit:pick.
+func (ed *Editor) readLine(mode Mode, modal bool) (string, error) {
 	err := ed.startReadLine()
 	if err != nil {
 		return "", err
 	}
 	defer func() {
-		err := ed.finishReadLine()
+		err := ed.finishReadLine(!modal)
 		if err != nil {
 			fmt.Fprintln(ed.out, "error:", err)
 		}
 	}()
 
-	ed.mode = &ed.insert
+	ed.mode = mode
 
 	// Find external commands asynchronously, so that slow I/O won't block the
 	// editor.
@@ -329,34 +383,47 @@ func (ed *Editor) ReadLine() (string, error) {
 
 	fullRefresh := false
 
-	callHooks(ed.evaler, ed.beforeReadLine())
+	if !modal {
+		callHooks(ed.evaler, ed.beforeReadLine())
+	}
 
-	promptUpdater := prompt.NewUpdater(prompt.Prompt)
-	rpromptUpdater := prompt.NewUpdater(prompt.Rprompt)
+	promptUpdater, rpromptUpdater := ed.promptUpdater, ed.rpromptUpdater
 
 MainLoop:
 	for {
-		promptCh := promptUpdater.Update(ed)
-		rpromptCh := rpromptUpdater.Update(ed)
-		promptTimeout := prompt.MakeMaxWaitChan(ed)
-		rpromptTimeout := prompt.MakeMaxWaitChan(ed)
-
-		select {
-		case ed.promptContent = <-promptCh:
-			logger.Println("prompt fetched")
-		case <-promptTimeout:
-			logger.Println("stale prompt")
-			ed.promptContent = promptUpdater.Staled
+		if modal && ed.mode != mode {
+			return ed.buffer, nil
 		}
-		select {
-		case ed.rpromptContent = <-rpromptCh:
-			logger.Println("rprompt fetched")
-		case <-rpromptTimeout:
-			logger.Println("stale rprompt")
-			ed.rpromptContent = rpromptUpdater.Staled
+		if ed.complJob != nil && ed.mode != &ed.completion {
+			ed.cancelComplJob()
+		}
+		promptUpdater.Update(ed)
+		rpromptUpdater.Update(ed)
+		maxWait := prompt.MakeMaxWaitChan(ed)
+
+		// Wait for the prompts for at most $edit:-prompts-max-wait seconds. If
+		// they are not ready by then, the last prompts are used until the new
+		// ones arrive. Only one result is waited for from each updater; updates
+		// queued in the meanwhile are picked up later.
+		promptWait, rpromptWait := promptUpdater.Running(), rpromptUpdater.Running()
+	wait:
+		for promptWait || rpromptWait {
+			select {
+			case content := <-promptUpdater.Chan():
+				promptUpdater.Receive(ed, content)
+				promptWait = false
+			case content := <-rpromptUpdater.Chan():
+				rpromptUpdater.Receive(ed, content)
+				rpromptWait = false
+			case <-maxWait:
+				logger.Println("prompts not ready")
+				break wait
+			}
 		}
 
 	refresh:
+		ed.promptContent = promptUpdater.Content(ed)
+		ed.rpromptContent = rpromptUpdater.Content(ed)
 		err := ed.refresh(fullRefresh, true)
 		fullRefresh = false
 		if err != nil {
@@ -366,11 +433,31 @@ MainLoop:
 		ed.tips = nil
 
 		select {
-		case ed.promptContent = <-promptCh:
+		case content := <-promptUpdater.Chan():
 			logger.Println("prompt fetched late")
+			promptUpdater.Receive(ed, content)
 			goto refresh
-		case ed.rpromptContent = <-rpromptCh:
+		case content := <-rpromptUpdater.Chan():
 			logger.Println("rprompt fetched late")
+			rpromptUpdater.Receive(ed, content)
+			goto refresh
+		case <-promptUpdater.MakeStaleChan(ed):
+			logger.Println("stale prompt")
+			goto refresh
+		case <-rpromptUpdater.MakeStaleChan(ed):
+			logger.Println("stale rprompt")
+			goto refresh
+		case <-ed.promptRefresh:
+			continue MainLoop
+		case u := <-ed.complUpdates():
+			if ed.mode != &ed.completion {
+				// The job is cancelled at the start of the next iteration.
+				continue MainLoop
+			}
+			ed.receiveCompl(u)
+			goto refresh
+		case r := <-ed.previewUpdates():
+			ed.currentPreviewPane().Receive(r)
 			goto refresh
 		case m := <-isExternalCh:
 			ed.isExternal = m
@@ -454,13 +541,18 @@ MainLoop:
 				}
 
 				ed.insert.insertedLiteral = false
+				ed.insert.selecting = false
 				ed.lastKey = k
+				buffer := ed.buffer
 				ed.CallFn(fn)
 				if ed.insert.insertedLiteral {
 					ed.insert.literalInserts++
 				} else {
 					ed.insert.literalInserts = 0
 				}
+				if ed.buffer != buffer || (ed.markShifted && !ed.insert.selecting) {
+					ed.hasMark = false
+				}
 
 				switch ed.popAction() {
 				case reprocessKey:
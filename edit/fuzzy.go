@@ -0,0 +1,265 @@
+package edit
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/elves/elvish/edit/ui"
+)
+
+// Fuzzy matching, in the spirit of fzf. A pattern matches a string if the runes
+// of the pattern appear in the string in order. Among all the ways the pattern
+// can be found, the one with the highest score is chosen; matches at word
+// boundaries and runs of consecutive matches score higher, while gaps between
+// matches are penalized.
+
+const (
+	fuzzyScoreMatch        = 16
+	fuzzyScoreGapStart     = -3
+	fuzzyScoreGapExtension = -1
+
+	fuzzyBonusBoundary    = 8
+	fuzzyBonusCamel       = 7
+	fuzzyBonusConsecutive = 4
+	// The bonus of the first rune of the pattern is multiplied by this.
+	fuzzyBonusFirstMultiplier = 2
+)
+
+// fuzzyMatch matches the pattern p against s. It returns the score, the byte
+// offsets of the matched runes in s, and whether there is a match at all. The
+// empty pattern matches everything with a score of 0. If ignoreCase is true,
+// runes are compared case-insensitively.
+func fuzzyMatch(s, p string, ignoreCase bool) (int, []int, bool) {
+	var fm fuzzyMatcher
+	return fm.match(s, p, ignoreCase)
+}
+
+// fuzzyMatcher does the same matching as fuzzyMatch, reusing its buffers
+// across calls. It should be used when matching many strings. The zero value
+// is ready to use, and a fuzzyMatcher must not be used concurrently.
+type fuzzyMatcher struct {
+	sr, pr             []rune
+	offsets            []int
+	score, from, chunk []int
+}
+
+func (fm *fuzzyMatcher) match(s, p string, ignoreCase bool) (int, []int, bool) {
+	if p == "" {
+		return 0, nil, true
+	}
+	// Most strings do not match at all, which is much cheaper to find out.
+	if !fuzzySubsequence(s, p, ignoreCase) {
+		return 0, nil, false
+	}
+	fm.pr = fm.pr[:0]
+	for _, r := range p {
+		fm.pr = append(fm.pr, r)
+	}
+	fm.sr, fm.offsets = fm.sr[:0], fm.offsets[:0]
+	for i, r := range s {
+		fm.sr = append(fm.sr, r)
+		fm.offsets = append(fm.offsets, i)
+	}
+	sr, pr, offsets := fm.sr, fm.pr, fm.offsets
+	n, m := len(sr), len(pr)
+
+	// score[i*m+j] is the best score when pattern rune j is matched at rune i
+	// of s, and from[i*m+j] is where pattern rune j-1 is matched in that case.
+	// A score of noScore means that there is no such match. chunk[i*m+j] is the
+	// bonus of the first rune in the run of consecutive matches ending there,
+	// which is inherited by the rest of the run.
+	const noScore = -1 << 30
+	fm.score = growInts(fm.score, n*m)
+	fm.from = growInts(fm.from, n*m)
+	fm.chunk = growInts(fm.chunk, n*m)
+	score, from, chunk := fm.score, fm.from, fm.chunk
+	for j := 0; j < m; j++ {
+		// Best score of matching pattern rune j-1 before i-1, with the gap
+		// penalty up to i already applied, and where it was matched.
+		gapped, gappedFrom := noScore, -1
+		for i := 0; i < n; i++ {
+			k := i*m + j
+			score[k] = noScore
+			if j > 0 && i >= 2 {
+				gapped += fuzzyScoreGapExtension
+				if prev := score[(i-2)*m+j-1]; prev != noScore && prev+fuzzyScoreGapStart > gapped {
+					gapped, gappedFrom = prev+fuzzyScoreGapStart, i-2
+				}
+			}
+			if !fuzzyRuneEq(sr[i], pr[j], ignoreCase) {
+				continue
+			}
+			bonus := fuzzyBonus(sr, i)
+			if j == 0 {
+				score[k] = fuzzyScoreMatch + bonus*fuzzyBonusFirstMultiplier
+				from[k], chunk[k] = -1, bonus
+				continue
+			}
+			best, bestFrom, bestChunk := noScore, -1, bonus
+			if i > 0 {
+				if prev := score[(i-1)*m+j-1]; prev != noScore {
+					consecutive := max(bonus, max(chunk[(i-1)*m+j-1], fuzzyBonusConsecutive))
+					best, bestFrom = prev+fuzzyScoreMatch+consecutive, i-1
+					bestChunk = max(bonus, chunk[(i-1)*m+j-1])
+				}
+			}
+			if gappedFrom != -1 && gapped+fuzzyScoreMatch+bonus > best {
+				best, bestFrom, bestChunk = gapped+fuzzyScoreMatch+bonus, gappedFrom, bonus
+			}
+			if bestFrom != -1 {
+				score[k], from[k], chunk[k] = best, bestFrom, bestChunk
+			}
+		}
+	}
+
+	best, bestEnd := noScore, -1
+	for i := m - 1; i < n; i++ {
+		if sc := score[i*m+m-1]; sc > best {
+			best, bestEnd = sc, i
+		}
+	}
+	if bestEnd == -1 {
+		return 0, nil, false
+	}
+	positions := make([]int, m)
+	for i, j := bestEnd, m-1; j >= 0; j-- {
+		positions[j] = offsets[i]
+		i = from[i*m+j]
+	}
+	return best, positions, true
+}
+
+// fuzzySubsequence returns whether the runes of p appear in s in order.
+func fuzzySubsequence(s, p string, ignoreCase bool) bool {
+	for _, r := range s {
+		pr, size := utf8.DecodeRuneInString(p)
+		if fuzzyRuneEq(r, pr, ignoreCase) {
+			p = p[size:]
+			if p == "" {
+				return true
+			}
+		}
+	}
+	return p == ""
+}
+
+func fuzzyRuneEq(a, b rune, ignoreCase bool) bool {
+	if ignoreCase {
+		return unicode.ToLower(a) == unicode.ToLower(b)
+	}
+	return a == b
+}
+
+// growInts returns a slice of length n, reusing the storage of buf if it is
+// large enough. The content of the returned slice is unspecified.
+func growInts(buf []int, n int) []int {
+	if cap(buf) < n {
+		return make([]int, n)
+	}
+	return buf[:n]
+}
+
+// fuzzyBonus returns the bonus for matching the i-th rune of s.
+func fuzzyBonus(s []rune, i int) int {
+	if i == 0 {
+		return fuzzyBonusBoundary
+	}
+	prev, r := s[i-1], s[i]
+	isWord := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+	switch {
+	case !isWord(prev) && isWord(r):
+		return fuzzyBonusBoundary
+	case unicode.IsLower(prev) && unicode.IsUpper(r),
+		!unicode.IsDigit(prev) && unicode.IsDigit(r):
+		return fuzzyBonusCamel
+	}
+	return 0
+}
+
+// smartCase returns whether a pattern should be matched ignoring case, which is
+// when it has no upper case letters.
+func smartCase(p string) bool {
+	return p == strings.ToLower(p)
+}
+
+func matchFuzzyPredicate(s, p string) bool {
+	_, _, ok := fuzzyMatch(s, p, false)
+	return ok
+}
+
+// fuzzyRanking sorts a list of items by their fuzzy matching scores, highest
+// first. Items with the same score keep their relative order.
+type fuzzyRanking struct {
+	scores []int
+	swap   func(i, j int)
+}
+
+func (r fuzzyRanking) Len() int           { return len(r.scores) }
+func (r fuzzyRanking) Less(i, j int) bool { return r.scores[i] > r.scores[j] }
+func (r fuzzyRanking) Swap(i, j int) {
+	r.scores[i], r.scores[j] = r.scores[j], r.scores[i]
+	r.swap(i, j)
+}
+
+// rankByScores stably sorts a list of items by the given scores, highest first.
+// The swap function should swap items i and j of the list.
+func rankByScores(scores []int, swap func(i, j int)) {
+	sort.Stable(fuzzyRanking{scores, swap})
+}
+
+// splitMatched splits a text into lines, along with the byte offsets of matched
+// runes, made relative to the start of each line.
+func splitMatched(text string, matched []int) ([]string, [][]int) {
+	lines := strings.Split(text, "\n")
+	var lineMatched [][]int
+	if matched != nil {
+		lineMatched = make([][]int, len(lines))
+		begin := 0
+		for i, line := range lines {
+			end := begin + len(line)
+			for len(matched) > 0 && matched[0] < end {
+				if matched[0] >= begin {
+					lineMatched[i] = append(lineMatched[i], matched[0]-begin)
+				}
+				matched = matched[1:]
+			}
+			begin = end + 1
+		}
+	}
+	return lines, lineMatched
+}
+
+// shiftOffsets returns a copy of offsets, with each offset increased by d.
+func shiftOffsets(offsets []int, d int) []int {
+	if offsets == nil || d == 0 {
+		return offsets
+	}
+	shifted := make([]int, len(offsets))
+	for i, offset := range offsets {
+		shifted[i] = offset + d
+	}
+	return shifted
+}
+
+// writeHighlighted writes text to the buffer in the given style, with the
+// runes at the given byte offsets additionally highlighted.
+func writeHighlighted(b *ui.Buffer, text string, styles ui.Styles, matched []int) {
+	if len(matched) == 0 {
+		b.WriteString(text, styles.String())
+		return
+	}
+	plain := styles.String()
+	highlighted := ui.JoinStyles(styles, styleForMatched).String()
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if len(matched) > 0 && matched[0] == i {
+			b.Write(r, highlighted)
+			matched = matched[1:]
+		} else {
+			b.Write(r, plain)
+		}
+		i += size
+	}
+}
@@ -0,0 +1,95 @@
+package edit
+
+import (
+	"reflect"
+	"testing"
+)
+
+var fuzzyMatchTests = []struct {
+	s, p        string
+	ignoreCase  bool
+	wantOK      bool
+	wantMatched []int
+}{
+	{"foobar", "", false, true, nil},
+	{"foobar", "fb", false, true, []int{0, 3}},
+	{"foobar", "bf", false, false, nil},
+	{"foobar", "FB", false, false, nil},
+	{"foobar", "FB", true, true, []int{0, 3}},
+	// Word boundaries are preferred.
+	{"abc-a-b", "ab", false, true, []int{0, 1}},
+	{"xab-a-b", "ab", false, true, []int{4, 6}},
+	{"xaxb a_b", "ab", false, true, []int{5, 7}},
+	// Camel case humps count as boundaries.
+	{"xspecSpec", "sp", true, true, []int{5, 6}},
+	// Offsets are in bytes.
+	{"日本語", "語", false, true, []int{6}},
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	for _, test := range fuzzyMatchTests {
+		_, matched, ok := fuzzyMatch(test.s, test.p, test.ignoreCase)
+		if ok != test.wantOK || !reflect.DeepEqual(matched, test.wantMatched) {
+			t.Errorf("fuzzyMatch(%q, %q, %v) -> (%v, %v), want (%v, %v)",
+				test.s, test.p, test.ignoreCase, matched, ok,
+				test.wantMatched, test.wantOK)
+		}
+	}
+}
+
+func TestFuzzyMatcher(t *testing.T) {
+	// A matcher reused for all the tests, so that its buffers are left over
+	// from strings of different lengths.
+	var fm fuzzyMatcher
+	for _, test := range fuzzyMatchTests {
+		_, matched, ok := fm.match(test.s, test.p, test.ignoreCase)
+		if ok != test.wantOK || !reflect.DeepEqual(matched, test.wantMatched) {
+			t.Errorf("fuzzyMatcher.match(%q, %q, %v) -> (%v, %v), want (%v, %v)",
+				test.s, test.p, test.ignoreCase, matched, ok,
+				test.wantMatched, test.wantOK)
+		}
+	}
+}
+
+func TestFuzzyMatchScore(t *testing.T) {
+	better := [][2]string{
+		{"foo-bar", "foobar"},
+		{"foobar", "foo_xbar"},
+		{"fb", "f-b"},
+	}
+	for _, pair := range better {
+		s1, _, _ := fuzzyMatch(pair[0], "fb", false)
+		s2, _, _ := fuzzyMatch(pair[1], "fb", false)
+		if s1 <= s2 {
+			t.Errorf("score of %q (%d) should be higher than %q (%d)",
+				pair[0], s1, pair[1], s2)
+		}
+	}
+}
+
+func TestRankCandidates(t *testing.T) {
+	var raws []rawCandidate
+	for _, s := range []string{"other", "xfxxb", "foo-bar", "fbar"} {
+		raws = append(raws, plainCandidate(s))
+	}
+	cands := sortedCandidates(cookRawCandidates(raws, 0, "fb"))
+	var got []string
+	for _, cand := range cands {
+		got = append(got, cand.menu.Text)
+	}
+	want := []string{"fbar", "foo-bar", "xfxxb", "other"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ranked %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(cands[1].matched, []int{0, 4}) {
+		t.Errorf("matched of %q = %v, want [0 4]", cands[1].menu.Text, cands[1].matched)
+	}
+}
+
+func TestSplitMatched(t *testing.T) {
+	lines, matched := splitMatched("ab\ncd\nef", []int{1, 3, 6, 7})
+	if !reflect.DeepEqual(lines, []string{"ab", "cd", "ef"}) ||
+		!reflect.DeepEqual(matched, [][]int{{1}, {0}, {0, 1}}) {
+		t.Errorf("splitMatched -> %v, %v", lines, matched)
+	}
+}
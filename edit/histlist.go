@@ -3,10 +3,10 @@ package edit
 import (
 	"errors"
 	"fmt"
-	"strconv"
-	"strings"
+	"os"
 
 	"github.com/elves/elvish/edit/ui"
+	"github.com/elves/elvish/store/storedefs"
 )
 
 // Command history listing mode.
@@ -15,38 +15,71 @@ var _ = registerBuiltins(modeHistoryListing, map[string]func(*Editor){
 	"start":                   histlistStart,
 	"toggle-dedup":            histlistToggleDedup,
 	"toggle-case-sensitivity": histlistToggleCaseSensitivity,
+	"toggle-cwd-filter":       histlistToggleCwdFilter,
+	"toggle-success-filter":   histlistToggleSuccessFilter,
 })
 
 // ErrStoreOffline is thrown when an operation requires the storage backend, but
 // it is offline.
 var ErrStoreOffline = errors.New("store offline")
 
+// histlistPageSize is the number of commands fetched at a time by the history
+// listing. More are fetched when the selection reaches the top of the listing.
+const histlistPageSize = 1000
+
 type histlist struct {
-	all             []string
+	// search finds the commands matching a query, from the newest to the
+	// oldest.
+	search          func(storedefs.CmdQuery) ([]storedefs.Cmd, error)
 	dedup           bool
 	caseInsensitive bool
-	last            map[string]int
 	shown           []string
 	index           []int
-	indexWidth      int
+	matched         [][]int
+	// The error from the last search, shown in the mode line.
+	err error
+
+	// The current filter, the maximum number of commands to fetch, and
+	// whether there may be more commands to fetch.
+	filter string
+	limit  int
+	more   bool
+
+	// The working directory and filters on the metadata of commands.
+	cwd         string
+	cwdOnly     bool
+	successOnly bool
 }
 
-func newHistlist(cmds []string) *listing {
-	last := make(map[string]int)
-	for i, entry := range cmds {
-		last[entry] = i
-	}
+func newHistlistWithSearch(search func(storedefs.CmdQuery) ([]storedefs.Cmd, error), cwd string) *listing {
 	hl := &histlist{
 		// This has to be here for the initialization to work :(
-		all:        cmds,
-		dedup:      true,
-		last:       last,
-		indexWidth: len(strconv.Itoa(len(cmds) - 1)),
+		search: search,
+		dedup:  true,
+		cwd:    cwd,
 	}
 	l := newListing(modeHistoryListing, hl)
 	return &l
 }
 
+// newHistlist creates a history listing of commands in memory, using their
+// indices as sequence numbers.
+func newHistlist(cmds []string) *listing {
+	all := make([]storedefs.Cmd, len(cmds))
+	for i, text := range cmds {
+		all[i] = storedefs.Cmd{Seq: i, Text: text}
+	}
+	return newHistlistWithMeta(all, "")
+}
+
+// newHistlistWithMeta creates a history listing of commands in memory, which
+// can be filtered by directory and status. The working directory is cwd.
+func newHistlistWithMeta(cmds []storedefs.Cmd, cwd string) *listing {
+	return newHistlistWithSearch(func(q storedefs.CmdQuery) ([]storedefs.Cmd, error) {
+		return q.Search(len(cmds), func(i int) *storedefs.Cmd { return &cmds[i] })
+	}, cwd)
+}
+
 func (hl *histlist) ModeTitle(i int) string {
 	s := " HISTORY "
 	if hl.dedup {
@@ -55,6 +88,15 @@ func (hl *histlist) ModeTitle(i int) string {
 	if hl.caseInsensitive {
 		s += "(case-insensitive) "
 	}
+	if hl.cwdOnly {
+		s += "(in cwd) "
+	}
+	if hl.successOnly {
+		s += "(succeeded) "
+	}
+	if hl.err != nil {
+		s += "(" + hl.err.Error() + ") "
+	}
 	return s
 }
 
@@ -70,23 +112,79 @@ func (hl *histlist) Show(i int) (string, ui.Styled) {
 	return fmt.Sprintf("%d", hl.index[i]), ui.Unstyled(hl.shown[i])
 }
 
+func (hl *histlist) ShowMatched(i int) []int {
+	return hl.matched[i]
+}
+
 func (hl *histlist) Filter(filter string) int {
+	hl.filter, hl.limit = filter, histlistPageSize
+	return hl.load()
+}
+
+// LoadMore fetches another page of commands, and returns the new index of the
+// entry at index i, or -1 if there are no more commands.
+func (hl *histlist) LoadMore(i int) int {
+	if !hl.more {
+		return -1
+	}
+	seq, text := hl.index[i], hl.shown[i]
+	hl.limit += histlistPageSize
+	hl.load()
+	for j := range hl.index {
+		if hl.index[j] == seq && hl.shown[j] == text {
+			return j
+		}
+	}
+	return 0
+}
+
+// load fetches at most hl.limit commands matching the filter, and returns the
+// index of the entry to select.
+func (hl *histlist) load() int {
+	filter := hl.filter
 	hl.shown = nil
 	hl.index = nil
-	dedup := hl.dedup
-	if hl.caseInsensitive {
-		filter = strings.ToLower(filter)
+	hl.matched = nil
+	hl.err = nil
+	q := storedefs.CmdQuery{
+		Pattern:       filter,
+		Mode:          storedefs.SearchFuzzy,
+		IgnoreCase:    hl.caseInsensitive,
+		Dedup:         hl.dedup,
+		SucceededOnly: hl.successOnly,
+		Limit:         hl.limit,
 	}
-	for i, entry := range hl.all {
-		fentry := entry
-		if hl.caseInsensitive {
-			fentry = strings.ToLower(entry)
-		}
-		if (!dedup || hl.last[entry] == i) && strings.Contains(fentry, filter) {
-			hl.index = append(hl.index, i)
-			hl.shown = append(hl.shown, entry)
+	if hl.cwdOnly {
+		q.Dir = hl.cwd
+	}
+	cmds, err := hl.search(q)
+	if err != nil {
+		hl.err = err
+		hl.more = false
+		return -1
+	}
+	hl.more = len(cmds) == hl.limit
+	var (
+		scores []int
+		fm     fuzzyMatcher
+	)
+	// Results are from the newest to the oldest; show the oldest first.
+	for i := len(cmds) - 1; i >= 0; i-- {
+		cmd := cmds[i]
+		if score, matched, ok := fm.match(cmd.Text, filter, hl.caseInsensitive); ok {
+			hl.index = append(hl.index, cmd.Seq)
+			hl.shown = append(hl.shown, cmd.Text)
+			hl.matched = append(hl.matched, matched)
+			// The last entry is selected initially, so the best matches are
+			// put at the bottom.
+			scores = append(scores, -score)
 		}
 	}
+	rankByScores(scores, func(i, j int) {
+		hl.index[i], hl.index[j] = hl.index[j], hl.index[i]
+		hl.shown[i], hl.shown[j] = hl.shown[j], hl.shown[i]
+		hl.matched[i], hl.matched[j] = hl.matched[j], hl.matched[i]
+	})
 	// TODO: Maintain old selection
 	return len(hl.shown) - 1
 }
@@ -102,20 +200,14 @@ func (hl *histlist) Accept(i int, ed *Editor) {
 }
 
 func histlistStart(ed *Editor) {
-	cmds, err := getCmds(ed)
-	if err != nil {
-		ed.Notify("%v", err)
+	if ed.historyFuser == nil {
+		ed.Notify("%v", ErrStoreOffline)
 		return
 	}
-
-	ed.mode = newHistlist(cmds)
-}
-
-func getCmds(ed *Editor) ([]string, error) {
-	if ed.daemon == nil {
-		return nil, ErrStoreOffline
-	}
-	return ed.historyFuser.AllCmds()
+	cwd, _ := os.Getwd()
+	l := newHistlistWithSearch(ed.historyFuser.SearchCmds, cwd)
+	l.initPreview(ed)
+	ed.mode = l
 }
 
 func histlistToggleDedup(ed *Editor) {
@@ -132,6 +224,20 @@ func histlistToggleCaseSensitivity(ed *Editor) {
 	}
 }
 
+func histlistToggleCwdFilter(ed *Editor) {
+	if l, hl, ok := getHistlist(ed); ok {
+		hl.cwdOnly = !hl.cwdOnly
+		l.refresh()
+	}
+}
+
+func histlistToggleSuccessFilter(ed *Editor) {
+	if l, hl, ok := getHistlist(ed); ok {
+		hl.successOnly = !hl.successOnly
+		l.refresh()
+	}
+}
+
 func getHistlist(ed *Editor) (*listing, *histlist, bool) {
 	if l, ok := ed.mode.(*listing); ok {
 		if hl, ok := l.provider.(*histlist); ok {
@@ -1,9 +1,11 @@
 package edit
 
 import (
+	"strconv"
 	"testing"
 
 	"github.com/elves/elvish/edit/ui"
+	"github.com/elves/elvish/store/storedefs"
 )
 
 var (
@@ -35,3 +37,46 @@ func TestHistlist(t *testing.T) {
 	theHistList.provider.(*histlist).dedup = false
 	testListingFilter(t, "theHistList", theHistList, histlistNoDedupFilterTests)
 }
+
+func TestHistlistMetaFilters(t *testing.T) {
+	l := newHistlistWithMeta([]storedefs.Cmd{
+		{Seq: 1, Text: "ls", CmdMeta: storedefs.CmdMeta{Dir: "/a", Finished: true}},
+		{Seq: 2, Text: "make", CmdMeta: storedefs.CmdMeta{Dir: "/a", Finished: true, Exception: "make exited with 2"}},
+		{Seq: 3, Text: "ls", CmdMeta: storedefs.CmdMeta{Dir: "/b", Finished: true}},
+		{Seq: 4, Text: "old"},
+	}, "/a")
+	hl := l.provider.(*histlist)
+
+	hl.cwdOnly = true
+	testListingFilter(t, "cwd only", l, []listingFilterTestCases{
+		{"", []shown{
+			{"1", ui.Unstyled("ls")},
+			{"2", ui.Unstyled("make")}}},
+	})
+
+	hl.cwdOnly, hl.successOnly = false, true
+	testListingFilter(t, "success only", l, []listingFilterTestCases{
+		{"", []shown{
+			{"3", ui.Unstyled("ls")}}},
+	})
+}
+
+func TestHistlistLoadMore(t *testing.T) {
+	var cmds []string
+	for i := 0; i < histlistPageSize+10; i++ {
+		cmds = append(cmds, "cmd "+strconv.Itoa(i))
+	}
+	l := newHistlist(cmds)
+	if n := l.provider.Len(); n != histlistPageSize {
+		t.Errorf("initially %d commands are shown, want %d", n, histlistPageSize)
+	}
+	// Moving up from the oldest shown command loads more.
+	l.selected = 0
+	l.up(false)
+	if n := l.provider.Len(); n != len(cmds) {
+		t.Errorf("after loading more, %d commands are shown, want %d", n, len(cmds))
+	}
+	if header, _ := l.provider.Show(l.selected); header != "9" {
+		t.Errorf("after loading more, command %s is selected, want 9", header)
+	}
+}
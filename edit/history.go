@@ -3,12 +3,16 @@ package edit
 import (
 	"errors"
 	"fmt"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/elves/elvish/edit/history"
 	"github.com/elves/elvish/edit/ui"
 	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
 	"github.com/elves/elvish/eval/vartypes"
+	"github.com/elves/elvish/store/storedefs"
 )
 
 // Command history mode.
@@ -31,6 +35,9 @@ func (*hist) Binding(m map[string]vartypes.Variable, k ui.Key) eval.Fn {
 }
 
 func (h *hist) ModeLine() ui.Renderer {
+	if h.CurrentSeq() == history.SessionOnlySeq {
+		return modeLineRenderer{" HISTORY (private) ", ""}
+	}
 	return modeLineRenderer{fmt.Sprintf(" HISTORY #%d ", h.CurrentSeq()), ""}
 }
 
@@ -99,18 +106,77 @@ func historyDefault(ed *Editor, hist *hist) {
 	ed.setAction(reprocessKey)
 }
 
+// Commands are added to the history only if $edit:history:filter outputs true
+// for them. The default filter rejects commands starting with a space, which
+// is useful for confidential operations. When $edit:history:private is true,
+// commands are only kept in the history of the current session.
+
+var _ = RegisterVariable("history:private", func() vartypes.Variable {
+	return vartypes.NewValidatedPtr(types.Bool(false), vartypes.ShouldBeBool)
+})
+
+var _ = RegisterVariable("history:filter", func() vartypes.Variable {
+	return vartypes.NewValidatedPtr(defaultHistoryFilter, eval.ShouldBeFn)
+})
+
+var defaultHistoryFilter = &eval.BuiltinFn{"edit:history:filter", func(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+	var line string
+	eval.ScanArgs(args, &line)
+	eval.TakeNoOpt(opts)
+	ec.OutputChan() <- types.Bool(!strings.HasPrefix(line, " "))
+}}
+
+func (ed *Editor) historyPrivate() bool {
+	return bool(ed.variables["history:private"].Get().(types.Bool))
+}
+
+// SetHistoryPrivate sets whether commands are only kept in the history of the
+// current session.
+func (ed *Editor) SetHistoryPrivate(private bool) {
+	maybeThrow(ed.variables["history:private"].Set(types.Bool(private)))
+}
+
+// historyFilterAccepts calls $edit:history:filter with the line, and returns
+// whether the line should be added to the history. The line is rejected if the
+// filter throws an exception or outputs any false value.
+func (ed *Editor) historyFilterAccepts(line string) bool {
+	filter := ed.variables["history:filter"].Get().(eval.Fn)
+	ports := []*eval.Port{eval.DevNullClosedChan, ed.notifyPort, ed.notifyPort}
+	ec := eval.NewTopFrame(ed.evaler, eval.NewInternalSource("[editor history filter]"), ports)
+	values, err := ec.PCaptureOutput(filter, []types.Value{types.String(line)}, eval.NoOpts)
+	if err != nil {
+		ed.Notify("history filter error: %s", err)
+		return false
+	}
+	for _, v := range values {
+		if !types.ToBool(v) {
+			return false
+		}
+	}
+	return true
+}
+
 func (ed *Editor) appendHistory(line string) {
-	// TODO: should have a user variable to control the behavior
-	// Do not add command leading by space into history. This is
-	// useful for confidential operations.
-	if strings.HasPrefix(line, " ") {
+	accepted := ed.historyFilterAccepts(line)
+	private := ed.historyPrivate()
+	if !accepted || private {
+		ed.historyMutex.Lock()
+		ed.lastCmdSeq = 0
+		ed.historyMutex.Unlock()
+		if accepted && ed.historyFuser != nil {
+			ed.historyFuser.AddSessionCmd(line)
+		}
 		return
 	}
 
 	if ed.daemon != nil && ed.historyFuser != nil {
+		meta := storedefs.CmdMeta{
+			Start: time.Now().UnixNano(), Host: ed.hostname, Session: ed.session}
+		meta.Dir, _ = os.Getwd()
 		ed.historyMutex.Lock()
 		go func() {
-			err := ed.historyFuser.AddCmd(line)
+			seq, err := ed.historyFuser.AddCmdWithMeta(line, meta)
+			ed.lastCmdSeq = seq
 			ed.historyMutex.Unlock()
 			if err != nil {
 				logger.Printf("Failed to AddCmd %q: %v", line, err)
@@ -118,3 +184,27 @@ func (ed *Editor) appendHistory(line string) {
 		}()
 	}
 }
+
+// finishHistory records the result of the command last added to the history.
+func (ed *Editor) finishHistory(duration time.Duration, err error) {
+	if ed.daemon == nil {
+		return
+	}
+	exception := ""
+	if err != nil {
+		exception = err.Error()
+	}
+	go func() {
+		ed.historyMutex.Lock()
+		seq := ed.lastCmdSeq
+		ed.lastCmdSeq = 0
+		ed.historyMutex.Unlock()
+		if seq == 0 {
+			return
+		}
+		err := ed.daemon.FinishCmd(seq, duration.Seconds(), exception)
+		if err != nil {
+			logger.Printf("Failed to FinishCmd %d: %v", seq, err)
+		}
+	}()
+}
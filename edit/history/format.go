@@ -0,0 +1,217 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/elves/elvish/store/storedefs"
+)
+
+// Formats of history files that can be imported. Histories are exported in
+// FormatJSON, which preserves all the metadata.
+const (
+	FormatBash = "bash"
+	FormatZsh  = "zsh"
+	FormatFish = "fish"
+	FormatJSON = "json"
+)
+
+var errUnknownFormat = errors.New("unknown history format")
+
+// DetectFormat guesses the format of a history file from its name, returning
+// "" if it cannot tell.
+func DetectFormat(path string) string {
+	base := filepath.Base(path)
+	switch {
+	case strings.Contains(base, "bash"):
+		return FormatBash
+	case strings.Contains(base, "zsh") || base == ".histfile":
+		return FormatZsh
+	case strings.Contains(base, "fish"):
+		return FormatFish
+	case strings.HasSuffix(base, ".json") || strings.HasSuffix(base, ".jsonl"):
+		return FormatJSON
+	}
+	return ""
+}
+
+// Parse parses a history file in the given format. The commands are returned
+// in their order in the file, with their start times when the file records
+// them.
+func Parse(format string, r io.Reader) ([]storedefs.Cmd, error) {
+	switch format {
+	case FormatBash:
+		return parseBash(r)
+	case FormatZsh:
+		return parseZsh(r)
+	case FormatFish:
+		return parseFish(r)
+	case FormatJSON:
+		return parseJSON(r)
+	}
+	return nil, errUnknownFormat
+}
+
+// parseBash parses the bash history. When HISTTIMEFORMAT is set, commands are
+// preceded by a comment line containing the time, like "#1500000000".
+func parseBash(r io.Reader) ([]storedefs.Cmd, error) {
+	var (
+		cmds  []storedefs.Cmd
+		start int64
+	)
+	err := eachLine(r, func(line string) {
+		if len(line) > 1 && line[0] == '#' {
+			if t, err := strconv.ParseInt(line[1:], 10, 64); err == nil {
+				start = t * 1e9
+				return
+			}
+		}
+		if line != "" {
+			cmds = append(cmds, cmdAt(line, start))
+		}
+		start = 0
+	})
+	return cmds, err
+}
+
+// parseZsh parses the zsh history, in either the plain or the extended format,
+// where each command looks like ": 1500000000:0;ls". Multi-line commands have
+// all but their last lines ending with a backslash.
+func parseZsh(r io.Reader) ([]storedefs.Cmd, error) {
+	var (
+		cmds    []storedefs.Cmd
+		pending []string
+		start   int64
+	)
+	err := eachLine(r, func(line string) {
+		if len(pending) == 0 {
+			start = 0
+			if strings.HasPrefix(line, ": ") {
+				if i := strings.IndexByte(line, ';'); i > 0 {
+					fields := strings.SplitN(line[2:i], ":", 2)
+					if t, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+						start = t * 1e9
+					}
+					line = line[i+1:]
+				}
+			}
+		}
+		if strings.HasSuffix(line, "\\") {
+			pending = append(pending, line[:len(line)-1])
+			return
+		}
+		text := strings.Join(append(pending, line), "\n")
+		pending = nil
+		if text != "" {
+			cmds = append(cmds, cmdAt(text, start))
+		}
+	})
+	return cmds, err
+}
+
+// parseFish parses the fish history, which is a YAML-like list of entries such
+// as "- cmd: ls" followed by "  when: 1500000000".
+func parseFish(r io.Reader) ([]storedefs.Cmd, error) {
+	var cmds []storedefs.Cmd
+	err := eachLine(r, func(line string) {
+		switch {
+		case strings.HasPrefix(line, "- cmd: "):
+			cmds = append(cmds, cmdAt(unescapeFish(line[len("- cmd: "):]), 0))
+		case strings.HasPrefix(line, "  when: ") && len(cmds) > 0:
+			t, err := strconv.ParseInt(line[len("  when: "):], 10, 64)
+			if err == nil {
+				cmds[len(cmds)-1].Start = t * 1e9
+			}
+		}
+	})
+	return cmds, err
+}
+
+// unescapeFish undoes the escaping of newlines and backslashes in the fish
+// history.
+func unescapeFish(s string) string {
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case 'n':
+				b.WriteByte('\n')
+				i++
+				continue
+			case '\\':
+				b.WriteByte('\\')
+				i++
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// jsonCmd is the JSON representation of an entry in the command history. The
+// start time is in seconds since the Unix epoch.
+type jsonCmd struct {
+	Seq       int     `json:"seq,omitempty"`
+	Text      string  `json:"text"`
+	Dir       string  `json:"dir,omitempty"`
+	Start     float64 `json:"start,omitempty"`
+	Finished  bool    `json:"finished,omitempty"`
+	Duration  float64 `json:"duration,omitempty"`
+	Exception string  `json:"exception,omitempty"`
+	Host      string  `json:"host,omitempty"`
+	Session   string  `json:"session,omitempty"`
+}
+
+func parseJSON(r io.Reader) ([]storedefs.Cmd, error) {
+	var cmds []storedefs.Cmd
+	decoder := json.NewDecoder(r)
+	for {
+		var c jsonCmd
+		err := decoder.Decode(&c)
+		if err == io.EOF {
+			return cmds, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("entry %d: %v", len(cmds)+1, err)
+		}
+		cmds = append(cmds, storedefs.Cmd{Seq: c.Seq, Text: c.Text, CmdMeta: storedefs.CmdMeta{
+			Dir: c.Dir, Start: int64(c.Start * 1e9), Finished: c.Finished,
+			Duration: c.Duration, Exception: c.Exception,
+			Host: c.Host, Session: c.Session}})
+	}
+}
+
+// WriteJSON writes commands as JSON lines, one object per command.
+func WriteJSON(w io.Writer, cmds []storedefs.Cmd) error {
+	encoder := json.NewEncoder(w)
+	for _, c := range cmds {
+		err := encoder.Encode(jsonCmd{
+			Seq: c.Seq, Text: c.Text, Dir: c.Dir, Start: float64(c.Start) / 1e9,
+			Finished: c.Finished, Duration: c.Duration, Exception: c.Exception,
+			Host: c.Host, Session: c.Session})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cmdAt(text string, start int64) storedefs.Cmd {
+	return storedefs.Cmd{Text: text, CmdMeta: storedefs.CmdMeta{Start: start}}
+}
+
+func eachLine(r io.Reader, f func(string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		f(scanner.Text())
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,70 @@
+package history
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/elves/elvish/store/storedefs"
+)
+
+var parseTests = []struct {
+	format string
+	file   string
+	want   []storedefs.Cmd
+}{
+	{FormatBash, "ls\n#1500000000\necho foo\n\n", []storedefs.Cmd{
+		cmdAt("ls", 0), cmdAt("echo foo", 1500000000e9)}},
+	{FormatZsh, ": 1500000000:0;ls\n: 1500000001:0;echo \\\nfoo\nplain\n", []storedefs.Cmd{
+		cmdAt("ls", 1500000000e9), cmdAt("echo \nfoo", 1500000001e9), cmdAt("plain", 0)}},
+	{FormatFish, "- cmd: echo a\\nb\\\\c\n  when: 1500000000\n  paths:\n    - a\n- cmd: ls\n", []storedefs.Cmd{
+		cmdAt("echo a\nb\\c", 1500000000e9), cmdAt("ls", 0)}},
+}
+
+func TestParse(t *testing.T) {
+	for _, test := range parseTests {
+		cmds, err := Parse(test.format, strings.NewReader(test.file))
+		if !reflect.DeepEqual(cmds, test.want) || err != nil {
+			t.Errorf("Parse(%q, %q) -> (%v, %v), want (%v, nil)",
+				test.format, test.file, cmds, err, test.want)
+		}
+	}
+	if _, err := Parse("csh", strings.NewReader("")); err != errUnknownFormat {
+		t.Errorf("Parse with unknown format -> error %v", err)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	cmds := []storedefs.Cmd{
+		{Seq: 1, Text: "ls", CmdMeta: storedefs.CmdMeta{
+			Dir: "/tmp", Start: 1500000000500000000, Finished: true,
+			Duration: 0.5, Exception: "bad", Host: "h", Session: "s"}},
+		{Seq: 2, Text: "echo\nfoo"},
+	}
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, cmds); err != nil {
+		t.Fatalf("WriteJSON -> error %v", err)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 2 {
+		t.Errorf("WriteJSON wrote %d lines, want 2", n)
+	}
+	parsed, err := Parse(FormatJSON, &buf)
+	if !reflect.DeepEqual(parsed, cmds) || err != nil {
+		t.Errorf("Parse(WriteJSON(cmds)) -> (%v, %v), want (%v, nil)", parsed, err, cmds)
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	for path, want := range map[string]string{
+		"/home/me/.bash_history":                  FormatBash,
+		"/home/me/.zsh_history":                   FormatZsh,
+		"/home/me/.local/share/fish/fish_history": FormatFish,
+		"backup.jsonl":                            FormatJSON,
+		"history.txt":                             "",
+	} {
+		if got := DetectFormat(path); got != want {
+			t.Errorf("DetectFormat(%q) -> %q, want %q", path, got, want)
+		}
+	}
+}
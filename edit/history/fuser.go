@@ -2,8 +2,14 @@ package history
 
 import (
 	"sync"
+
+	"github.com/elves/elvish/store/storedefs"
 )
 
+// SessionOnlySeq is the sequence number of commands that are only kept in the
+// session history.
+const SessionOnlySeq = -1
+
 // Fuser provides a unified view into a shared storage-backed command history
 // and per-session history.
 type Fuser struct {
@@ -12,7 +18,8 @@ type Fuser struct {
 
 	*sync.RWMutex
 
-	// Per-session history.
+	// Per-session history. Commands kept only in the session history have a
+	// sequence number of SessionOnlySeq.
 	cmds []string
 	seqs []int
 }
@@ -41,6 +48,29 @@ func (f *Fuser) AddCmd(cmd string) error {
 	return nil
 }
 
+// AddCmdWithMeta is like AddCmd, but also stores the metadata of the command.
+// It returns the sequence number of the command in the storage.
+func (f *Fuser) AddCmdWithMeta(cmd string, meta storedefs.CmdMeta) (int, error) {
+	f.Lock()
+	defer f.Unlock()
+	seq, err := f.store.AddCmdWithMeta(cmd, meta)
+	if err != nil {
+		return 0, err
+	}
+	f.cmds = append(f.cmds, cmd)
+	f.seqs = append(f.seqs, seq)
+	return seq, nil
+}
+
+// AddSessionCmd adds a command to the session history only, without storing
+// it.
+func (f *Fuser) AddSessionCmd(cmd string) {
+	f.Lock()
+	defer f.Unlock()
+	f.cmds = append(f.cmds, cmd)
+	f.seqs = append(f.seqs, SessionOnlySeq)
+}
+
 func (f *Fuser) AllCmds() ([]string, error) {
 	f.RLock()
 	defer f.RUnlock()
@@ -51,6 +81,141 @@ func (f *Fuser) AllCmds() ([]string, error) {
 	return append(cmds, f.cmds...), nil
 }
 
+// AllCmdsWithMeta is like AllCmds, but also returns the metadata of the
+// commands.
+func (f *Fuser) AllCmdsWithMeta() ([]storedefs.Cmd, error) {
+	f.RLock()
+	defer f.RUnlock()
+	cmds, err := f.store.CmdsWithMeta(0, f.storeUpper)
+	if err != nil {
+		return nil, err
+	}
+	session, err := f.sessionCmdsWithMeta()
+	if err != nil {
+		return nil, err
+	}
+	return append(cmds, session...), nil
+}
+
+// sessionCmdsWithMeta returns the commands of the session history with their
+// metadata. It must be called with the lock held.
+func (f *Fuser) sessionCmdsWithMeta() ([]storedefs.Cmd, error) {
+	from, upto := -1, -1
+	for _, seq := range f.seqs {
+		if seq != SessionOnlySeq {
+			if from == -1 {
+				from = seq
+			}
+			upto = seq + 1
+		}
+	}
+	// Commands from other sessions are interleaved with those of this session
+	// in the storage; pick out the latter.
+	stored := make(map[int]storedefs.Cmd)
+	if from != -1 {
+		storedCmds, err := f.store.CmdsWithMeta(from, upto)
+		if err != nil {
+			return nil, err
+		}
+		for _, cmd := range storedCmds {
+			stored[cmd.Seq] = cmd
+		}
+	}
+	var cmds []storedefs.Cmd
+	for i, seq := range f.seqs {
+		if seq == SessionOnlySeq {
+			cmds = append(cmds, storedefs.Cmd{Seq: seq, Text: f.cmds[i]})
+		} else if cmd, ok := stored[seq]; ok {
+			cmds = append(cmds, cmd)
+		}
+	}
+	return cmds, nil
+}
+
+// SearchPageSize is the number of commands fetched from the storage at a time
+// by SearchCmds.
+const SearchPageSize = 1000
+
+// SearchCmds searches the same commands as AllCmdsWithMeta, and returns those
+// matching the query from the newest to the oldest. The session history is
+// searched first, and then the storage, page by page. The Before field of the
+// query is ignored.
+func (f *Fuser) SearchCmds(q storedefs.CmdQuery) ([]storedefs.Cmd, error) {
+	f.RLock()
+	defer f.RUnlock()
+	limit := q.Limit
+	q.Before, q.Limit = 0, 0
+
+	// The session history includes commands that are not in the storage.
+	session, err := f.sessionCmdsWithMeta()
+	if err != nil {
+		return nil, err
+	}
+	results, err := q.Search(len(session), func(i int) *storedefs.Cmd { return &session[i] })
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(results) >= limit {
+		return results[:limit], nil
+	}
+	// When deduplicating, commands are shadowed by newer commands with the
+	// same text, in the session history or on previous pages.
+	dedup := q.Dedup
+	shadowed := make(map[string]bool)
+	if dedup {
+		for _, cmd := range results {
+			shadowed[cmd.Text] = true
+		}
+	}
+
+	// Commands added to the storage by other sessions after this one started
+	// are not included.
+	q.Before, q.Limit = f.storeUpper, SearchPageSize
+	for q.Before > 0 {
+		page, err := f.store.SearchCmds(q)
+		if err != nil {
+			return nil, err
+		}
+		for _, cmd := range page {
+			if shadowed[cmd.Text] {
+				continue
+			}
+			if dedup {
+				shadowed[cmd.Text] = true
+			}
+			results = append(results, cmd)
+			if limit > 0 && len(results) == limit {
+				return results, nil
+			}
+		}
+		if len(page) < SearchPageSize {
+			break
+		}
+		q.Before = page[len(page)-1].Seq
+	}
+	return results, nil
+}
+
+// Forget removes the commands with the given sequence numbers from the
+// session history. It should be called after removing them from the storage.
+func (f *Fuser) Forget(seqs []int) {
+	f.Lock()
+	defer f.Unlock()
+	forget := make(map[int]bool)
+	for _, seq := range seqs {
+		forget[seq] = true
+	}
+	var cmds []string
+	var keptSeqs []int
+	for i, seq := range f.seqs {
+		if !forget[seq] {
+			cmds = append(cmds, f.cmds[i])
+			keptSeqs = append(keptSeqs, seq)
+		}
+	}
+	f.cmds, f.seqs = cmds, keptSeqs
+}
+
 func (f *Fuser) SessionCmds() []string {
 	return f.cmds
 }
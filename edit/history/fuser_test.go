@@ -4,6 +4,8 @@ import (
 	"errors"
 	"reflect"
 	"testing"
+
+	"github.com/elves/elvish/store/storedefs"
 )
 
 func TestNewFuser(t *testing.T) {
@@ -71,3 +73,125 @@ func TestFuser(t *testing.T) {
 	wantCmd(t, w.Prev, 0, "store 1")
 	wantErr(t, w.Prev, ErrEndOfHistory)
 }
+
+func TestFuserWithMeta(t *testing.T) {
+	store := &mockStore{cmds: []string{"store 1"}}
+	f, _ := NewFuser(store)
+
+	meta := storedefs.CmdMeta{Dir: "/tmp", Session: "s"}
+	seq, err := f.AddCmdWithMeta("session 1", meta)
+	if seq != 1 || err != nil {
+		t.Errorf("AddCmdWithMeta -> (%v, %v), want (1, nil)", seq, err)
+	}
+	store.AddCmd("other session")
+	f.AddCmdWithMeta("session 2", meta)
+
+	cmds, err := f.AllCmdsWithMeta()
+	want := []storedefs.Cmd{
+		{Seq: 0, Text: "store 1"},
+		{Seq: 1, Text: "session 1", CmdMeta: meta},
+		{Seq: 3, Text: "session 2", CmdMeta: meta},
+	}
+	if !reflect.DeepEqual(cmds, want) || err != nil {
+		t.Errorf("AllCmdsWithMeta -> (%v, %v), want (%v, nil)", cmds, err, want)
+	}
+}
+
+func TestFuserForget(t *testing.T) {
+	f, _ := NewFuser(&mockStore{})
+	f.AddCmd("a")
+	f.AddCmd("secret")
+	f.AddCmd("b")
+	f.Forget([]int{1})
+	if !reflect.DeepEqual(f.SessionCmds(), []string{"a", "b"}) || !reflect.DeepEqual(f.seqs, []int{0, 2}) {
+		t.Errorf("after Forget, session has %v, %v", f.SessionCmds(), f.seqs)
+	}
+}
+
+func TestFuserSessionOnly(t *testing.T) {
+	store := &mockStore{cmds: []string{"store 1"}}
+	f, _ := NewFuser(store)
+	f.AddCmd("session 1")
+	f.AddSessionCmd("private")
+	f.AddCmd("session 2")
+
+	if !reflect.DeepEqual(store.cmds, []string{"store 1", "session 1", "session 2"}) {
+		t.Errorf("AddSessionCmd stores command, store has %v", store.cmds)
+	}
+	cmds, err := f.AllCmdsWithMeta()
+	want := []storedefs.Cmd{
+		{Seq: 0, Text: "store 1"},
+		{Seq: 1, Text: "session 1"},
+		{Seq: SessionOnlySeq, Text: "private"},
+		{Seq: 2, Text: "session 2"},
+	}
+	if !reflect.DeepEqual(cmds, want) || err != nil {
+		t.Errorf("AllCmdsWithMeta -> (%v, %v), want (%v, nil)", cmds, err, want)
+	}
+
+	w := f.Walker("")
+	wantCmd(t, w.Prev, 2, "session 2")
+	wantCmd(t, w.Prev, SessionOnlySeq, "private")
+	wantCmd(t, w.Prev, 1, "session 1")
+	wantCmd(t, w.Prev, 0, "store 1")
+	wantErr(t, w.Prev, ErrEndOfHistory)
+}
+
+func TestFuserSearchCmds(t *testing.T) {
+	store := &mockStore{cmds: []string{"echo a", "ls", "echo b"}}
+	f, _ := NewFuser(store)
+	store.AddCmd("echo other session")
+	f.AddCmd("echo a")
+
+	q := storedefs.CmdQuery{Pattern: "echo", Dedup: true}
+	cmds, err := f.SearchCmds(q)
+	want := []storedefs.Cmd{
+		{Seq: 4, Text: "echo a"},
+		{Seq: 2, Text: "echo b"},
+	}
+	if !reflect.DeepEqual(cmds, want) || err != nil {
+		t.Errorf("SearchCmds(%v) -> (%v, %v), want (%v, nil)", q, cmds, err, want)
+	}
+
+	q.Limit = 1
+	cmds, err = f.SearchCmds(q)
+	if !reflect.DeepEqual(cmds, want[:1]) || err != nil {
+		t.Errorf("SearchCmds(%v) -> (%v, %v), want (%v, nil)", q, cmds, err, want[:1])
+	}
+}
+
+func TestFuserSearchCmdsPaging(t *testing.T) {
+	store := &mockStore{}
+	for i := 0; i < SearchPageSize*2+10; i++ {
+		store.AddCmd("cmd")
+	}
+	f, _ := NewFuser(store)
+
+	cmds, err := f.SearchCmds(storedefs.CmdQuery{})
+	if len(cmds) != len(store.cmds) || err != nil {
+		t.Errorf("SearchCmds -> (%d commands, %v), want (%d commands, nil)",
+			len(cmds), err, len(store.cmds))
+	}
+	cmds, err = f.SearchCmds(storedefs.CmdQuery{Dedup: true})
+	if len(cmds) != 1 || err != nil {
+		t.Errorf("SearchCmds with dedup -> (%d commands, %v), want (1 command, nil)",
+			len(cmds), err)
+	}
+}
+
+func TestFuserSearchCmdsSessionOnly(t *testing.T) {
+	store := &mockStore{cmds: []string{"echo public"}}
+	f, _ := NewFuser(store)
+	f.AddSessionCmd("echo private")
+	f.AddSessionCmd("ls")
+
+	q := storedefs.CmdQuery{Pattern: "echo"}
+	cmds, err := f.SearchCmds(q)
+	want := []storedefs.Cmd{
+		{Seq: SessionOnlySeq, Text: "echo private"},
+		{Seq: 0, Text: "echo public"},
+	}
+	if !reflect.DeepEqual(cmds, want) || err != nil {
+		t.Errorf("SearchCmds(%v) -> (%v, %v), want (%v, nil)", q, cmds, err, want)
+	}
+}
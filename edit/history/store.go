@@ -1,9 +1,14 @@
 package history
 
+import "github.com/elves/elvish/store/storedefs"
+
 // Store is the interface of the storage backend.
 type Store interface {
 	NextCmdSeq() (int, error)
 	AddCmd(cmd string) (int, error)
+	AddCmdWithMeta(cmd string, meta storedefs.CmdMeta) (int, error)
 	Cmds(from, upto int) ([]string, error)
+	CmdsWithMeta(from, upto int) ([]storedefs.Cmd, error)
 	PrevCmd(upto int, prefix string) (int, string, error)
+	SearchCmds(q storedefs.CmdQuery) ([]storedefs.Cmd, error)
 }
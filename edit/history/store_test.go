@@ -1,11 +1,16 @@
 package history
 
-import "strings"
+import (
+	"strings"
+
+	"github.com/elves/elvish/store/storedefs"
+)
 
 // mockStore is an implementation of the Store interface that can be used for
 // testing.
 type mockStore struct {
-	cmds []string
+	cmds  []string
+	metas map[int]storedefs.CmdMeta
 
 	oneOffError error
 }
@@ -28,10 +33,29 @@ func (s *mockStore) AddCmd(cmd string) (int, error) {
 	return len(s.cmds) - 1, nil
 }
 
+func (s *mockStore) AddCmdWithMeta(cmd string, meta storedefs.CmdMeta) (int, error) {
+	seq, err := s.AddCmd(cmd)
+	if err == nil {
+		if s.metas == nil {
+			s.metas = make(map[int]storedefs.CmdMeta)
+		}
+		s.metas[seq] = meta
+	}
+	return seq, err
+}
+
 func (s *mockStore) Cmds(from, upto int) ([]string, error) {
 	return s.cmds[from:upto], s.error()
 }
 
+func (s *mockStore) CmdsWithMeta(from, upto int) ([]storedefs.Cmd, error) {
+	var cmds []storedefs.Cmd
+	for i := from; i < upto && i < len(s.cmds); i++ {
+		cmds = append(cmds, storedefs.Cmd{Seq: i, Text: s.cmds[i], CmdMeta: s.metas[i]})
+	}
+	return cmds, s.error()
+}
+
 func (s *mockStore) PrevCmd(upto int, prefix string) (int, string, error) {
 	if s.oneOffError != nil {
 		return -1, "", s.error()
@@ -46,3 +70,12 @@ func (s *mockStore) PrevCmd(upto int, prefix string) (int, string, error) {
 	}
 	return -1, "", ErrEndOfHistory
 }
+
+func (s *mockStore) SearchCmds(q storedefs.CmdQuery) ([]storedefs.Cmd, error) {
+	if s.oneOffError != nil {
+		return nil, s.error()
+	}
+	return q.Search(len(s.cmds), func(i int) *storedefs.Cmd {
+		return &storedefs.Cmd{Seq: i, Text: s.cmds[i], CmdMeta: s.metas[i]}
+	})
+}
@@ -79,8 +79,15 @@ func (w *Walker) Prev() (int, string, error) {
 	w.sessionIdx = -1
 
 	seq := w.storeUpper
-	if len(w.seq) > 0 && seq > w.seq[len(w.seq)-1] {
-		seq = w.seq[len(w.seq)-1]
+	// Continue from the last stored command found, skipping commands only in
+	// the session history.
+	for i := len(w.seq) - 1; i >= 0; i-- {
+		if w.seq[i] != SessionOnlySeq {
+			if w.seq[i] < seq {
+				seq = w.seq[i]
+			}
+			break
+		}
 	}
 	for {
 		var (
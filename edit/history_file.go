@@ -0,0 +1,102 @@
+package edit
+
+import (
+	"errors"
+	"os"
+
+	"github.com/elves/elvish/edit/history"
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
+)
+
+// Builtins for maintaining the command history.
+
+var (
+	errNothingToDelete = errors.New("need sequence numbers or &pattern")
+	errUnknownFormat   = errors.New("cannot tell the format of the history file; use &format")
+)
+
+// deleteHistory implements edit:delete-history, which deletes the commands
+// with the given sequence numbers, or those matching the regular expression
+// given as &pattern, from the command history. Sequence numbers are shown as
+// the seq field in the output of edit:command-history.
+//
+// The database is compacted afterwards, so that the deleted commands do not
+// linger in its free space. Backups made when the database was upgraded to a
+// newer schema (the *.vN.bak files next to it) are left alone and still keep
+// the old entries.
+func deleteHistory(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+	var (
+		seqs    []int
+		pattern string
+	)
+	eval.ScanArgsVariadic(args, &seqs)
+	eval.ScanOpts(opts, eval.OptToScan{"pattern", &pattern, types.String("")})
+	if len(seqs) == 0 && pattern == "" {
+		throw(errNothingToDelete)
+	}
+
+	ed := ec.Editor.(*Editor)
+	if ed.daemon == nil {
+		throw(ErrStoreOffline)
+	}
+	for _, seq := range seqs {
+		maybeThrow(ed.daemon.RemoveCmd(seq))
+	}
+	if pattern != "" {
+		removed, err := ed.daemon.RemoveCmdsMatching(pattern)
+		maybeThrow(err)
+		seqs = append(seqs, removed...)
+	}
+	if ed.historyFuser != nil {
+		ed.historyFuser.Forget(seqs)
+	}
+	if len(seqs) > 0 {
+		_, _, err := ed.daemon.Compact()
+		maybeThrow(err)
+	}
+}
+
+// importHistory implements edit:import-history, which imports a history file
+// of bash, zsh or fish, or one exported by edit:export-history. The format is
+// guessed from the file name unless given as &format. Imported commands are
+// added after the existing ones.
+func importHistory(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+	var path, format string
+	eval.ScanArgs(args, &path)
+	eval.ScanOpts(opts, eval.OptToScan{"format", &format, types.String("")})
+	if format == "" {
+		format = history.DetectFormat(path)
+		if format == "" {
+			throw(errUnknownFormat)
+		}
+	}
+
+	ed := ec.Editor.(*Editor)
+	if ed.daemon == nil {
+		throw(ErrStoreOffline)
+	}
+	f, err := os.Open(path)
+	maybeThrow(err)
+	defer f.Close()
+	cmds, err := history.Parse(format, f)
+	maybeThrow(err)
+	maybeThrow(ed.daemon.AddCmds(cmds))
+}
+
+// exportHistory implements edit:export-history, which writes the whole command
+// history with metadata to the byte output as JSON lines.
+func exportHistory(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+	eval.TakeNoArg(args)
+	eval.TakeNoOpt(opts)
+
+	ed := ec.Editor.(*Editor)
+	if ed.daemon == nil {
+		throw(ErrStoreOffline)
+	}
+	next, err := ed.daemon.NextCmdSeq()
+	maybeThrow(err)
+	cmds, err := ed.daemon.CmdsWithMeta(0, next)
+	maybeThrow(err)
+	maybeThrow(history.WriteJSON(ec.OutputFile(), cmds))
+}
@@ -0,0 +1,41 @@
+package edit
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
+)
+
+func TestHistoryFilter(t *testing.T) {
+	ed := &Editor{evaler: eval.NewEvaler(), variables: makeVariables(),
+		notifyPort: &eval.Port{File: eval.DevNull, Chan: eval.BlackholeChan}}
+
+	// The default filter rejects lines starting with a space.
+	if !ed.historyFilterAccepts("ls") || ed.historyFilterAccepts(" export TOKEN=x") {
+		t.Errorf("default history filter does not reject only lines starting with space")
+	}
+
+	filter := &eval.BuiltinFn{Name: "filter", Impl: func(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+		line := string(args[0].(types.String))
+		if line == "fail" {
+			throw(errors.New("bad"))
+		}
+		ec.OutputChan() <- types.Bool(line != "secret")
+	}}
+	ed.variables["history:filter"].Set(filter)
+	for line, want := range map[string]bool{" ls": true, "secret": false, "fail": false} {
+		if got := ed.historyFilterAccepts(line); got != want {
+			t.Errorf("historyFilterAccepts(%q) -> %v, want %v", line, got, want)
+		}
+	}
+	if len(ed.notifications) != 1 {
+		t.Errorf("filter error not notified, notifications: %v", ed.notifications)
+	}
+
+	ed.SetHistoryPrivate(true)
+	if !ed.historyPrivate() {
+		t.Errorf("SetHistoryPrivate(true) did not set $edit:history:private")
+	}
+}
@@ -3,14 +3,16 @@ package edit
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/elves/elvish/eval"
 	"github.com/elves/elvish/eval/types"
 	"github.com/elves/elvish/eval/vartypes"
 )
 
-// The $le:{before,after}-readline lists that contain hooks. We might have more
-// hooks in future.
+// The $edit:{before,after}-readline and $edit:after-command lists that contain
+// hooks. We might have more hooks in future.
 
 var _ = RegisterVariable("before-readline", makeListVariable)
 
@@ -24,6 +26,41 @@ func (ed *Editor) afterReadLine() types.List {
 	return ed.variables["after-readline"].Get().(types.List)
 }
 
+var _ = RegisterVariable("after-command", makeListVariable)
+
+func (ed *Editor) afterCommand() types.List {
+	return ed.variables["after-command"].Get().(types.List)
+}
+
+// AfterCommand calls the hooks in $edit:after-command with a map describing a
+// command that has just been evaluated. The map contains the source text, the
+// start time as seconds since the Unix epoch, the duration in seconds and the
+// resulting exception, which is $ok if the command succeeded. The duration and
+// exception are also recorded in the command history.
+func (ed *Editor) AfterCommand(src string, start time.Time, duration time.Duration, err error) {
+	var exc *eval.Exception
+	switch err := err.(type) {
+	case nil:
+		exc = eval.OK
+	case *eval.Exception:
+		exc = err
+	default:
+		exc = &eval.Exception{Cause: err}
+	}
+	m := types.MakeMap(map[types.Value]types.Value{
+		types.String("src"):       types.String(src),
+		types.String("start"):     formatSeconds(float64(start.UnixNano()) / 1e9),
+		types.String("duration"):  formatSeconds(duration.Seconds()),
+		types.String("exception"): exc,
+	})
+	callHooks(ed.evaler, ed.afterCommand(), m)
+	ed.finishHistory(duration, err)
+}
+
+func formatSeconds(f float64) types.String {
+	return types.String(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
 func makeListVariable() vartypes.Variable {
 	return vartypes.NewValidatedPtr(types.EmptyList, vartypes.ShouldBeList)
 }
@@ -0,0 +1,38 @@
+package edit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
+)
+
+func TestAfterCommand(t *testing.T) {
+	var got types.Map
+	hook := &eval.BuiltinFn{Name: "hook", Impl: func(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+		got = args[0].(types.Map)
+	}}
+	ed := &Editor{evaler: eval.NewEvaler(), variables: makeVariables()}
+	ed.variables["after-command"].Set(types.MakeList(hook))
+
+	start := time.Unix(1500000000, 500000000)
+	ed.AfterCommand("echo foo", start, 1500*time.Millisecond, nil)
+	wants := map[string]types.Value{
+		"src": types.String("echo foo"), "start": types.String("1500000000.5"),
+		"duration": types.String("1.5"), "exception": eval.OK,
+	}
+	for k, want := range wants {
+		if v := got.IndexOne(types.String(k)); v != want {
+			t.Errorf("got[%s] = %v, want %v", k, v, want)
+		}
+	}
+
+	err := errors.New("bad")
+	ed.AfterCommand("fail bad", start, time.Second, err)
+	exc, ok := got.IndexOne(types.String("exception")).(*eval.Exception)
+	if !ok || exc.Cause != err {
+		t.Errorf("got[exception] = %v, want exception caused by %v", exc, err)
+	}
+}
@@ -61,6 +61,9 @@ type insert struct {
 	// Indicates whether a key was inserted (via insert-default). A hack for
 	// maintaining the inserts field.
 	insertedLiteral bool
+	// Indicates whether a select-* builtin was called. Used for unsetting
+	// marks set by these builtins.
+	selecting bool
 }
 
 // ui.Insert mode is the default mode and has an empty mode.
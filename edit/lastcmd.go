@@ -91,7 +91,9 @@ func lastcmdStart(ed *Editor) {
 		ed.Notify("db error: %s", err.Error())
 		return
 	}
-	ed.mode = newLastCmd(cmd)
+	l := newLastCmd(cmd)
+	l.initPreview(ed)
+	ed.mode = l
 }
 
 func lastcmdAltDefault(ed *Editor) {
@@ -4,11 +4,11 @@ import (
 	"container/list"
 	"errors"
 	"fmt"
-	"strings"
 	"unicode/utf8"
 
 	"github.com/elves/elvish/edit/ui"
 	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
 	"github.com/elves/elvish/eval/vartypes"
 	"github.com/elves/elvish/util"
 )
@@ -38,6 +38,7 @@ type listing struct {
 	filter      string
 	pagesize    int
 	headerWidth int
+	preview     *previewPane
 }
 
 type listingProvider interface {
@@ -48,12 +49,28 @@ type listingProvider interface {
 	ModeTitle(int) string
 }
 
+// moreLoader is implemented by listing providers that do not load all the
+// entries at once. More entries are loaded when the selection reaches the top.
+type moreLoader interface {
+	// LoadMore loads more entries, and returns the new index of the entry at
+	// index i, or -1 if there are no more entries.
+	LoadMore(i int) int
+}
+
 type placeholderer interface {
 	Placeholder() string
 }
 
+// matchedShower is implemented by listing providers that can tell which runes
+// of the shown content match the filter, which are then highlighted.
+type matchedShower interface {
+	// ShowMatched returns the byte offsets of the matched runes in the
+	// content of entry i.
+	ShowMatched(i int) []int
+}
+
 func newListing(t string, p listingProvider) listing {
-	l := listing{t, p, 0, "", 0, 0}
+	l := listing{t, p, 0, "", 0, 0, nil}
 	l.refresh()
 	for i := 0; i < p.Len(); i++ {
 		header, _ := p.Show(i)
@@ -65,6 +82,11 @@ func newListing(t string, p listingProvider) listing {
 	return l
 }
 
+// initPreview sets up the preview pane if there is a previewer for the mode.
+func (l *listing) initPreview(ed *Editor) {
+	l.preview = newPreviewPane(ed.evaler, ed.previewer(l.name))
+}
+
 func (l *listing) Binding(m map[string]vartypes.Variable, k ui.Key) eval.Fn {
 	if m[l.name] == nil {
 		return getBinding(m[modeListing], k)
@@ -120,14 +142,18 @@ func (l *listing) List(maxHeight int) ui.Renderer {
 	high := low
 	height := 0
 	var listOfLines list.List
-	getEntry := func(i int) []ui.Styled {
+	getEntry := func(i int) []matchedLine {
 		header, content := l.provider.Show(i)
-		lines := strings.Split(content.Text, "\n")
+		var matched []int
+		if ms, ok := l.provider.(matchedShower); ok {
+			matched = ms.ShowMatched(i)
+		}
+		lines, lineMatched := splitMatched(content.Text, matched)
 		styles := content.Styles
 		if i == l.selected {
 			styles = append(styles, styleForSelected...)
 		}
-		styleds := make([]ui.Styled, len(lines))
+		entry := make([]matchedLine, len(lines))
 		for i, line := range lines {
 			if l.headerWidth > 0 {
 				if i == 0 {
@@ -136,9 +162,12 @@ func (l *listing) List(maxHeight int) ui.Renderer {
 					line = fmt.Sprintf("%*s %s", l.headerWidth, "", line)
 				}
 			}
-			styleds[i] = ui.Styled{line, styles}
+			entry[i].Styled = ui.Styled{line, styles}
+			if lineMatched != nil {
+				entry[i].matched = shiftOffsets(lineMatched[i], len(line)-len(lines[i]))
+			}
 		}
-		return styleds
+		return entry
 	}
 	// We start by extending high, so that the first entry to include is
 	// l.selected.
@@ -176,18 +205,39 @@ func (l *listing) List(maxHeight int) ui.Renderer {
 
 	l.pagesize = high - low
 
-	// Convert the List to a slice.
+	// Convert the List to slices.
 	lines := make([]ui.Styled, 0, listOfLines.Len())
+	var matched [][]int
+	if _, ok := l.provider.(matchedShower); ok {
+		matched = make([][]int, 0, listOfLines.Len())
+	}
 	for p := listOfLines.Front(); p != nil; p = p.Next() {
-		lines = append(lines, p.Value.(ui.Styled))
+		line := p.Value.(matchedLine)
+		lines = append(lines, line.Styled)
+		if matched != nil {
+			matched = append(matched, line.matched)
+		}
 	}
 
-	ls := listingRenderer{lines}
+	ls := listingRenderer{lines, matched}
+	var r ui.Renderer = ls
 	if low > 0 || high < n || lastShownIncomplete {
 		// Need scrollbar
-		return listingWithScrollBarRenderer{ls, n, low, high, height}
+		r = listingWithScrollBarRenderer{ls, n, low, high, height}
 	}
-	return ls
+	if l.preview != nil && l.selected >= 0 {
+		r = l.preview.render(r, l.previewItem(l.selected), maxHeight)
+	}
+	return r
+}
+
+// previewItem returns the item to preview for entry i.
+func (l *listing) previewItem(i int) types.Value {
+	if pi, ok := l.provider.(previewItemer); ok {
+		return pi.PreviewItem(i)
+	}
+	_, content := l.provider.Show(i)
+	return types.String(content.Text)
 }
 
 func writeHorizontalScrollbar(b *ui.Buffer, n, low, high, width int) {
@@ -251,11 +301,25 @@ func (l *listing) backspace() bool {
 	return false
 }
 
+// loadMore asks the provider to load more entries, keeping the selection on
+// the same entry.
+func (l *listing) loadMore() {
+	if ml, ok := l.provider.(moreLoader); ok && l.selected >= 0 {
+		if i := ml.LoadMore(l.selected); i >= 0 {
+			l.selected = i
+		}
+	}
+}
+
 func (l *listing) up(cycle bool) {
 	n := l.provider.Len()
 	if n == 0 {
 		return
 	}
+	if l.selected == 0 {
+		l.loadMore()
+		n = l.provider.Len()
+	}
 	l.selected--
 	if l.selected == -1 {
 		if cycle {
@@ -271,6 +335,9 @@ func (l *listing) pageUp() {
 	if n == 0 {
 		return
 	}
+	if l.selected < l.pagesize {
+		l.loadMore()
+	}
 	l.selected -= l.pagesize
 	if l.selected < 0 {
 		l.selected = 0
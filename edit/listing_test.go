@@ -41,7 +41,7 @@ func TestListing(t *testing.T) {
 		listingRenderer: listingRenderer{[]ui.Styled{
 			{"0 foo", styleForSelected},
 			{"1 bar", ui.Styles{}},
-		}},
+		}, nil},
 		n: 5, low: 0, high: 2, height: 2,
 	})
 	// Selecting the last element and rendering with height=2. We expect to see
@@ -50,7 +50,7 @@ func TestListing(t *testing.T) {
 		listingRenderer: listingRenderer{[]ui.Styled{
 			{"3 lorem", ui.Styles{}},
 			{"4 ipsum", styleForSelected},
-		}},
+		}, nil},
 		n: 5, low: 3, high: 5, height: 2,
 	})
 	// Selecting the middle element and rendering with height=3. We expect to
@@ -61,7 +61,7 @@ func TestListing(t *testing.T) {
 			{"1 bar", ui.Styles{}},
 			{"2 foobar", styleForSelected},
 			{"3 lorem", ui.Styles{}},
-		}},
+		}, nil},
 		n: 5, low: 1, high: 4, height: 3,
 	})
 }
@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"math"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/elves/elvish/edit/ui"
 	"github.com/elves/elvish/eval"
@@ -20,7 +23,8 @@ import (
 // Location mode.
 
 var _ = registerBuiltins(modeLocation, map[string]func(*Editor){
-	"start": locStart,
+	"start":  locStart,
+	"remove": locRemove,
 })
 
 // PinnedScore is a special value of Score in storedefs.Dir to represent that the
@@ -31,6 +35,10 @@ type location struct {
 	home     string // The home directory; leave empty if unknown.
 	all      []storedefs.Dir
 	filtered []storedefs.Dir
+	// When the working directory is inside a workspace, the root of the
+	// workspace and the paths that each relative directory is merged from.
+	wsRoot  string
+	sources map[string][]string
 }
 
 func newLocation(dirs []storedefs.Dir, home string) *listing {
@@ -58,14 +66,20 @@ func (loc *location) Show(i int) (string, ui.Styled) {
 	} else {
 		header = fmt.Sprintf("%.0f", score)
 	}
-	return header, ui.Unstyled(showPath(loc.filtered[i].Path, loc.home))
+	return header, ui.Unstyled(loc.showPath(loc.filtered[i].Path))
+}
+
+// PreviewItem returns the full path of the directory, which is shown
+// abbreviated.
+func (loc *location) PreviewItem(i int) types.Value {
+	return types.String(loc.absPath(loc.filtered[i].Path))
 }
 
 func (loc *location) Filter(filter string) int {
 	loc.filtered = nil
 	pattern := makeLocationFilterPattern(filter)
 	for _, item := range loc.all {
-		if pattern.MatchString(showPath(item.Path, loc.home)) {
+		if pattern.MatchString(loc.showPath(item.Path)) {
 			loc.filtered = append(loc.filtered, item)
 		}
 	}
@@ -76,6 +90,14 @@ func (loc *location) Filter(filter string) int {
 	return 0
 }
 
+func (loc *location) showPath(path string) string {
+	if loc.wsRoot != "" && !filepath.IsAbs(path) {
+		// Relative to the workspace root.
+		return parse.Quote(path)
+	}
+	return showPath(path, loc.home)
+}
+
 func showPath(path, home string) string {
 	if home != "" && path == home {
 		return "~"
@@ -110,7 +132,7 @@ func makeLocationFilterPattern(s string) *regexp.Regexp {
 // Editor interface.
 
 func (loc *location) Accept(i int, ed *Editor) {
-	err := eval.Chdir(loc.filtered[i].Path, ed.daemon)
+	err := eval.Chdir(loc.absPath(loc.filtered[i].Path), ed.daemon)
 	if err != nil {
 		ed.Notify("%v", err)
 	}
@@ -135,6 +157,7 @@ func locStart(ed *Editor) {
 		ed.Notify("store error: %v", err)
 		return
 	}
+	rescoreDirs(stored, time.Now().Unix(), ed.locHalfLife())
 
 	// Concatenate pinned and stored dirs, pinned first.
 	pinned := convertListToDirs(ed.locPinned())
@@ -145,7 +168,74 @@ func locStart(ed *Editor) {
 	// Drop the error. When there is an error, home is "", which is used to
 	// signify "no home known" in location.
 	home, _ := util.GetHome("")
-	ed.mode = newLocation(dirs, home)
+	l := newLocation(dirs, home)
+	if pwd != "" {
+		loc := l.provider.(*location)
+		loc.wsRoot, loc.all, loc.sources = scopeDirsToWorkspace(
+			dirs, pwd, ed.locWorkspaces())
+		l.refresh()
+	}
+	l.initPreview(ed)
+	ed.mode = l
+}
+
+// rescoreDirs recomputes the scores of directories from their visits with the
+// given half-life, and sorts them accordingly.
+func rescoreDirs(dirs []storedefs.Dir, now int64, halfLife float64) {
+	for i := range dirs {
+		dirs[i].Score = storedefs.Frecency(dirs[i].Visits, now, halfLife)
+	}
+	sortDirsByScore(dirs)
+}
+
+func locRemove(ed *Editor) {
+	l, ok := ed.mode.(*listing)
+	if !ok {
+		return
+	}
+	loc, ok := l.provider.(*location)
+	if !ok || l.selected < 0 {
+		return
+	}
+	dir := loc.filtered[l.selected]
+	if dir.Score == PinnedScore {
+		ed.Notify("cannot remove pinned directory %s", dir.Path)
+		return
+	}
+	if ed.daemon == nil {
+		ed.Notify("%v", ErrStoreOffline)
+		return
+	}
+	paths := loc.sources[dir.Path]
+	if paths == nil {
+		paths = []string{dir.Path}
+	}
+	for _, path := range paths {
+		err := ed.daemon.RemoveDir(path)
+		if err != nil {
+			ed.Notify("store error: %v", err)
+			return
+		}
+	}
+	loc.remove(dir.Path)
+
+	selected := l.selected
+	l.refresh()
+	if n := loc.Len(); selected >= n {
+		selected = n - 1
+	}
+	l.selected = selected
+}
+
+// remove removes a directory from the list.
+func (loc *location) remove(path string) {
+	for i, dir := range loc.all {
+		if dir.Path == path {
+			loc.all = append(loc.all[:i:i], loc.all[i+1:]...)
+			break
+		}
+	}
+	delete(loc.sources, path)
 }
 
 // convertListToDirs converts a list of strings to []storedefs.Dir. It uses the
@@ -155,7 +245,7 @@ func convertListToDirs(li types.List) []storedefs.Dir {
 	// XXX(xiaq): silently drops non-string items.
 	li.Iterate(func(v types.Value) bool {
 		if s, ok := v.(types.String); ok {
-			pinned = append(pinned, storedefs.Dir{string(s), PinnedScore})
+			pinned = append(pinned, storedefs.Dir{Path: string(s), Score: PinnedScore})
 		}
 		return true
 	})
@@ -193,3 +283,18 @@ var _ = RegisterVariable("loc-pinned", func() vartypes.Variable {
 func (ed *Editor) locPinned() types.List {
 	return ed.variables["loc-pinned"].Get().(types.List)
 }
+
+// The half-life of the contribution of each visit to the score of a directory,
+// in seconds.
+var _ = RegisterVariable("loc-half-life", func() vartypes.Variable {
+	return vartypes.NewValidatedPtr(
+		types.String(strconv.Itoa(storedefs.DefaultDirHalfLife)), vartypes.ShouldBeNumber)
+})
+
+func (ed *Editor) locHalfLife() float64 {
+	f, _ := strconv.ParseFloat(string(ed.variables["loc-half-life"].Get().(types.String)), 64)
+	if f <= 0 {
+		return storedefs.DefaultDirHalfLife
+	}
+	return f
+}
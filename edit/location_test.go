@@ -1,6 +1,8 @@
 package edit
 
 import (
+	"reflect"
+	"regexp"
 	"testing"
 
 	"github.com/elves/elvish/edit/ui"
@@ -9,12 +11,12 @@ import (
 
 var (
 	theLocation = newLocation([]storedefs.Dir{
-		{"/pinned", PinnedScore},
-		{"/src/github.com/elves/elvish", 300},
-		{"/src/home/xyz", 233},
-		{"/home/dir", 100},
-		{"/foo/\nbar", 77},
-		{"/usr/elves/elvish", 6},
+		{Path: "/pinned", Score: PinnedScore},
+		{Path: "/src/github.com/elves/elvish", Score: 300},
+		{Path: "/src/home/xyz", Score: 233},
+		{Path: "/home/dir", Score: 100},
+		{Path: "/foo/\nbar", Score: 77},
+		{Path: "/usr/elves/elvish", Score: 6},
 	}, "/home")
 
 	locationFilterTests = []listingFilterTestCases{
@@ -48,3 +50,50 @@ var (
 func TestLocation(t *testing.T) {
 	testListingFilter(t, "theLocation", theLocation, locationFilterTests)
 }
+
+func TestRescoreDirs(t *testing.T) {
+	dirs := []storedefs.Dir{
+		{Path: "/old", Visits: []storedefs.DirVisit{{Time: 0, Weight: 1}}},
+		{Path: "/new", Visits: []storedefs.DirVisit{{Time: 100, Weight: 1}}},
+	}
+	rescoreDirs(dirs, 100, 100)
+	if dirs[0].Path != "/new" || dirs[0].Score != 10 || dirs[1].Score != 5 {
+		t.Errorf("rescoreDirs -> %v", dirs)
+	}
+}
+
+func TestScopeDirsToWorkspace(t *testing.T) {
+	workspaces := []locWorkspace{
+		{"ws", regexp.MustCompile(`^(?:/ws/[^/]+)`)},
+	}
+	dirs := []storedefs.Dir{
+		{Path: "/ws/a/src", Score: 10},
+		{Path: "/ws/b/src", Score: 5},
+		{Path: "/ws/b", Score: 3},
+		{Path: "/ws/a/doc", Score: 20},
+		{Path: "/home", Score: 12},
+		{Path: "/wsx/a", Score: 1},
+	}
+
+	root, scoped, sources := scopeDirsToWorkspace(dirs, "/ws/a/doc", workspaces)
+	wantScoped := []storedefs.Dir{
+		{Path: "src", Score: 15},
+		{Path: "/home", Score: 12},
+		{Path: ".", Score: 3},
+		{Path: "/wsx/a", Score: 1},
+	}
+	wantSources := map[string][]string{
+		"src": {"/ws/a/src", "/ws/b/src"},
+		".":   {"/ws/b"},
+	}
+	if root != "/ws/a" || !reflect.DeepEqual(scoped, wantScoped) || !reflect.DeepEqual(sources, wantSources) {
+		t.Errorf("scopeDirsToWorkspace -> (%q, %v, %v), want (%q, %v, %v)",
+			root, scoped, sources, "/ws/a", wantScoped, wantSources)
+	}
+
+	// Outside workspaces, directories are unchanged.
+	root, scoped, _ = scopeDirsToWorkspace(dirs, "/home", workspaces)
+	if root != "" || !reflect.DeepEqual(scoped, dirs) {
+		t.Errorf("scopeDirsToWorkspace -> (%q, %v), want (\"\", %v)", root, scoped, dirs)
+	}
+}
@@ -0,0 +1,140 @@
+package edit
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/elves/elvish/eval/types"
+	"github.com/elves/elvish/eval/vartypes"
+	"github.com/elves/elvish/store/storedefs"
+)
+
+// Workspaces in location mode.
+//
+// $edit:loc-workspaces maps names of workspace kinds to patterns, which are
+// regular expressions matching the roots of workspaces, e.g.:
+//
+//     edit:loc-workspaces = [&go='/home/me/go/src/[^/]+/[^/]+/[^/]+']
+//
+// When the working directory is inside a workspace, the directories inside all
+// workspaces of the same kind are shown relative to their roots, and changing
+// to them is relative to the root of the current workspace. Directories with
+// the same relative path are merged, with their scores added up.
+
+var _ = RegisterVariable("loc-workspaces", func() vartypes.Variable {
+	return vartypes.NewValidatedPtr(types.EmptyMap, vartypes.ShouldBeMap)
+})
+
+type locWorkspace struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// locWorkspaces parses $edit:loc-workspaces. Invalid entries are reported and
+// ignored.
+func (ed *Editor) locWorkspaces() []locWorkspace {
+	var workspaces []locWorkspace
+	m := ed.variables["loc-workspaces"].Get().(types.Map)
+	m.IteratePair(func(k, v types.Value) bool {
+		name, ok1 := k.(types.String)
+		pattern, ok2 := v.(types.String)
+		if !ok1 || !ok2 {
+			ed.Notify("workspace name and pattern must be strings")
+			return true
+		}
+		re, err := regexp.Compile("^(?:" + string(pattern) + ")")
+		if err != nil {
+			ed.Notify("bad pattern for workspace %s: %v", name, err)
+			return true
+		}
+		workspaces = append(workspaces, locWorkspace{string(name), re})
+		return true
+	})
+	sort.Slice(workspaces, func(i, j int) bool {
+		return workspaces[i].name < workspaces[j].name
+	})
+	return workspaces
+}
+
+// root returns the root of the workspace that path is in, or "" if path is not
+// inside a workspace of this kind.
+func (ws locWorkspace) root(path string) string {
+	loc := ws.pattern.FindStringIndex(path)
+	if loc == nil {
+		return ""
+	}
+	end := loc[1]
+	// The root must be a whole directory.
+	if end == 0 || (end < len(path) && path[end] != '/') {
+		return ""
+	}
+	return path[:end]
+}
+
+// relToRoot returns the path relative to the workspace root.
+func relToRoot(path, root string) string {
+	rel := strings.TrimPrefix(path[len(root):], "/")
+	if rel == "" {
+		return "."
+	}
+	return rel
+}
+
+// scopeDirsToWorkspace scopes dirs to the workspace that pwd is in, if any. It
+// returns the root of the workspace, the scoped directories, and the paths of
+// the original directories that each relative directory is merged from.
+func scopeDirsToWorkspace(dirs []storedefs.Dir, pwd string, workspaces []locWorkspace) (string, []storedefs.Dir, map[string][]string) {
+	var ws locWorkspace
+	wsRoot := ""
+	for _, ws = range workspaces {
+		if wsRoot = ws.root(pwd); wsRoot != "" {
+			break
+		}
+	}
+	if wsRoot == "" {
+		return "", dirs, nil
+	}
+
+	pwdRel := relToRoot(pwd, wsRoot)
+	var scoped []storedefs.Dir
+	sources := make(map[string][]string)
+	indexOfRel := make(map[string]int)
+	for _, dir := range dirs {
+		root := ws.root(dir.Path)
+		if root == "" {
+			scoped = append(scoped, dir)
+			continue
+		}
+		rel := relToRoot(dir.Path, root)
+		if rel == pwdRel {
+			continue
+		}
+		sources[rel] = append(sources[rel], dir.Path)
+		if i, ok := indexOfRel[rel]; ok {
+			scoped[i].Score += dir.Score
+			continue
+		}
+		indexOfRel[rel] = len(scoped)
+		scoped = append(scoped, storedefs.Dir{Path: rel, Score: dir.Score})
+	}
+	sortDirsByScore(scoped)
+	return wsRoot, scoped, sources
+}
+
+// sortDirsByScore sorts directories by their scores in descending order,
+// keeping the order of directories with the same score.
+func sortDirsByScore(dirs []storedefs.Dir) {
+	sort.SliceStable(dirs, func(i, j int) bool {
+		return dirs[i].Score > dirs[j].Score
+	})
+}
+
+// absPath returns the absolute path of a directory shown in location mode.
+func (loc *location) absPath(path string) string {
+	if loc.wsRoot == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(loc.wsRoot, path)
+}
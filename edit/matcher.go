@@ -24,10 +24,13 @@ var (
 		"edit:match-substr", wrapMatcher(strings.Contains)}
 	matchSubseq = &eval.BuiltinFn{
 		"edit:match-subseq", wrapMatcher(util.HasSubseq)}
+	matchFuzzy = &eval.BuiltinFn{
+		"edit:match-fuzzy", wrapMatcher(matchFuzzyPredicate)}
 	matchers = []*eval.BuiltinFn{
 		matchPrefix,
 		matchSubstr,
 		matchSubseq,
+		matchFuzzy,
 	}
 
 	_ = RegisterVariable("-matcher", func() vartypes.Variable {
@@ -48,16 +51,19 @@ func (ed *Editor) lookupMatcher(name string) (eval.Fn, bool) {
 	return matcher, ok
 }
 
+// matcherOptions are the options accepted by the builtin matchers.
+type matcherOptions struct {
+	IgnoreCase bool
+	SmartCase  bool
+}
+
 func wrapMatcher(matcher func(s, p string) bool) eval.BuiltinFnImpl {
 	return func(ec *eval.Frame,
 		args []types.Value, opts map[string]types.Value) {
 
 		var pattern types.String
 		iterate := eval.ScanArgsOptionalInput(ec, args, &pattern)
-		var options struct {
-			IgnoreCase bool
-			SmartCase  bool
-		}
+		var options matcherOptions
 		eval.ScanOptsToStruct(opts, &options)
 		switch {
 		case options.IgnoreCase && options.SmartCase:
@@ -27,6 +27,7 @@ var _ = registerBuiltins(modeNarrow, map[string]func(*Editor){
 		getNarrow(ed).accept(ed)
 		insertStart(ed)
 	},
+	"toggle-mark": func(ed *Editor) { getNarrow(ed).toggleMark() },
 	"toggle-ignore-duplication": func(ed *Editor) {
 		l := getNarrow(ed)
 		l.opts.IgnoreDuplication = !l.opts.IgnoreDuplication
@@ -41,7 +42,8 @@ var _ = registerBuiltins(modeNarrow, map[string]func(*Editor){
 })
 
 // narrow implements a listing mode that supports the notion of selecting an
-// entry and filtering entries.
+// entry and filtering entries. Entries can also be marked, in which case
+// accepting passes all the marked entries to the action.
 type narrow struct {
 	name        string
 	selected    int
@@ -51,10 +53,17 @@ type narrow struct {
 
 	placehold string
 	source    func() []narrowItem
-	action    func(*Editor, narrowItem)
-	match     func(string, string) bool
+	action    func(*Editor, []narrowItem)
 	filtered  []narrowItem
-	opts      narrowOptions
+	// Byte offsets of runes in the display text of each filtered item that
+	// match the filter. When the display text differs from the filter text,
+	// this is nil until the item is rendered.
+	matched [][]int
+	fuzzy   fuzzyMatcher
+	// Marked items, in the order they were marked.
+	marked  []narrowItem
+	opts    narrowOptions
+	preview *previewPane
 }
 
 func (l *narrow) Binding(m map[string]vartypes.Variable, k ui.Key) eval.Fn {
@@ -79,6 +88,9 @@ func (l *narrow) ModeLine() ui.Renderer {
 	if l.opts.IgnoreDuplication {
 		opt = append(opt, "D")
 	}
+	if len(l.marked) > 0 {
+		opt = append(opt, strconv.Itoa(len(l.marked))+" marked")
+	}
 	if len(opt) != 0 {
 		ml += "[" + strings.Join(opt, " ") + "]"
 	}
@@ -112,18 +124,42 @@ func (l *narrow) List(maxHeight int) ui.Renderer {
 	high := low
 	height := 0
 	var listOfLines list.List
-	getEntry := func(i int) []ui.Styled {
+	getEntry := func(i int) []matchedLine {
 		display := l.filtered[i].Display()
-		lines := strings.Split(display.Text, "\n")
+		if l.matched[i] == nil && l.filter != "" {
+			// The filter text may differ from the display text; only
+			// highlight when the filter can also be found in the latter.
+			_, matched, _ := l.fuzzy.match(display.Text, l.filter, l.opts.IgnoreCase)
+			if matched == nil {
+				matched = []int{}
+			}
+			l.matched[i] = matched
+		}
+		lines, matched := splitMatched(display.Text, l.matched[i])
 		styles := display.Styles
+		isMarked := l.markIndex(l.filtered[i]) != -1
+		if isMarked {
+			styles = append(styles, styleForMarked...)
+		}
 		if i == l.selected {
 			styles = append(styles, styleForSelected...)
 		}
-		styleds := make([]ui.Styled, len(lines))
+		entry := make([]matchedLine, len(lines))
 		for i, line := range lines {
-			styleds[i] = ui.Styled{line, styles}
+			// When some items are marked, show a gutter with markers.
+			gutter := ""
+			if len(l.marked) > 0 {
+				gutter = "  "
+				if i == 0 && isMarked {
+					gutter = "* "
+				}
+			}
+			entry[i].Styled = ui.Styled{gutter + line, styles}
+			if matched != nil {
+				entry[i].matched = shiftOffsets(matched[i], len(gutter))
+			}
 		}
-		return styleds
+		return entry
 	}
 	// We start by extending high, so that the first entry to include is
 	// l.selected.
@@ -161,18 +197,36 @@ func (l *narrow) List(maxHeight int) ui.Renderer {
 
 	l.pagesize = high - low
 
-	// Convert the List to a slice.
+	// Convert the List to slices.
 	lines := make([]ui.Styled, 0, listOfLines.Len())
+	matched := make([][]int, 0, listOfLines.Len())
 	for p := listOfLines.Front(); p != nil; p = p.Next() {
-		lines = append(lines, p.Value.(ui.Styled))
+		line := p.Value.(matchedLine)
+		lines = append(lines, line.Styled)
+		matched = append(matched, line.matched)
 	}
 
-	ls := listingRenderer{lines}
+	ls := listingRenderer{lines, matched}
+	var r ui.Renderer = ls
 	if low > 0 || high < n || lastShownIncomplete {
 		// Need scrollbar
-		return listingWithScrollBarRenderer{ls, n, low, high, height}
+		r = listingWithScrollBarRenderer{ls, n, low, high, height}
 	}
-	return ls
+	if l.preview != nil && l.selected >= 0 {
+		r = l.preview.render(r, narrowItemValue(l.filtered[l.selected]), maxHeight)
+	}
+	return r
+}
+
+// narrowItemValue returns the string or map output by the source for an item.
+func narrowItemValue(item narrowItem) types.Value {
+	switch item := item.(type) {
+	case *narrowItemString:
+		return item.String
+	case *narrowItemComplex:
+		return item.Map
+	}
+	return item
 }
 
 func (l *narrow) refresh() {
@@ -181,21 +235,15 @@ func (l *narrow) refresh() {
 		candidates = l.source()
 	}
 	l.filtered = make([]narrowItem, 0, len(candidates))
-
-	filter := l.filter
-	if l.opts.IgnoreCase {
-		filter = strings.ToLower(filter)
-	}
+	l.matched = make([][]int, 0, len(candidates))
+	var scores []int
 
 	set := make(map[string]struct{})
 
 	for _, item := range candidates {
 		text := item.FilterText()
-		s := text
-		if l.opts.IgnoreCase {
-			s = strings.ToLower(s)
-		}
-		if !l.match(s, filter) {
+		score, matched, ok := l.fuzzy.match(text, l.filter, l.opts.IgnoreCase)
+		if !ok {
 			continue
 		}
 		if l.opts.IgnoreDuplication {
@@ -204,7 +252,27 @@ func (l *narrow) refresh() {
 			}
 			set[text] = struct{}{}
 		}
+		if item.Display().Text != text {
+			// Computed when the item is rendered.
+			matched = nil
+		}
 		l.filtered = append(l.filtered, item)
+		l.matched = append(l.matched, matched)
+		scores = append(scores, score)
+	}
+
+	if l.filter != "" {
+		if l.opts.KeepBottom {
+			// The selected item is at the bottom, so put the best matches
+			// there.
+			for i := range scores {
+				scores[i] = -scores[i]
+			}
+		}
+		rankByScores(scores, func(i, j int) {
+			l.filtered[i], l.filtered[j] = l.filtered[j], l.filtered[i]
+			l.matched[i], l.matched[j] = l.matched[j], l.matched[i]
+		})
 	}
 
 	if l.opts.KeepBottom {
@@ -280,9 +348,42 @@ func (l *narrow) pageDown() {
 	}
 }
 
+// markIndex returns the index of the item in the marked items, or -1 if it is
+// not marked. Items are compared by value, since the source is called again
+// whenever the filter changes.
+func (l *narrow) markIndex(item narrowItem) int {
+	value := narrowItemValue(item)
+	for i, marked := range l.marked {
+		if value.Equal(narrowItemValue(marked)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// toggleMark toggles the mark of the selected item and selects the next one.
+func (l *narrow) toggleMark() {
+	if l.selected < 0 || l.selected >= len(l.filtered) {
+		return
+	}
+	item := l.filtered[l.selected]
+	if i := l.markIndex(item); i != -1 {
+		l.marked = append(l.marked[:i], l.marked[i+1:]...)
+	} else {
+		l.marked = append(l.marked, item)
+	}
+	l.down(false)
+}
+
+// accept calls the action with the marked items, or the selected item if none
+// is marked.
 func (l *narrow) accept(ed *Editor) {
-	if l.selected >= 0 {
-		l.action(ed, l.filtered[l.selected])
+	if len(l.marked) > 0 {
+		marked := l.marked
+		l.marked = nil
+		l.action(ed, marked)
+	} else if l.selected >= 0 {
+		l.action(ed, []narrowItem{l.filtered[l.selected]})
 	}
 }
 
@@ -332,6 +433,7 @@ type narrowOptions struct {
 	KeepBottom        bool
 	MaxLines          int
 	Modeline          string
+	Preview           eval.Fn
 
 	bindingMap map[ui.Key]eval.Fn
 }
@@ -398,6 +500,25 @@ func NarrowRead(ec *eval.Frame, args []types.Value, opts map[string]types.Value)
 	}
 
 	eval.ScanArgs(args, &source, &action)
+	scanNarrowOptions(opts, l)
+
+	ed := ec.Editor.(*Editor)
+	l.source = narrowGetSource(ec, source)
+	l.action = func(ed *Editor, items []narrowItem) {
+		args := make([]types.Value, len(items))
+		for i, item := range items {
+			args[i] = item
+		}
+		ed.CallFn(action, args...)
+	}
+	l.initPreview(ed)
+
+	l.changeFilter("")
+	ed.mode = l
+}
+
+// scanNarrowOptions scans the options of edit:-narrow-read and edit:pick.
+func scanNarrowOptions(opts map[string]types.Value, l *narrow) {
 	eval.ScanOptsToStruct(opts, &l.opts)
 
 	l.opts.Bindings.IterateKey(func(k types.Value) bool {
@@ -410,17 +531,16 @@ func NarrowRead(ec *eval.Frame, args []types.Value, opts map[string]types.Value)
 		l.opts.bindingMap[key] = f.(eval.Fn)
 		return true
 	})
+}
 
-	l.source = narrowGetSource(ec, source)
-	l.action = func(ed *Editor, item narrowItem) {
-		ed.CallFn(action, item)
+// initPreview sets up the preview pane with the previewer from the options,
+// or $edit:previewer[narrow].
+func (l *narrow) initPreview(ed *Editor) {
+	previewer := l.opts.Preview
+	if previewer == nil {
+		previewer = ed.previewer(modeNarrow)
 	}
-	// TODO: user customize varible
-	l.match = strings.Contains
-
-	l.changeFilter("")
-	ed := ec.Editor.(*Editor)
-	ed.mode = l
+	l.preview = newPreviewPane(ed.evaler, previewer)
 }
 
 func narrowGetSource(ec *eval.Frame, source eval.Fn) func() []narrowItem {
@@ -455,7 +575,10 @@ func CommandHistory(ec *eval.Frame, args []types.Value, opts map[string]types.Va
 
 	out := ec.OutputChan()
 	ed := ec.Editor.(*Editor)
-	cmds, err := ed.historyFuser.AllCmds()
+	if ed.historyFuser == nil {
+		return
+	}
+	cmds, err := ed.historyFuser.AllCmdsWithMeta()
 	if err != nil {
 		return
 	}
@@ -486,7 +609,8 @@ func CommandHistory(ec *eval.Frame, args []types.Value, opts map[string]types.Va
 	for i := start; i < end; i++ {
 		out <- types.MakeMap(map[types.Value]types.Value{
 			types.String("id"):  types.String(strconv.Itoa(i)),
-			types.String("cmd"): types.String(cmds[i]),
+			types.String("seq"): types.String(strconv.Itoa(cmds[i].Seq)),
+			types.String("cmd"): types.String(cmds[i].Text),
 		})
 	}
 }
@@ -0,0 +1,91 @@
+package edit
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/elves/elvish/edit/ui"
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
+)
+
+func newTestNarrow(items ...string) *narrow {
+	l := &narrow{
+		source: func() []narrowItem {
+			var nis []narrowItem
+			for _, item := range items {
+				nis = append(nis, &narrowItemString{types.String(item)})
+			}
+			return nis
+		},
+	}
+	l.changeFilter("")
+	return l
+}
+
+func TestNarrowMark(t *testing.T) {
+	l := newTestNarrow("foo", "bar", "lorem")
+	var accepted []types.Value
+	l.action = func(ed *Editor, items []narrowItem) {
+		accepted = nil
+		for _, item := range items {
+			accepted = append(accepted, narrowItemValue(item))
+		}
+	}
+
+	// Without marks, the selected item is accepted.
+	l.accept(nil)
+	if want := []types.Value{types.String("foo")}; !reflect.DeepEqual(accepted, want) {
+		t.Errorf("accepted %v, want %v", accepted, want)
+	}
+
+	// Marking moves the selection down. Marks survive changing the filter.
+	l.toggleMark()
+	l.changeFilter("lo")
+	l.toggleMark()
+	l.changeFilter("")
+	if l.selected != 0 || len(l.marked) != 2 {
+		t.Errorf("selected = %d, %d marked, want 0, 2", l.selected, len(l.marked))
+	}
+
+	want := listingRenderer{[]ui.Styled{
+		{"* foo", append(ui.Styles{}, append(styleForMarked, styleForSelected...)...)},
+		{"  bar", ui.Styles{}},
+		{"* lorem", append(ui.Styles{}, styleForMarked...)},
+	}, [][]int{nil, nil, nil}}
+	if r := l.List(10); !reflect.DeepEqual(r, want) {
+		t.Errorf("List -> %v, want %v", r, want)
+	}
+
+	// Toggling again unmarks.
+	l.toggleMark()
+	l.accept(nil)
+	if want := []types.Value{types.String("lorem")}; !reflect.DeepEqual(accepted, want) {
+		t.Errorf("accepted %v, want %v", accepted, want)
+	}
+	if len(l.marked) != 0 {
+		t.Errorf("marks not cleared after accepting")
+	}
+}
+
+func TestPickDefaultBindings(t *testing.T) {
+	l := newTestNarrow("foo")
+	custom := builtinMaps[modeNarrow]["accept"]
+	l.opts.bindingMap = map[ui.Key]eval.Fn{{ui.Enter, 0}: custom}
+	addPickDefaultBindings(l)
+	bindings := makeBindings()
+
+	// Keys bound with &bindings are kept.
+	if f := l.Binding(bindings, ui.Key{ui.Enter, 0}); f != custom {
+		t.Errorf("Enter bound to %v, want %v", f, custom)
+	}
+	// The picker can be left even when $edit:narrow:binding is empty.
+	if f := l.Binding(bindings, ui.Key{'[', ui.Ctrl}); f != builtinMaps[modeInsert]["start"] {
+		t.Errorf("C-[ bound to %v, want edit:insert:start", f)
+	}
+	for k, f := range pickDefaultBindings() {
+		if f.(*BuiltinFn) == nil {
+			t.Errorf("default binding of %v is not a builtin", k)
+		}
+	}
+}
@@ -2,9 +2,9 @@ package edit
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"path"
-	"sort"
 	"strings"
 	"unicode/utf8"
 
@@ -35,6 +35,17 @@ var _ = registerBuiltins(modeNavigation, map[string]func(*Editor){
 	"insert-selected":          navInsertSelected,
 	"insert-selected-and-quit": navInsertSelectedAndQuit,
 	"default":                  navDefault,
+
+	"toggle-mark":   navToggleMark,
+	"clear-marks":   navClearMarks,
+	"rename":        navRename,
+	"delete":        navDelete,
+	"mkdir":         navMkdir,
+	"copy-marked":   navCopyMarked,
+	"move-marked":   navMoveMarked,
+	"sort-by-name":  navSortByName,
+	"sort-by-size":  navSortBySize,
+	"sort-by-mtime": navSortByMtime,
 })
 
 type navigation struct {
@@ -45,6 +56,12 @@ type navigation struct {
 	filtering  bool
 	filter     string
 	chdir      func(string) error
+	// Absolute paths of marked files.
+	marked map[string]bool
+	sortBy navSortKey
+	// The prompt shown in the mode line, if any. When it is non-nil, all keys
+	// go to the prompt.
+	prompt *navPrompt
 }
 
 type navPreview interface {
@@ -52,7 +69,11 @@ type navPreview interface {
 	List(int) ui.Renderer
 }
 
-func (*navigation) Binding(m map[string]vartypes.Variable, k ui.Key) eval.Fn {
+func (n *navigation) Binding(m map[string]vartypes.Variable, k ui.Key) eval.Fn {
+	if n.prompt != nil {
+		// Let the default binding feed the key to the prompt.
+		return getBinding(m[modeNavigation], ui.Default)
+	}
 	return getBinding(m[modeNavigation], k)
 }
 
@@ -61,11 +82,20 @@ func (n *navigation) ModeLine() ui.Renderer {
 	if n.showHidden {
 		title += "(show hidden) "
 	}
+	if n.sortBy != sortByName {
+		title += "(by " + n.sortBy.String() + ") "
+	}
+	if len(n.marked) > 0 {
+		title += fmt.Sprintf("(%d marked) ", len(n.marked))
+	}
+	if n.prompt != nil {
+		return modeLineRenderer{title + n.prompt.title, n.prompt.text}
+	}
 	return modeLineRenderer{title, n.filter}
 }
 
 func (n *navigation) CursorOnModeLine() bool {
-	return n.filtering
+	return n.filtering || n.prompt != nil
 }
 
 func navStart(ed *Editor) {
@@ -139,7 +169,9 @@ func navDefault(ed *Editor) {
 	// Use key binding for insert mode without exiting nigation mode.
 	k := ed.lastKey
 	n := &ed.navigation
-	if n.filtering && likeChar(k) {
+	if n.prompt != nil {
+		n.handlePromptKey(ed, k)
+	} else if n.filtering && likeChar(k) {
 		n.filter += k.String()
 		n.refreshCurrent()
 		n.refreshDirPreview()
@@ -167,14 +199,27 @@ func initNavigation(n *navigation, ed *Editor) {
 	n.refresh()
 }
 
-func (n *navigation) maintainSelected(name string) {
+// maintainSelected selects the file with the given name. If there is no such
+// file, it selects the file before where it would be when sorting by name, or
+// the first file otherwise. It returns whether the file was found.
+func (n *navigation) maintainSelected(name string) bool {
+	for i, s := range n.current.candidates {
+		if s.Text == name {
+			n.current.selected = i
+			return true
+		}
+	}
 	n.current.selected = 0
+	if n.sortBy != sortByName {
+		return false
+	}
 	for i, s := range n.current.candidates {
 		if s.Text > name {
 			break
 		}
 		n.current.selected = i
 	}
+	return false
 }
 
 func (n *navigation) refreshCurrent() {
@@ -184,13 +229,19 @@ func (n *navigation) refreshCurrent() {
 		n.current = newErrNavColumn(err)
 		return
 	}
-	// Try to select the old selected file.
-	// XXX(xiaq): This would break when we support alternative ordering.
-	n.current = newNavColumn(all, func(i int) bool {
-		return i == 0 || all[i].Text <= selectedName
-	})
+	oldSelected := n.current.selectedIndex()
+	n.current = newNavColumn(all, func(i int) bool { return i == 0 })
+	if wd, err := os.Getwd(); err == nil {
+		n.current.dir = wd
+		n.current.marked = n.marked
+	}
 	n.current.changeFilter(n.filter)
-	n.maintainSelected(selectedName)
+	// Try to select the old selected file.
+	if !n.maintainSelected(selectedName) && n.sortBy != sortByName {
+		// The file has gone, and its neighbor cannot be found by name. Stay
+		// at the same position instead.
+		n.current.selectIndex(oldSelected)
+	}
 }
 
 func (n *navigation) refreshParent() {
@@ -315,11 +366,12 @@ func (n *navigation) loaddir(dir string) ([]ui.Styled, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
 	names, err := f.Readdirnames(-1)
 	if err != nil {
 		return nil, err
 	}
-	sort.Strings(names)
+	n.sortBy.sort(dir, names)
 
 	var all []ui.Styled
 	lsColor := lscolors.GetColorist()
@@ -352,6 +404,9 @@ type navColumn struct {
 	candidates []ui.Styled
 	// selected int
 	err error
+	// The directory of the column and the marked files, used to show marks.
+	dir    string
+	marked map[string]bool
 }
 
 func newNavColumn(all []ui.Styled, sel func(int) bool) *navColumn {
@@ -385,6 +440,9 @@ func (nc *navColumn) Len() int {
 
 func (nc *navColumn) Show(i int) (string, ui.Styled) {
 	cand := nc.candidates[i]
+	if nc.marked[path.Join(nc.dir, cand.Text)] {
+		return "", ui.Styled{"*" + cand.Text + " ", cand.Styles}
+	}
 	return "", ui.Styled{" " + cand.Text + " ", cand.Styles}
 }
 
@@ -424,6 +482,24 @@ func (nc *navColumn) ModeTitle(i int) string {
 	return ""
 }
 
+func (nc *navColumn) selectedIndex() int {
+	if nc == nil {
+		return -1
+	}
+	return nc.selected
+}
+
+// selectIndex selects the file at i, or the last file if there are fewer.
+func (nc *navColumn) selectIndex(i int) {
+	if i >= len(nc.candidates) {
+		i = len(nc.candidates) - 1
+	}
+	if i < 0 && len(nc.candidates) > 0 {
+		i = 0
+	}
+	nc.selected = i
+}
+
 func (nc *navColumn) selectedName() string {
 	if nc == nil || nc.selected == -1 || nc.selected >= len(nc.candidates) {
 		return ""
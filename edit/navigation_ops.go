@@ -0,0 +1,401 @@
+package edit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unicode/utf8"
+
+	"github.com/elves/elvish/edit/ui"
+	"github.com/elves/elvish/eval/types"
+	"github.com/elves/elvish/eval/vartypes"
+	"github.com/elves/elvish/store/storedefs"
+)
+
+// File operations and sorting in navigation mode.
+//
+// Files can be marked in any directory with edit:navigation:toggle-mark, and
+// then copied or moved into the current directory. Renaming, deleting and
+// creating directories show a prompt in the mode line. Deleting moves files
+// into $edit:nav-trash-dir, which defaults to ~/.elvish/trash.
+
+var (
+	errNoMarkedFiles = errors.New("no marked files")
+	errNoSelected    = errors.New("no file selected")
+)
+
+var _ = RegisterVariable("nav-trash-dir", func() vartypes.Variable {
+	return vartypes.NewValidatedPtr(types.String(""), vartypes.ShouldBeString)
+})
+
+func (ed *Editor) navTrashDir() (string, error) {
+	dir := string(ed.variables["nav-trash-dir"].Get().(types.String))
+	if dir == "" {
+		dataDir, err := storedefs.EnsureDataDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(dataDir, "trash")
+	}
+	return dir, os.MkdirAll(dir, 0700)
+}
+
+// navPrompt is a prompt shown in the mode line of navigation mode.
+type navPrompt struct {
+	title string
+	text  string
+	// If confirm is true, the prompt is a yes-or-no question, answered by y.
+	// Any other key cancels it.
+	confirm bool
+	action  func(text string) error
+}
+
+func (n *navigation) handlePromptKey(ed *Editor, k ui.Key) {
+	p := n.prompt
+	if p.confirm {
+		n.prompt = nil
+		if k == (ui.Key{'y', 0}) || k == (ui.Key{'Y', 0}) {
+			n.runPromptAction(ed, p)
+		}
+		return
+	}
+	switch {
+	case k == (ui.Key{ui.Enter, 0}):
+		n.prompt = nil
+		n.runPromptAction(ed, p)
+	case k == (ui.Key{'[', ui.Ctrl}) || k == (ui.Key{'G', ui.Ctrl}):
+		n.prompt = nil
+	case k == (ui.Key{ui.Backspace, 0}):
+		_, size := utf8.DecodeLastRuneInString(p.text)
+		p.text = p.text[:len(p.text)-size]
+	case likeChar(k):
+		p.text += k.String()
+	}
+}
+
+func (n *navigation) runPromptAction(ed *Editor, p *navPrompt) {
+	err := p.action(p.text)
+	if err != nil {
+		ed.Notify("%v", err)
+	}
+	n.refresh()
+}
+
+func navToggleMark(ed *Editor) {
+	n := &ed.navigation
+	name := n.current.selectedName()
+	if name == "" {
+		return
+	}
+	path, err := filepath.Abs(name)
+	if err != nil {
+		ed.Notify("%v", err)
+		return
+	}
+	if n.marked == nil {
+		n.marked = make(map[string]bool)
+	}
+	if n.marked[path] {
+		delete(n.marked, path)
+	} else {
+		n.marked[path] = true
+	}
+	n.next()
+}
+
+func navClearMarks(ed *Editor) {
+	ed.navigation.marked = nil
+	ed.navigation.refresh()
+}
+
+func navRename(ed *Editor) {
+	n := &ed.navigation
+	name := n.current.selectedName()
+	if name == "" {
+		ed.Notify("%v", errNoSelected)
+		return
+	}
+	n.prompt = &navPrompt{title: "RENAME ", text: name, action: func(newName string) error {
+		if newName == "" || newName == name {
+			return nil
+		}
+		if _, err := os.Lstat(newName); err == nil {
+			return fmt.Errorf("%s already exists", newName)
+		}
+		err := os.Rename(name, newName)
+		if err == nil {
+			n.renameMark(name, newName)
+			n.selectAfterRefresh(newName)
+		}
+		return err
+	}}
+}
+
+func navDelete(ed *Editor) {
+	n := &ed.navigation
+	paths := n.markedPaths()
+	if len(paths) == 0 {
+		name := n.current.selectedName()
+		if name == "" {
+			ed.Notify("%v", errNoSelected)
+			return
+		}
+		paths = []string{name}
+	}
+	title := fmt.Sprintf("TRASH %d FILES? (y/n) ", len(paths))
+	if len(paths) == 1 {
+		title = fmt.Sprintf("TRASH %s? (y/n) ", filepath.Base(paths[0]))
+	}
+	n.prompt = &navPrompt{title: title, confirm: true, action: func(string) error {
+		trash, err := ed.navTrashDir()
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			err := moveToTrash(path, trash)
+			if err != nil {
+				return err
+			}
+			n.unmark(path)
+		}
+		return nil
+	}}
+}
+
+func navMkdir(ed *Editor) {
+	n := &ed.navigation
+	n.prompt = &navPrompt{title: "MKDIR ", action: func(name string) error {
+		if name == "" {
+			return nil
+		}
+		err := os.Mkdir(name, 0777)
+		if err == nil {
+			n.selectAfterRefresh(name)
+		}
+		return err
+	}}
+}
+
+func navCopyMarked(ed *Editor) {
+	navTransferMarked(ed, "COPY", copyPath)
+}
+
+func navMoveMarked(ed *Editor) {
+	navTransferMarked(ed, "MOVE", movePath)
+}
+
+// navTransferMarked copies or moves the marked files into the current
+// directory after confirmation, and clears the marks.
+func navTransferMarked(ed *Editor, verb string, transfer func(src, dst string) error) {
+	n := &ed.navigation
+	paths := n.markedPaths()
+	if len(paths) == 0 {
+		ed.Notify("%v", errNoMarkedFiles)
+		return
+	}
+	title := fmt.Sprintf("%s %d FILES HERE? (y/n) ", verb, len(paths))
+	n.prompt = &navPrompt{title: title, confirm: true, action: func(string) error {
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			if wd == path || strings.HasPrefix(wd, path+"/") {
+				return fmt.Errorf("cannot %s %s into itself", strings.ToLower(verb), path)
+			}
+			dst := filepath.Base(path)
+			if _, err := os.Lstat(dst); err == nil {
+				return fmt.Errorf("%s already exists", dst)
+			}
+			err := transfer(path, dst)
+			if err != nil {
+				return err
+			}
+			n.unmark(path)
+		}
+		return nil
+	}}
+}
+
+// markedPaths returns the marked paths in sorted order.
+func (n *navigation) markedPaths() []string {
+	var paths []string
+	for path := range n.marked {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (n *navigation) unmark(path string) {
+	if abs, err := filepath.Abs(path); err == nil {
+		delete(n.marked, abs)
+	}
+}
+
+func (n *navigation) renameMark(old, new string) {
+	oldAbs, err1 := filepath.Abs(old)
+	newAbs, err2 := filepath.Abs(new)
+	if err1 == nil && err2 == nil && n.marked[oldAbs] {
+		delete(n.marked, oldAbs)
+		n.marked[newAbs] = true
+	}
+}
+
+// selectAfterRefresh rereads the current directory and selects the named file,
+// which is then maintained by the next refresh.
+func (n *navigation) selectAfterRefresh(name string) {
+	n.refreshCurrent()
+	n.maintainSelected(name)
+}
+
+// moveToTrash moves a file into the trash directory, adding a numeric suffix
+// to its name when the trash already has a file with the same name.
+func moveToTrash(path, trash string) error {
+	base := filepath.Base(path)
+	dst := filepath.Join(trash, base)
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(dst); os.IsNotExist(err) {
+			break
+		}
+		dst = filepath.Join(trash, base+"."+strconv.Itoa(i))
+	}
+	return movePath(path, dst)
+}
+
+// rename is os.Rename. It is a variable so that it can be replaced in tests.
+var rename = os.Rename
+
+// movePath moves a file, directory or symlink. When the destination is on
+// another filesystem, which os.Rename does not support, it copies the source
+// and removes it.
+func movePath(src, dst string) error {
+	err := rename(src, dst)
+	if linkErr, ok := err.(*os.LinkError); !ok || linkErr.Err != syscall.EXDEV {
+		return err
+	}
+	err = copyPath(src, dst)
+	if err != nil {
+		// Do not leave a partial copy behind; the source is kept intact.
+		os.RemoveAll(dst)
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+// copyPath copies a file, directory or symlink recursively, preserving
+// permissions.
+func copyPath(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+	case info.IsDir():
+		err := os.Mkdir(dst, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		names, err := f.Readdirnames(-1)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			err := copyPath(filepath.Join(src, name), filepath.Join(dst, name))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return copyFile(src, dst, info.Mode().Perm())
+	}
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Sorting.
+
+type navSortKey int
+
+const (
+	sortByName navSortKey = iota
+	sortBySize
+	sortByMtime
+)
+
+func (k navSortKey) String() string {
+	switch k {
+	case sortBySize:
+		return "size"
+	case sortByMtime:
+		return "mtime"
+	default:
+		return "name"
+	}
+}
+
+// sort sorts names of files in dir. Files are sorted by name, or by size or
+// modification time with the largest or newest first.
+func (k navSortKey) sort(dir string, names []string) {
+	sort.Strings(names)
+	if k == sortByName {
+		return
+	}
+	keys := make(map[string]int64, len(names))
+	for _, name := range names {
+		info, err := os.Lstat(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		if k == sortBySize {
+			keys[name] = info.Size()
+		} else {
+			keys[name] = info.ModTime().UnixNano()
+		}
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		return keys[names[i]] > keys[names[j]]
+	})
+}
+
+func navSortByName(ed *Editor)  { navSetSort(ed, sortByName) }
+func navSortBySize(ed *Editor)  { navSetSort(ed, sortBySize) }
+func navSortByMtime(ed *Editor) { navSetSort(ed, sortByMtime) }
+
+func navSetSort(ed *Editor, k navSortKey) {
+	ed.navigation.sortBy = k
+	ed.navigation.refresh()
+}
@@ -0,0 +1,125 @@
+package edit
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/elves/elvish/edit/ui"
+	"github.com/elves/elvish/util"
+)
+
+func TestNavSortKey(t *testing.T) {
+	util.InTempDir(func(string) {
+		mustWriteFile("a", "xx", time.Unix(100, 0))
+		mustWriteFile("b", "xxx", time.Unix(50, 0))
+		mustWriteFile("c", "x", time.Unix(200, 0))
+
+		for _, test := range []struct {
+			key  navSortKey
+			want []string
+		}{
+			{sortByName, []string{"a", "b", "c"}},
+			{sortBySize, []string{"b", "a", "c"}},
+			{sortByMtime, []string{"c", "a", "b"}},
+		} {
+			names := []string{"c", "b", "a"}
+			test.key.sort(".", names)
+			if !reflect.DeepEqual(names, test.want) {
+				t.Errorf("sort by %s -> %v, want %v", test.key, names, test.want)
+			}
+		}
+	})
+}
+
+func TestCopyPathAndMoveToTrash(t *testing.T) {
+	util.InTempDir(func(string) {
+		mustMkdir("src")
+		mustMkdir("src/sub")
+		mustWriteFile("src/sub/f", "content", time.Now())
+		mustMkdir("trash")
+
+		if err := copyPath("src", "dst"); err != nil {
+			t.Fatalf("copyPath -> %v", err)
+		}
+		if content, _ := ioutil.ReadFile("dst/sub/f"); string(content) != "content" {
+			t.Errorf("copied file has content %q", content)
+		}
+
+		mustWriteFile("trash/f", "", time.Now())
+		if err := moveToTrash("dst/sub/f", "trash"); err != nil {
+			t.Fatalf("moveToTrash -> %v", err)
+		}
+		if _, err := os.Stat("trash/f.1"); err != nil {
+			t.Errorf("trashed file not found: %v", err)
+		}
+	})
+}
+
+func TestMovePathAcrossFilesystems(t *testing.T) {
+	// Simulate moving across filesystems, which os.Rename cannot do.
+	defer func(f func(string, string) error) { rename = f }(rename)
+	rename = func(src, dst string) error {
+		return &os.LinkError{"rename", src, dst, syscall.EXDEV}
+	}
+	util.InTempDir(func(string) {
+		mustMkdir("src")
+		mustWriteFile("src/f", "content", time.Now())
+
+		if err := movePath("src", "dst"); err != nil {
+			t.Fatalf("movePath -> %v", err)
+		}
+		if content, _ := ioutil.ReadFile("dst/f"); string(content) != "content" {
+			t.Errorf("moved file has content %q", content)
+		}
+		if _, err := os.Lstat("src"); !os.IsNotExist(err) {
+			t.Errorf("source still exists after moving")
+		}
+	})
+}
+
+func TestNavPrompt(t *testing.T) {
+	var n navigation
+	var got string
+	n.prompt = &navPrompt{text: "ab", action: func(s string) error {
+		got = s
+		return nil
+	}}
+	n.current = newNavColumn(nil, nil)
+	for _, k := range []ui.Key{{ui.Backspace, 0}, {'c', 0}, {ui.Enter, 0}} {
+		// Use a nil Editor; the action does not fail.
+		n.handlePromptKey(nil, k)
+	}
+	if got != "ac" || n.prompt != nil {
+		t.Errorf("prompt submitted %q, prompt = %v", got, n.prompt)
+	}
+
+	// Any key other than y cancels a confirmation.
+	called := false
+	n.prompt = &navPrompt{confirm: true, action: func(string) error {
+		called = true
+		return nil
+	}}
+	n.handlePromptKey(nil, ui.Key{'n', 0})
+	if called || n.prompt != nil {
+		t.Errorf("confirmation not cancelled")
+	}
+}
+
+func mustMkdir(name string) {
+	if err := os.Mkdir(name, 0700); err != nil {
+		panic(err)
+	}
+}
+
+func mustWriteFile(name, content string, mtime time.Time) {
+	if err := ioutil.WriteFile(name, []byte(content), 0600); err != nil {
+		panic(err)
+	}
+	if err := os.Chtimes(name, mtime, mtime); err != nil {
+		panic(err)
+	}
+}
@@ -49,7 +49,7 @@ func (fp *navFilePreview) FullWidth(h int) int {
 func (fp *navFilePreview) List(h int) ui.Renderer {
 	if len(fp.lines) <= h {
 		logger.Printf("Height %d fit all lines", h)
-		return listingRenderer{fp.lines}
+		return listingRenderer{fp.lines, nil}
 	}
 	shown := fp.lines[fp.beginLine:]
 	if len(shown) > h {
@@ -57,7 +57,7 @@ func (fp *navFilePreview) List(h int) ui.Renderer {
 	}
 	logger.Printf("Showing lines %d to %d", fp.beginLine, fp.beginLine+len(shown))
 	return listingWithScrollBarRenderer{
-		listingRenderer{shown}, len(fp.lines),
+		listingRenderer{shown, nil}, len(fp.lines),
 		fp.beginLine, fp.beginLine + len(shown), h}
 }
 
@@ -0,0 +1,97 @@
+package edit
+
+import (
+	"errors"
+
+	"github.com/elves/elvish/edit/ui"
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
+	"github.com/xiaq/persistent/hashmap"
+)
+
+var errPickWhileActive = errors.New("cannot pick while the editor is active")
+
+// pick implements the edit:pick builtin, which lets the user pick items using
+// the narrow mode and outputs the picked ones. Items are taken from the
+// optional iterable argument or the input, and can be strings or maps like the
+// items of edit:-narrow-read. It accepts the same options as edit:-narrow-read.
+//
+// Usually the selected item is picked; when some items are marked, all the
+// marked ones are picked instead. Leaving the narrow mode without accepting
+// picks nothing. Like with edit:-narrow-read, the key bindings of the narrow
+// mode are set up by "use narrow"; when they are not, a few default bindings
+// are used so that the picker can still be operated and left.
+func pick(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+	ed := ec.Editor.(*Editor)
+	if ed.Active() {
+		throw(errPickWhileActive)
+	}
+
+	var items []narrowItem
+	eval.ScanArgsOptionalInput(ec, args)(func(v types.Value) {
+		switch v := v.(type) {
+		case types.String:
+			items = append(items, &narrowItemString{v})
+		case types.Map:
+			items = append(items, &narrowItemComplex{v})
+		default:
+			throwf("item must be string or map, got %s", v.Kind())
+		}
+	})
+
+	l := &narrow{
+		opts: narrowOptions{
+			Bindings: types.NewMap(hashmap.Empty),
+			Modeline: " PICK ",
+		},
+	}
+	scanNarrowOptions(opts, l)
+	if ed.bindings[modeNarrow].Get().(BindingTable).Len() == 0 {
+		addPickDefaultBindings(l)
+	}
+	l.source = func() []narrowItem { return items }
+	var picked []narrowItem
+	l.action = func(ed *Editor, items []narrowItem) {
+		picked = items
+		ed.mode = &ed.insert
+	}
+	l.initPreview(ed)
+	l.changeFilter("")
+
+	_, err := ed.readLine(l, true)
+	maybeThrow(err)
+
+	out := ec.OutputChan()
+	for _, item := range picked {
+		out <- narrowItemValue(item)
+	}
+}
+
+// addPickDefaultBindings adds the bindings used by edit:pick when
+// $edit:narrow:binding is empty to l, unless the keys are already bound by the
+// &bindings option.
+func addPickDefaultBindings(l *narrow) {
+	if l.opts.bindingMap == nil {
+		l.opts.bindingMap = make(map[ui.Key]eval.Fn)
+	}
+	for k, f := range pickDefaultBindings() {
+		if _, ok := l.opts.bindingMap[k]; !ok {
+			l.opts.bindingMap[k] = f
+		}
+	}
+}
+
+func pickDefaultBindings() map[ui.Key]eval.Fn {
+	narrow, insert := builtinMaps[modeNarrow], builtinMaps[modeInsert]
+	return map[ui.Key]eval.Fn{
+		{ui.Up, 0}:        narrow["up"],
+		{ui.Down, 0}:      narrow["down"],
+		{ui.PageUp, 0}:    narrow["page-up"],
+		{ui.PageDown, 0}:  narrow["page-down"],
+		{ui.Tab, 0}:       narrow["toggle-mark"],
+		{ui.Backspace, 0}: narrow["backspace"],
+		{ui.Enter, 0}:     narrow["accept-close"],
+		{'[', ui.Ctrl}:    insert["start"],
+		ui.Default:        narrow["default"],
+	}
+}
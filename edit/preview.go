@@ -0,0 +1,237 @@
+package edit
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/elves/elvish/edit/ui"
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
+	"github.com/elves/elvish/eval/vartypes"
+)
+
+// Listing and narrow modes can show a preview of the selected item in a pane
+// on the right of the list. The preview is generated by a user-supplied
+// previewer, a function that is called with the selected item. Each value it
+// outputs becomes one or more lines of the preview, and may be a styled text
+// from edit:styled; byte output is appended as unstyled lines.
+//
+// Previewers of listing modes are looked up in $edit:previewer, keyed by the
+// name of the mode, e.g.:
+//
+//     edit:previewer[location] = [dir]{ ls $dir }
+//
+// The previewer of edit:-narrow-read is given as the &preview option, and
+// defaults to $edit:previewer[narrow].
+
+var errPreviewerMustBeFn = errors.New("previewer must be a function")
+
+var _ = RegisterVariable("previewer", func() vartypes.Variable {
+	return vartypes.NewValidatedPtr(types.EmptyMap, vartypes.ShouldBeMap)
+})
+
+// previewItemer is implemented by listing providers whose items to preview
+// differ from the content shown for them.
+type previewItemer interface {
+	PreviewItem(i int) types.Value
+}
+
+// previewer returns the previewer for a mode, or nil if there is none.
+func (ed *Editor) previewer(mode string) eval.Fn {
+	m := ed.variables["previewer"].Get().(types.Map)
+	if !m.HasKey(types.String(mode)) {
+		return nil
+	}
+	previewer, ok := m.IndexOne(types.String(mode)).(eval.Fn)
+	if !ok {
+		ed.Notify("%v", errPreviewerMustBeFn)
+		return nil
+	}
+	return previewer
+}
+
+// previewCacheSize is the number of previews a previewPane keeps before it
+// starts over with an empty cache.
+const previewCacheSize = 64
+
+// previewPane manages the preview of the selected item. Like prompts, previews
+// are generated in the background, with at most one previewer call running at
+// any time; the result is written onto the channel returned by Chan, and should
+// be passed to Receive. Previews are cached by item, so that the previewer is
+// not called again when the selection moves back to an item.
+//
+// Except for the channel returned by Chan, a previewPane must only be used
+// from one goroutine.
+type previewPane struct {
+	ev        *eval.Evaler
+	previewer eval.Fn
+	ch        chan previewResult
+	cache     map[string][]ui.Styled
+
+	// The item to preview, and the key of its cache entry.
+	item types.Value
+	key  string
+
+	running bool
+}
+
+// previewResult is the preview of an item, generated in the background.
+type previewResult struct {
+	key   string
+	lines []ui.Styled
+}
+
+// newPreviewPane returns a previewPane using the given previewer, or nil if the
+// previewer is nil.
+func newPreviewPane(ev *eval.Evaler, previewer eval.Fn) *previewPane {
+	if previewer == nil {
+		return nil
+	}
+	return &previewPane{ev: ev, previewer: previewer,
+		ch: make(chan previewResult, 1), cache: make(map[string][]ui.Styled)}
+}
+
+// render returns a renderer that shows the listing with the preview of item on
+// its right, using at most maxHeight lines for the preview. If the preview of
+// item is not ready yet, the pane is empty, and the previewer is called in the
+// background.
+func (p *previewPane) render(listing ui.Renderer, item types.Value, maxHeight int) ui.Renderer {
+	if p.item == nil || !p.item.Equal(item) {
+		p.item, p.key = item, item.Repr(types.NoPretty)
+		p.update()
+	}
+	lines := p.cache[p.key]
+	if len(lines) > maxHeight {
+		lines = lines[:maxHeight]
+	}
+	return listingWithPreviewRenderer{listing, lines}
+}
+
+// update starts calling the previewer for the current item, unless its preview
+// is cached or another call is running. In the latter case, the call is started
+// by Receive.
+func (p *previewPane) update() {
+	if _, ok := p.cache[p.key]; ok || p.running {
+		return
+	}
+	p.running = true
+	item, key := p.item, p.key
+	go func() {
+		lines, err := callPreviewer(p.ev, p.previewer, item)
+		if err != nil {
+			lines = []ui.Styled{ui.Unstyled("preview error: " + err.Error())}
+		}
+		p.ch <- previewResult{key, lines}
+	}()
+}
+
+// Chan returns the channel onto which the results of previewer calls are
+// written.
+func (p *previewPane) Chan() <-chan previewResult {
+	return p.ch
+}
+
+// Receive records the result of a previewer call, read from the channel
+// returned by Chan. If the selection has changed in the meanwhile, the
+// previewer is called for the new item.
+func (p *previewPane) Receive(r previewResult) {
+	if len(p.cache) >= previewCacheSize {
+		p.cache = make(map[string][]ui.Styled)
+	}
+	p.cache[r.key] = r.lines
+	p.running = false
+	p.update()
+}
+
+// currentPreviewPane returns the preview pane of the current mode, or nil if
+// there is none.
+func (ed *Editor) currentPreviewPane() *previewPane {
+	switch mode := ed.mode.(type) {
+	case *listing:
+		return mode.preview
+	case *narrow:
+		return mode.preview
+	}
+	return nil
+}
+
+// previewUpdates returns the channel of the results of the previewer of the
+// current mode, or nil if the mode does not have a preview pane.
+func (ed *Editor) previewUpdates() <-chan previewResult {
+	if p := ed.currentPreviewPane(); p != nil {
+		return p.Chan()
+	}
+	return nil
+}
+
+// callPreviewer calls the previewer with the item, and converts its output to
+// lines.
+func callPreviewer(ev *eval.Evaler, previewer eval.Fn, item types.Value) ([]ui.Styled, error) {
+	var (
+		valueLines []ui.Styled
+		byteLines  []ui.Styled
+	)
+	valuesCb := func(ch <-chan types.Value) {
+		for v := range ch {
+			s, ok := v.(*ui.Styled)
+			if !ok {
+				s = &ui.Styled{types.ToString(v), ui.Styles{}}
+			}
+			valueLines = append(valueLines, splitStyledLines(*s)...)
+		}
+	}
+	bytesCb := func(r *os.File) {
+		allBytes, err := ioutil.ReadAll(r)
+		if err != nil {
+			logger.Println("error reading previewer byte output:", err)
+		}
+		if len(allBytes) > 0 {
+			text := strings.TrimSuffix(string(allBytes), "\n")
+			byteLines = splitStyledLines(ui.Unstyled(text))
+		}
+	}
+
+	ports := []*eval.Port{
+		eval.DevNullClosedChan,
+		{}, // Will be replaced when capturing output
+		{File: os.Stderr},
+	}
+	// XXX There is no source to pass to NewTopEvalCtx.
+	ec := eval.NewTopFrame(ev, eval.NewInternalSource("[editor previewer]"), ports)
+	err := ec.PCaptureOutputInner(previewer, []types.Value{item}, eval.NoOpts, valuesCb, bytesCb)
+	if err != nil {
+		return nil, err
+	}
+	return append(valueLines, byteLines...), nil
+}
+
+// splitStyledLines splits a styled text into lines of the same style.
+func splitStyledLines(s ui.Styled) []ui.Styled {
+	// BUG: Handle tabstops correctly
+	text := strings.Replace(s.Text, "\t", "    ", -1)
+	var lines []ui.Styled
+	for _, line := range strings.Split(text, "\n") {
+		lines = append(lines, ui.Styled{line, s.Styles})
+	}
+	return lines
+}
+
+const previewMargin = 1
+
+// listingWithPreviewRenderer renders a listing, with a preview pane occupying
+// the right half.
+type listingWithPreviewRenderer struct {
+	listing ui.Renderer
+	preview []ui.Styled
+}
+
+func (lp listingWithPreviewRenderer) Render(b *ui.Buffer) {
+	wListing := (b.Width - previewMargin) / 2
+	bListing := ui.Render(lp.listing, wListing)
+	b.ExtendRight(bListing, 0)
+
+	bPreview := ui.Render(listingRenderer{lp.preview, nil}, b.Width-wListing-previewMargin)
+	b.ExtendRight(bPreview, wListing+previewMargin)
+}
@@ -0,0 +1,70 @@
+package edit
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/elves/elvish/edit/ui"
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
+)
+
+func TestCallPreviewer(t *testing.T) {
+	ev := eval.NewEvaler()
+	defer ev.Close()
+	previewer := &eval.BuiltinFn{"previewer", func(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+		var item types.String
+		eval.ScanArgs(args, &item)
+		ec.OutputChan() <- &ui.Styled{string(item), ui.Styles{"red"}}
+		ec.OutputChan() <- types.String("a\tb\nc")
+		ec.OutputFile().WriteString("bytes 1\nbytes 2\n")
+	}}
+
+	lines, err := callPreviewer(ev, previewer, types.String("item"))
+	want := []ui.Styled{
+		{"item", ui.Styles{"red"}},
+		{"a    b", ui.Styles{}},
+		{"c", ui.Styles{}},
+		ui.Unstyled("bytes 1"),
+		ui.Unstyled("bytes 2"),
+	}
+	if err != nil || !reflect.DeepEqual(lines, want) {
+		t.Errorf("callPreviewer -> (%v, %v), want (%v, nil)", lines, err, want)
+	}
+}
+
+func TestPreviewPane(t *testing.T) {
+	ev := eval.NewEvaler()
+	defer ev.Close()
+	calls := 0
+	previewer := &eval.BuiltinFn{"previewer", func(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+		calls++
+		ec.OutputChan() <- args[0]
+		ec.OutputChan() <- types.String("more")
+	}}
+	p := newPreviewPane(ev, previewer)
+	listing := listingRenderer{[]ui.Styled{ui.Unstyled("x")}, nil}
+
+	// The preview is empty until the previewer returns.
+	r := p.render(listing, types.String("x"), 1)
+	if want := (listingWithPreviewRenderer{listing, nil}); !reflect.DeepEqual(r, want) {
+		t.Errorf("render before previewer returns -> %v, want %v", r, want)
+	}
+	p.Receive(<-p.Chan())
+	r = p.render(listing, types.String("x"), 1)
+	want := listingWithPreviewRenderer{listing, []ui.Styled{ui.Unstyled("x")}}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("render -> %v, want %v", r, want)
+	}
+	// The previewer is only called for items without cached previews.
+	p.render(listing, types.String("y"), 1)
+	p.Receive(<-p.Chan())
+	p.render(listing, types.String("x"), 1)
+	if calls != 2 {
+		t.Errorf("previewer called %d times, want 2", calls)
+	}
+
+	if got := bufferText(ui.Render(want, 7)); !reflect.DeepEqual(got, []string{"x   x  "}) {
+		t.Errorf("rendered %q", got)
+	}
+}
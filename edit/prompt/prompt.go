@@ -98,9 +98,30 @@ func RpromptPersistent(ed Editor) bool {
 	return bool(ed.Variable("rprompt-persistent").Get().(types.Bool).Bool())
 }
 
+// defaultTransient is the default value of $edit:prompt-transient. It is never
+// called; it indicates that the prompt is not transient.
+var defaultTransient = &eval.BuiltinFn{"default prompt-transient",
+	func(*eval.Frame, []types.Value, map[string]types.Value) {}}
+
+// TransientVariable returns a variable for $edit:prompt-transient.
+func TransientVariable() vartypes.Variable {
+	return vartypes.NewValidatedPtr(defaultTransient, eval.ShouldBeFn)
+}
+
+// TransientContent calls $edit:prompt-transient and returns its outputs, which
+// replace the prompt when the editor finishes reading a line. The last return
+// value is false if $edit:prompt-transient is not set.
+func TransientContent(ed Editor) ([]*ui.Styled, bool) {
+	fn := ed.Variable("prompt-transient").Get().(eval.Callable)
+	if fn == defaultTransient {
+		return nil, false
+	}
+	return callPrompt(ed, fn), true
+}
+
 // MaxWaitVariable returns a variable for $edit:-prompts-max-wait.
 func MaxWaitVariable() vartypes.Variable {
-	f := math.Inf(1)
+	f := 0.05
 	return vartypes.NewNumber(&f)
 }
 
@@ -114,16 +135,54 @@ func MaxWait(ed Editor) float64 {
 // $edit:-prompts-max-wait seconds if the time fits in a time.Duration value, or
 // nil otherwise.
 func MakeMaxWaitChan(ed Editor) <-chan time.Time {
-	f := MaxWait(ed)
+	return afterSeconds(MaxWait(ed))
+}
+
+// StaleThresholdVariable returns a variable for $edit:prompt-stale-threshold.
+func StaleThresholdVariable() vartypes.Variable {
+	f := 0.2
+	return vartypes.NewNumber(&f)
+}
+
+// StaleThreshold extracts $edit:prompt-stale-threshold.
+func StaleThreshold(ed Editor) float64 {
+	f, _ := strconv.ParseFloat(string(ed.Variable("prompt-stale-threshold").Get().(types.String)), 64)
+	return f
+}
+
+// StaleTransformVariable returns a variable for $edit:prompt-stale-transform.
+// The default transformer prepends an inverse question mark to the prompt.
+func StaleTransformVariable() vartypes.Variable {
+	transform := func(ec *eval.Frame,
+		args []types.Value, opts map[string]types.Value) {
+		eval.TakeNoOpt(opts)
+		out := ec.OutputChan()
+		out <- staledPrompt
+		for _, arg := range args {
+			out <- arg
+		}
+	}
+	return vartypes.NewValidatedPtr(
+		&eval.BuiltinFn{"default prompt-stale-transform", transform}, eval.ShouldBeFn)
+}
+
+// StaleTransform extracts $edit:prompt-stale-transform.
+func StaleTransform(ed Editor) eval.Callable {
+	return ed.Variable("prompt-stale-transform").Get().(eval.Callable)
+}
+
+// afterSeconds makes a channel that sends the current time after f seconds if
+// the time fits in a time.Duration value, or nil otherwise.
+func afterSeconds(f float64) <-chan time.Time {
 	if f > maxSeconds {
 		return nil
 	}
 	return time.After(time.Duration(f * float64(time.Second)))
 }
 
-// callPrompt calls a Fn, assuming that it is a prompt. It calls the Fn with no
-// arguments and closed input, and converts its outputs to styled objects.
-func callPrompt(ed Editor, fn eval.Callable) []*ui.Styled {
+// callPrompt calls a Fn, assuming that it is a prompt. It calls the Fn with the
+// given arguments and closed input, and converts its outputs to styled objects.
+func callPrompt(ed Editor, fn eval.Callable, args ...types.Value) []*ui.Styled {
 	ports := []*eval.Port{
 		eval.DevNullClosedChan,
 		{}, // Will be replaced when capturing output
@@ -162,7 +221,7 @@ func callPrompt(ed Editor, fn eval.Callable) []*ui.Styled {
 
 	// XXX There is no source to pass to NewTopEvalCtx.
 	ec := eval.NewTopFrame(ed.Evaler(), eval.NewInternalSource("[prompt]"), ports)
-	err := ec.PCaptureOutputInner(fn, nil, eval.NoOpts, valuesCb, bytesCb)
+	err := ec.PCaptureOutputInner(fn, args, eval.NoOpts, valuesCb, bytesCb)
 
 	if err != nil {
 		ed.Notify("prompt function error: %v", err)
@@ -172,29 +231,116 @@ func callPrompt(ed Editor, fn eval.Callable) []*ui.Styled {
 	return styleds
 }
 
-// Updater manages the update of a prompt.
+// Updater manages the update of a prompt. Prompts are evaluated in the
+// background, and at most one evaluation is running at any time; update
+// requests made while an evaluation is running are coalesced into one
+// evaluation that starts when the running one finishes.
+//
+// Except for the channel returned by Chan, an Updater must only be used from
+// one goroutine.
 type Updater struct {
 	promptFn func(Editor) eval.Callable
-	Staled   []*ui.Styled
+	ch       chan []*ui.Styled
+
+	// The last prompt content, and whether there has been any.
+	last    []*ui.Styled
+	hasLast bool
+
+	running bool
+	queued  bool
+	started time.Time
+	// Whether the stale content has been shown for the running update.
+	staleShown bool
+
+	// The last content transformed with $edit:prompt-stale-transform, and the
+	// transformer used. It is reset whenever the last content changes.
+	stale    []*ui.Styled
+	staleFn  eval.Callable
+	hasStale bool
 }
 
 var staledPrompt = &ui.Styled{"?", ui.Styles{"inverse"}}
 
 // NewUpdater creates a new Updater.
 func NewUpdater(promptFn func(Editor) eval.Callable) *Updater {
-	return &Updater{promptFn, []*ui.Styled{staledPrompt}}
+	return &Updater{promptFn: promptFn, ch: make(chan []*ui.Styled, 1)}
 }
 
-// Update updates the prompt, returning a channel onto which the result will be
-// written.
-func (pu *Updater) Update(ed Editor) <-chan []*ui.Styled {
-	ch := make(chan []*ui.Styled)
+// Update requests the prompt to be updated. The result will be written onto
+// the channel returned by Chan, and should be passed to Receive.
+func (pu *Updater) Update(ed Editor) {
+	if pu.running {
+		pu.queued = true
+		return
+	}
+	pu.running = true
+	pu.started = time.Now()
+	pu.staleShown = false
+	fn := pu.promptFn(ed)
 	go func() {
-		result := callPrompt(ed, pu.promptFn(ed))
-		pu.Staled = make([]*ui.Styled, len(result)+1)
-		pu.Staled[0] = staledPrompt
-		copy(pu.Staled[1:], result)
-		ch <- result
+		pu.ch <- callPrompt(ed, fn)
 	}()
-	return ch
+}
+
+// Chan returns the channel onto which the results of updates are written.
+func (pu *Updater) Chan() <-chan []*ui.Styled {
+	return pu.ch
+}
+
+// Receive records the result of an update, read from the channel returned by
+// Chan. If another update was requested in the meanwhile, it is started.
+func (pu *Updater) Receive(ed Editor, content []*ui.Styled) {
+	pu.last, pu.hasLast = content, true
+	pu.hasStale = false
+	pu.running = false
+	if pu.queued {
+		pu.queued = false
+		pu.Update(ed)
+	}
+}
+
+// Running returns whether an update is running.
+func (pu *Updater) Running() bool {
+	return pu.running
+}
+
+// Stale returns whether the last prompt content is stale, i.e. an update has
+// been running for longer than $edit:prompt-stale-threshold, or there has
+// never been any content.
+func (pu *Updater) Stale(ed Editor) bool {
+	return !pu.hasLast ||
+		pu.running && time.Since(pu.started).Seconds() >= StaleThreshold(ed)
+}
+
+// MakeStaleChan makes a channel that sends the current time when the last
+// prompt content becomes stale. It returns nil if no update is running, or the
+// stale content has already been shown for the running update, so that the
+// prompt is redrawn only once when it becomes stale.
+func (pu *Updater) MakeStaleChan(ed Editor) <-chan time.Time {
+	if !pu.running || pu.staleShown {
+		return nil
+	}
+	return afterSeconds(StaleThreshold(ed) - time.Since(pu.started).Seconds())
+}
+
+// Content returns the prompt content to show. If the last content is stale, it
+// is transformed with $edit:prompt-stale-transform; the transformed content is
+// reused until the last content changes.
+func (pu *Updater) Content(ed Editor) []*ui.Styled {
+	if !pu.Stale(ed) {
+		return pu.last
+	}
+	if pu.running {
+		pu.staleShown = true
+	}
+	fn := StaleTransform(ed)
+	if pu.hasStale && pu.staleFn == fn {
+		return pu.stale
+	}
+	args := make([]types.Value, len(pu.last))
+	for i, s := range pu.last {
+		args[i] = s
+	}
+	pu.stale, pu.staleFn, pu.hasStale = callPrompt(ed, fn, args...), fn, true
+	return pu.stale
 }
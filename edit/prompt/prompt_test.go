@@ -1,7 +1,145 @@
 package prompt
 
-import "testing"
+import (
+	"testing"
+	"time"
 
-func TestPrompt(t *testing.T) {
-	// TODO(xiaq): Add tests.
+	"github.com/elves/elvish/edit/ui"
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
+	"github.com/elves/elvish/eval/vartypes"
+)
+
+type fakeEditor struct {
+	evaler    *eval.Evaler
+	variables map[string]vartypes.Variable
+}
+
+func newFakeEditor(prompt eval.Fn) *fakeEditor {
+	return &fakeEditor{eval.NewEvaler(), map[string]vartypes.Variable{
+		"prompt":                 vartypes.NewPtr(prompt),
+		"prompt-stale-threshold": StaleThresholdVariable(),
+		"prompt-stale-transform": StaleTransformVariable(),
+	}}
+}
+
+func (ed *fakeEditor) Evaler() *eval.Evaler                { return ed.evaler }
+func (ed *fakeEditor) Variable(n string) vartypes.Variable { return ed.variables[n] }
+func (ed *fakeEditor) Notify(string, ...interface{})       {}
+
+func constPrompt(s string) eval.Fn {
+	return &eval.BuiltinFn{"prompt", func(ec *eval.Frame,
+		args []types.Value, opts map[string]types.Value) {
+		ec.OutputChan() <- types.String(s)
+	}}
+}
+
+func TestUpdater(t *testing.T) {
+	ed := newFakeEditor(constPrompt("> "))
+	pu := NewUpdater(Prompt)
+
+	if content := pu.Content(ed); len(content) != 1 || content[0] != staledPrompt {
+		t.Errorf("Content before update is %v, want stale prompt", content)
+	}
+
+	pu.Update(ed)
+	if !pu.Running() {
+		t.Errorf("Running() is false after Update")
+	}
+	// Another update is coalesced into one that starts later.
+	ed.variables["prompt"].Set(constPrompt("$ "))
+	pu.Update(ed)
+
+	pu.Receive(ed, <-pu.Chan())
+	want := []*ui.Styled{{"> ", ui.Styles{}}}
+	if content := pu.Content(ed); !stylesEq(content, want) {
+		t.Errorf("Content is %v, want %v", content, want)
+	}
+	if !pu.Running() {
+		t.Errorf("Running() is false after Receive, queued update not started")
+	}
+	if pu.MakeStaleChan(ed) == nil {
+		t.Errorf("MakeStaleChan() is nil when an update is running")
+	}
+
+	// The last content is shown as stale once the update takes too long.
+	ed.variables["prompt-stale-threshold"].Set(types.String("0"))
+	wantStale := []*ui.Styled{staledPrompt, {"> ", ui.Styles{}}}
+	if content := pu.Content(ed); !stylesEq(content, wantStale) {
+		t.Errorf("Content is %v, want %v", content, wantStale)
+	}
+	// The stale content is only shown once for each update.
+	if pu.MakeStaleChan(ed) != nil {
+		t.Errorf("MakeStaleChan() is not nil after stale content is shown")
+	}
+
+	select {
+	case content := <-pu.Chan():
+		pu.Receive(ed, content)
+	case <-time.After(time.Second):
+		t.Fatalf("queued update did not finish")
+	}
+	want = []*ui.Styled{{"$ ", ui.Styles{}}}
+	if content := pu.Content(ed); !stylesEq(content, want) {
+		t.Errorf("Content is %v, want %v", content, want)
+	}
+	if pu.Running() {
+		t.Errorf("Running() is true after all updates finished")
+	}
+}
+
+func stylesEq(a, b []*ui.Styled) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTransientContent(t *testing.T) {
+	ed := newFakeEditor(constPrompt("> "))
+	ed.variables["prompt-transient"] = TransientVariable()
+
+	if _, ok := TransientContent(ed); ok {
+		t.Errorf("TransientContent returns true when $prompt-transient is not set")
+	}
+
+	ed.variables["prompt-transient"].Set(constPrompt("$ "))
+	content, ok := TransientContent(ed)
+	want := []*ui.Styled{{"$ ", ui.Styles{}}}
+	if !ok || !stylesEq(content, want) {
+		t.Errorf("TransientContent -> (%v, %v), want (%v, true)", content, ok, want)
+	}
+}
+
+func TestUpdaterCachesStaleContent(t *testing.T) {
+	ed := newFakeEditor(constPrompt("> "))
+	calls := 0
+	ed.variables["prompt-stale-transform"].Set(&eval.BuiltinFn{"transform",
+		func(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+			calls++
+			ec.OutputChan() <- types.String("?")
+		}})
+	pu := NewUpdater(Prompt)
+
+	pu.Content(ed)
+	pu.Content(ed)
+	if calls != 1 {
+		t.Errorf("stale transform called %d times for the same content, want 1", calls)
+	}
+
+	pu.Update(ed)
+	pu.Receive(ed, <-pu.Chan())
+	ed.variables["prompt-stale-threshold"].Set(types.String("0"))
+	pu.Update(ed)
+	pu.Content(ed)
+	pu.Content(ed)
+	if calls != 2 {
+		t.Errorf("stale transform called %d times after content changed, want 2", calls)
+	}
+	pu.Receive(ed, <-pu.Chan())
 }
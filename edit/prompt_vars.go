@@ -1,10 +1,32 @@
 package edit
 
-import "github.com/elves/elvish/edit/prompt"
+import (
+	"github.com/elves/elvish/edit/prompt"
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
+)
 
 var (
 	_ = RegisterVariable("prompt", prompt.PromptVariable)
 	_ = RegisterVariable("rprompt", prompt.RpromptVariable)
 	_ = RegisterVariable("rprompt-persistent", prompt.RpromptPersistentVariable)
+	_ = RegisterVariable("prompt-transient", prompt.TransientVariable)
 	_ = RegisterVariable("-prompts-max-wait", prompt.MaxWaitVariable)
+	_ = RegisterVariable("prompt-stale-threshold", prompt.StaleThresholdVariable)
+	_ = RegisterVariable("prompt-stale-transform", prompt.StaleTransformVariable)
 )
+
+// PromptRefresh implements the edit:prompt-refresh builtin. It requests the
+// prompts to be re-evaluated, and may be called from background code. Requests
+// made while the editor is inactive take effect when it becomes active.
+func PromptRefresh(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+	eval.TakeNoArg(args)
+	eval.TakeNoOpt(opts)
+
+	ed := ec.Editor.(*Editor)
+	select {
+	case ed.promptRefresh <- struct{}{}:
+	default:
+		// A refresh is already pending.
+	}
+}
@@ -0,0 +1,143 @@
+package edit
+
+import (
+	"strings"
+
+	"github.com/elves/elvish/parse"
+)
+
+// Builtins related to the mark and the region.
+//
+// The region is the part of the buffer between the dot and the mark. It only
+// exists when the mark is set. The mark is unset whenever the buffer is
+// modified, and a mark set by one of the select-* builtins (which are bound to
+// Shift-modified movement keys by default) is also unset by any other builtin.
+
+var _ = registerBuiltins("", map[string]func(*Editor){
+	"set-mark":              setMark,
+	"unset-mark":            unsetMark,
+	"exchange-dot-and-mark": exchangeDotAndMark,
+
+	"select-left":       selectLeft,
+	"select-right":      selectRight,
+	"select-left-word":  selectLeftWord,
+	"select-right-word": selectRightWord,
+	"select-sol":        selectSOL,
+	"select-eol":        selectEOL,
+	"select-all":        selectAll,
+
+	"kill-region":     killRegion,
+	"copy-region":     copyRegion,
+	"yank":            yank,
+	"quote-region":    quoteRegion,
+	"upcase-region":   upcaseRegion,
+	"downcase-region": downcaseRegion,
+})
+
+// region returns the beginning and end of the region. The last return value is
+// false if there is no region.
+func (es *editorState) region() (int, int, bool) {
+	if !es.hasMark || es.mark > len(es.buffer) {
+		return 0, 0, false
+	}
+	if es.mark < es.dot {
+		return es.mark, es.dot, true
+	}
+	return es.dot, es.mark, true
+}
+
+// replaceRegion replaces the region with the result of calling f on its text,
+// moves the dot to the end of the replacement and unsets the mark.
+func (ed *Editor) replaceRegion(f func(string) string) {
+	begin, end, ok := ed.region()
+	if !ok {
+		ed.addTip("no region")
+		return
+	}
+	replacement := f(ed.buffer[begin:end])
+	ed.buffer = ed.buffer[:begin] + replacement + ed.buffer[end:]
+	ed.dot = begin + len(replacement)
+	ed.hasMark = false
+}
+
+func setMark(ed *Editor) {
+	ed.mark = ed.dot
+	ed.hasMark = true
+	ed.markShifted = false
+}
+
+func unsetMark(ed *Editor) {
+	ed.hasMark = false
+}
+
+func exchangeDotAndMark(ed *Editor) {
+	if _, _, ok := ed.region(); !ok {
+		ed.flash()
+		return
+	}
+	ed.dot, ed.mark = ed.mark, ed.dot
+}
+
+// selectWith sets the mark at the dot if it is not set yet, and then moves the
+// dot with the given builtin.
+func selectWith(move func(*Editor)) func(*Editor) {
+	return func(ed *Editor) {
+		if !ed.hasMark || !ed.markShifted {
+			ed.mark = ed.dot
+			ed.hasMark = true
+			ed.markShifted = true
+		}
+		ed.insert.selecting = true
+		move(ed)
+	}
+}
+
+var (
+	selectLeft      = selectWith(moveDotLeft)
+	selectRight     = selectWith(moveDotRight)
+	selectLeftWord  = selectWith(moveDotLeftWord)
+	selectRightWord = selectWith(moveDotRightWord)
+	selectSOL       = selectWith(moveDotSOL)
+	selectEOL       = selectWith(moveDotEOL)
+)
+
+func selectAll(ed *Editor) {
+	ed.mark = 0
+	ed.hasMark = true
+	ed.markShifted = true
+	ed.insert.selecting = true
+	ed.dot = len(ed.buffer)
+}
+
+func killRegion(ed *Editor) {
+	ed.replaceRegion(func(s string) string {
+		ed.cutBuffer = s
+		return ""
+	})
+}
+
+func copyRegion(ed *Editor) {
+	begin, end, ok := ed.region()
+	if !ok {
+		ed.addTip("no region")
+		return
+	}
+	ed.cutBuffer = ed.buffer[begin:end]
+	ed.hasMark = false
+}
+
+func yank(ed *Editor) {
+	ed.insertAtDot(ed.cutBuffer)
+}
+
+func quoteRegion(ed *Editor) {
+	ed.replaceRegion(parse.Quote)
+}
+
+func upcaseRegion(ed *Editor) {
+	ed.replaceRegion(strings.ToUpper)
+}
+
+func downcaseRegion(ed *Editor) {
+	ed.replaceRegion(strings.ToLower)
+}
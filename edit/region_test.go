@@ -0,0 +1,55 @@
+package edit
+
+import "testing"
+
+var regionTests = []struct {
+	buffer     string
+	dot, mark  int
+	builtin    func(*Editor)
+	wantBuffer string
+	wantDot    int
+	wantCut    string
+}{
+	{"echo foo bar", 5, 8, killRegion, "echo  bar", 5, "foo"},
+	{"echo foo bar", 8, 5, killRegion, "echo  bar", 5, "foo"},
+	{"echo foo bar", 8, 5, copyRegion, "echo foo bar", 8, "foo"},
+	{"echo foo bar", 5, 12, upcaseRegion, "echo FOO BAR", 12, ""},
+	{"echo FOO bar", 5, 8, downcaseRegion, "echo foo bar", 8, ""},
+	{"echo foo bar", 5, 12, quoteRegion, "echo 'foo bar'", 14, ""},
+}
+
+func TestRegionBuiltins(t *testing.T) {
+	for _, test := range regionTests {
+		ed := &Editor{}
+		ed.buffer, ed.dot, ed.mark, ed.hasMark = test.buffer, test.dot, test.mark, true
+		test.builtin(ed)
+		if ed.buffer != test.wantBuffer || ed.dot != test.wantDot || ed.cutBuffer != test.wantCut {
+			t.Errorf("(%q, %d, %d) -> (%q, %d, %q), want (%q, %d, %q)",
+				test.buffer, test.dot, test.mark,
+				ed.buffer, ed.dot, ed.cutBuffer,
+				test.wantBuffer, test.wantDot, test.wantCut)
+		}
+		if ed.hasMark {
+			t.Errorf("(%q, %d, %d) -> mark still set", test.buffer, test.dot, test.mark)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	ed := &Editor{}
+	ed.buffer, ed.dot = "echo foo bar", 5
+	selectRightWord(ed)
+	selectRightWord(ed)
+	begin, end, ok := ed.region()
+	if !ok || begin != 5 || end != 12 {
+		t.Errorf("region() -> (%d, %d, %v), want (5, 12, true)", begin, end, ok)
+	}
+	selectLeft(ed)
+	if begin, end, _ = ed.region(); begin != 5 || end != 11 {
+		t.Errorf("region() -> (%d, %d), want (5, 11)", begin, end)
+	}
+	yank(ed)
+	if ed.buffer != "echo foo bar" {
+		t.Errorf("yank with empty cut buffer changed buffer to %q", ed.buffer)
+	}
+}
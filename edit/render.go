@@ -44,6 +44,15 @@ func (lp placeholderRenderer) Render(b *ui.Buffer) {
 
 type listingRenderer struct {
 	lines []ui.Styled
+	// Byte offsets of matched runes to highlight in each line. May be nil.
+	matched [][]int
+}
+
+// matchedLine is a line in a listing, along with the byte offsets of matched
+// runes in it.
+type matchedLine struct {
+	ui.Styled
+	matched []int
 }
 
 func (ls listingRenderer) Render(b *ui.Buffer) {
@@ -51,7 +60,11 @@ func (ls listingRenderer) Render(b *ui.Buffer) {
 		if i > 0 {
 			b.Newline()
 		}
-		b.WriteString(util.ForceWcwidth(line.Text, b.Width), line.Styles.String())
+		var matched []int
+		if ls.matched != nil {
+			matched = ls.matched[i]
+		}
+		writeHighlighted(b, util.ForceWcwidth(line.Text, b.Width), line.Styles, matched)
 	}
 }
 
@@ -123,6 +136,10 @@ type cmdlineRenderer struct {
 	hasHist   bool
 	histBegin int
 	histText  string
+
+	hasRegion   bool
+	regionBegin int
+	regionEnd   int
 }
 
 func newCmdlineRenderer(p []*ui.Styled, l string, s *highlight.Styling, d int, rp []*ui.Styled) *cmdlineRenderer {
@@ -139,6 +156,11 @@ func (clr *cmdlineRenderer) setHist(b int, t string) {
 	clr.histBegin, clr.histText = b, t
 }
 
+func (clr *cmdlineRenderer) setRegion(b, e int) {
+	clr.hasRegion = true
+	clr.regionBegin, clr.regionEnd = b, e
+}
+
 func (clr *cmdlineRenderer) Render(b *ui.Buffer) {
 	b.EagerWrap = true
 
@@ -169,6 +191,8 @@ func (clr *cmdlineRenderer) Render(b *ui.Buffer) {
 	for _, r := range clr.line {
 		if clr.hasComp && clr.compBegin <= i && i < clr.compEnd {
 			// Do nothing. This part is replaced by the completion candidate.
+		} else if clr.hasRegion && clr.regionBegin <= i && i < clr.regionEnd {
+			b.Write(r, joinStyle(applier.Get(), styleForRegion.String()))
 		} else {
 			b.Write(r, applier.Get())
 		}
@@ -201,6 +225,16 @@ func (clr *cmdlineRenderer) Render(b *ui.Buffer) {
 	}
 }
 
+// joinStyle joins two style strings.
+func joinStyle(s1, s2 string) string {
+	if s1 == "" {
+		return s2
+	} else if s2 == "" {
+		return s1
+	}
+	return s1 + ";" + s2
+}
+
 var logEditorRender = false
 
 // editorRenderer renders the entire editor.
@@ -222,6 +256,9 @@ func (er *editorRenderer) Render(buf *ui.Buffer) {
 
 	// bufLine
 	clr := newCmdlineRenderer(es.promptContent, es.buffer, es.styling, es.dot, es.rpromptContent)
+	if begin, end, ok := es.region(); ok {
+		clr.setRegion(begin, end)
+	}
 	// TODO(xiaq): Instead of doing a type switch, expose an API for modes to
 	// modify the text (and mark their part as modified).
 	switch mode := es.mode.(type) {
@@ -15,7 +15,10 @@ var (
 	styleForMode             = ui.Styles{"bold", "lightgray", "bg-magenta"}
 	styleForTip              = ui.Styles{}
 	styleForFilter           = ui.Styles{"underlined"}
+	styleForRegion           = ui.Styles{"inverse"}
+	styleForMatched          = ui.Styles{"bold", "underlined"}
 	styleForSelected         = ui.Styles{"inverse"}
+	styleForMarked           = ui.Styles{"bold"}
 	styleForScrollBarArea    = ui.Styles{"magenta"}
 	styleForScrollBarThumb   = ui.Styles{"magenta", "inverse"}
 
@@ -23,4 +26,7 @@ var (
 	styleForCompletion = ui.Styles{}
 	// Use inverse style for selected completion entry
 	styleForSelectedCompletion = ui.Styles{"inverse"}
+	// Styles for descriptions and group headings of completion candidates
+	styleForCompletionDescription = ui.Styles{"dim"}
+	styleForCompletionGroup       = ui.Styles{"bold", "underlined"}
 )
@@ -0,0 +1,196 @@
+package edit
+
+import (
+	"github.com/elves/elvish/parse"
+)
+
+// Builtins that move the dot or edit the buffer according to the syntax tree,
+// as opposed to the builtins in insert.go that only look at whitespaces.
+//
+// An argument is any non-empty compound expression; since a quoted string is
+// one compound, it is treated as one argument even if it contains spaces.
+// Compound expressions may nest, as in "echo (put foo)".
+
+var (
+	_ = registerBuiltins("", map[string]func(*Editor){
+		"move-dot-left-arg":         moveDotLeftArg,
+		"move-dot-right-arg":        moveDotRightArg,
+		"move-dot-matching-bracket": moveDotMatchingBracket,
+		"kill-arg":                  killArg,
+		"select-form":               selectForm,
+		"select-pipeline":           selectPipeline,
+	})
+)
+
+// parseBuffer parses the buffer. The Chunk returned is never nil, even if
+// there are parse errors.
+func parseBuffer(buffer string) *parse.Chunk {
+	n, _ := parse.Parse("[interactive]", buffer)
+	return n
+}
+
+func moveDotLeftArg(ed *Editor) {
+	chunk := parseBuffer(ed.buffer)
+	for _, cn := range compounds(chunk, nil) {
+		if cn.Begin() < ed.dot {
+			ed.dot = cn.Begin()
+			return
+		}
+	}
+	ed.flash()
+}
+
+func moveDotRightArg(ed *Editor) {
+	chunk := parseBuffer(ed.buffer)
+	cns := compounds(chunk, nil)
+	for i := len(cns) - 1; i >= 0; i-- {
+		if cns[i].Begin() > ed.dot {
+			ed.dot = cns[i].Begin()
+			return
+		}
+	}
+	ed.dot = len(ed.buffer)
+}
+
+func killArg(ed *Editor) {
+	chunk := parseBuffer(ed.buffer)
+	cn := compoundAt(chunk, ed.dot)
+	if cn == nil {
+		ed.flash()
+		return
+	}
+	ed.cutBuffer = cn.SourceText()
+	ed.buffer = ed.buffer[:cn.Begin()] + ed.buffer[cn.End():]
+	ed.dot = cn.Begin()
+}
+
+func moveDotMatchingBracket(ed *Editor) {
+	chunk := parseBuffer(ed.buffer)
+	p, ok := matchingBracket(chunk, ed.dot)
+	if !ok && ed.dot > 0 {
+		// Also try the bracket just before the dot, in case the dot is at the
+		// end of the buffer or right after a closing bracket.
+		p, ok = matchingBracket(chunk, ed.dot-1)
+	}
+	if !ok {
+		ed.flash()
+		return
+	}
+	ed.dot = p
+}
+
+func selectForm(ed *Editor) {
+	selectEnclosing(ed, parse.IsForm)
+}
+
+func selectPipeline(ed *Editor) {
+	selectEnclosing(ed, parse.IsPipeline)
+}
+
+// selectEnclosing sets the region to the innermost node enclosing the dot that
+// satisfies the given predicate.
+func selectEnclosing(ed *Editor, pred func(parse.Node) bool) {
+	chunk := parseBuffer(ed.buffer)
+	for n := findLeafNode(chunk, ed.dot); n != nil; n = n.Parent() {
+		if pred(n) {
+			setMark(ed)
+			ed.mark, ed.dot = n.Begin(), n.End()
+			return
+		}
+	}
+	ed.flash()
+}
+
+// compounds returns all non-empty Compound nodes under n, in reverse order of
+// their beginnings.
+func compounds(n parse.Node, acc []parse.Node) []parse.Node {
+	children := n.Children()
+	for i := len(children) - 1; i >= 0; i-- {
+		acc = compounds(children[i], acc)
+	}
+	if parse.IsCompound(n) && n.Begin() < n.End() {
+		acc = append(acc, n)
+	}
+	return acc
+}
+
+// compoundAt finds the innermost non-empty Compound node containing or
+// adjacent to the given position.
+func compoundAt(n parse.Node, p int) parse.Node {
+	var found parse.Node
+	for _, cn := range compounds(n, nil) {
+		if cn.Begin() <= p && p <= cn.End() {
+			if found == nil || cn.End()-cn.Begin() < found.End()-found.Begin() {
+				found = cn
+			}
+		}
+	}
+	return found
+}
+
+// bracketPairs lists all pairs of brackets, as they appear as Sep nodes.
+var bracketPairs = [][2]string{{"(", ")"}, {"?(", ")"}, {"[", "]"}, {"{", "}"}}
+
+// matchingBracket finds the position of the bracket matching the one at p. The
+// last return value is false if there is no bracket at p or the bracket is
+// unmatched.
+//
+// In the syntax tree, a pair of brackets are always siblings, and brackets
+// nested inside them are always in descendants of siblings between them, with
+// the exception of consecutive pairs like "$a[0][1]" or "[x]{ put $x }".
+func matchingBracket(n parse.Node, p int) (int, bool) {
+	sep := findSepAt(n, p)
+	if sep == nil {
+		return 0, false
+	}
+	siblings := sep.Parent().Children()
+	i := indexOfNode(siblings, sep)
+	text := sep.SourceText()
+
+	for _, pair := range bracketPairs {
+		opener, closer := pair[0], pair[1]
+		switch text {
+		case opener:
+			for _, ch := range siblings[i+1:] {
+				switch ch.SourceText() {
+				case opener:
+					return 0, false
+				case closer:
+					return ch.Begin(), true
+				}
+			}
+		case closer:
+			for j := i - 1; j >= 0; j-- {
+				switch siblings[j].SourceText() {
+				case closer:
+					return 0, false
+				case opener:
+					return siblings[j].Begin(), true
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+// findSepAt finds the Sep node that starts at p.
+func findSepAt(n parse.Node, p int) parse.Node {
+	if _, ok := n.(*parse.Sep); ok && n.Begin() == p {
+		return n
+	}
+	for _, ch := range n.Children() {
+		if ch.Begin() <= p && p < ch.End() {
+			return findSepAt(ch, p)
+		}
+	}
+	return nil
+}
+
+func indexOfNode(nodes []parse.Node, n parse.Node) int {
+	for i, m := range nodes {
+		if m == n {
+			return i
+		}
+	}
+	return -1
+}
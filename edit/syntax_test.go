@@ -0,0 +1,60 @@
+package edit
+
+import "testing"
+
+var syntaxMotionTests = []struct {
+	buffer     string
+	dot        int
+	builtin    func(*Editor)
+	wantBuffer string
+	wantDot    int
+}{
+	{"echo 'foo bar' baz", 18, moveDotLeftArg, "echo 'foo bar' baz", 15},
+	{"echo 'foo bar' baz", 15, moveDotLeftArg, "echo 'foo bar' baz", 5},
+	{"echo 'foo bar' baz", 10, moveDotLeftArg, "echo 'foo bar' baz", 5},
+	{"echo 'foo bar' baz", 5, moveDotRightArg, "echo 'foo bar' baz", 15},
+	{"echo 'foo bar' baz", 15, moveDotRightArg, "echo 'foo bar' baz", 18},
+	{"echo (put a)", 0, moveDotRightArg, "echo (put a)", 5},
+	{"echo (put a)", 5, moveDotRightArg, "echo (put a)", 6},
+
+	{"echo 'foo bar' baz", 8, killArg, "echo  baz", 5},
+	{"echo 'foo bar' baz", 18, killArg, "echo 'foo bar' ", 15},
+
+	{"echo (put [a b])", 5, moveDotMatchingBracket, "echo (put [a b])", 15},
+	{"echo (put [a b])", 15, moveDotMatchingBracket, "echo (put [a b])", 5},
+	{"echo (put [a b])", 16, moveDotMatchingBracket, "echo (put [a b])", 5},
+	{"echo (put [a b])", 10, moveDotMatchingBracket, "echo (put [a b])", 14},
+	{"echo $a[0][1]", 10, moveDotMatchingBracket, "echo $a[0][1]", 12},
+	{"echo ?(fail x)", 5, moveDotMatchingBracket, "echo ?(fail x)", 13},
+	{"echo ?(fail x)", 13, moveDotMatchingBracket, "echo ?(fail x)", 5},
+	{"echo 'a (b'", 8, moveDotMatchingBracket, "echo 'a (b'", 8},
+}
+
+func TestSyntaxMotions(t *testing.T) {
+	for _, test := range syntaxMotionTests {
+		ed := &Editor{}
+		ed.buffer, ed.dot = test.buffer, test.dot
+		test.builtin(ed)
+		if ed.buffer != test.wantBuffer || ed.dot != test.wantDot {
+			t.Errorf("(%q, %d) -> (%q, %d), want (%q, %d)",
+				test.buffer, test.dot, ed.buffer, ed.dot,
+				test.wantBuffer, test.wantDot)
+		}
+	}
+}
+
+func TestSelectEnclosing(t *testing.T) {
+	ed := &Editor{}
+	ed.buffer, ed.dot = "echo a | each [x]{ put $x }; echo b", 6
+	selectForm(ed)
+	if begin, end, ok := ed.region(); !ok || begin != 0 || end != 7 {
+		t.Errorf("region after selectForm is (%d, %d, %v), want (0, 7, true)",
+			begin, end, ok)
+	}
+	ed.dot = 6
+	selectPipeline(ed)
+	if begin, end, ok := ed.region(); !ok || begin != 0 || end != 27 {
+		t.Errorf("region after selectPipeline is (%d, %d, %v), want (0, 27, true)",
+			begin, end, ok)
+	}
+}
@@ -57,6 +57,31 @@ func addToBuiltinFns(moreFns []*BuiltinFn) {
 	builtinFns = append(builtinFns, moreFns...)
 }
 
+// builtinOptNames maps the names of builtin functions to the names of the
+// options they accept.
+var builtinOptNames = map[string][]string{}
+
+// AddBuiltinOptNames declares the options accepted by builtin functions, keyed
+// by the names of the functions. The option names are used for completion; the
+// functions still need to scan the options themselves.
+func AddBuiltinOptNames(m map[string][]string) {
+	for name, optNames := range m {
+		builtinOptNames[name] = optNames
+	}
+}
+
+// FnOptNames returns the names of the options accepted by a function, or nil
+// if they are not known.
+func FnOptNames(fn Fn) []string {
+	switch fn := fn.(type) {
+	case *Closure:
+		return fn.OptNames
+	case *BuiltinFn:
+		return builtinOptNames[fn.Name]
+	}
+	return nil
+}
+
 // Builtins that have not been put into their own groups go here.
 
 var ErrArgs = errors.New("args error")
@@ -34,6 +34,9 @@ func init() {
 
 		{"keys", keys},
 	})
+	AddBuiltinOptNames(map[string][]string{
+		"range": {"step"},
+	})
 }
 
 func nsFn(ec *Frame, args []types.Value, opts map[string]types.Value) {
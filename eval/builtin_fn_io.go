@@ -39,6 +39,10 @@ func init() {
 		{"prclose", prclose},
 		{"pwclose", pwclose},
 	})
+	AddBuiltinOptNames(map[string][]string{
+		"print": {"sep"},
+		"echo":  {"sep"},
+	})
 }
 
 func put(ec *Frame, args []types.Value, opts map[string]types.Value) {
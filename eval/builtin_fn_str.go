@@ -47,6 +47,10 @@ func init() {
 
 		{"eawk", eawk},
 	})
+	AddBuiltinOptNames(map[string][]string{
+		"splits":   {"max"},
+		"replaces": {"max"},
+	})
 }
 
 func wrapStrCompare(cmp func(a, b string) bool) BuiltinFnImpl {
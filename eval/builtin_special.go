@@ -276,7 +276,7 @@ func loadModule(ec *Frame, name string) Ns {
 		ec.Evaler, meta,
 		modGlobal, make(Ns),
 		ec.ports,
-		0, len(code), ec.addTraceback(), false,
+		0, len(code), ec.addTraceback(), false, ec.intCh,
 	}
 
 	op, err := newEc.Compile(n, meta)
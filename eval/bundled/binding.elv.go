@@ -17,6 +17,8 @@ fn install {
         &Backspace=  $edit:kill-rune-left~
         &Alt-Up=     $edit:move-dot-up~
         &Alt-Down=   $edit:move-dot-down~
+        &Alt-Left=   $edit:move-dot-left-arg~
+        &Alt-Right=  $edit:move-dot-right-arg~
         &Alt-Enter=  $edit:insert-key~
         &Alt-.=      $edit:insert-last-word~
         &Alt-1=      $edit:lastcmd:start~
@@ -33,11 +35,22 @@ fn install {
         &Ctrl-U=     $edit:kill-line-left~
         &Ctrl-V=     $edit:insert-raw~
         &Ctrl-W=     $edit:kill-word-left~
+        &Ctrl-X=     $edit:kill-region~
+        &Ctrl-Y=     $edit:yank~
+        &Alt-w=      $edit:copy-region~
+
+        &Shift-Left=       $edit:select-left~
+        &Shift-Right=      $edit:select-right~
+        &Shift-Home=       $edit:select-sol~
+        &Shift-End=        $edit:select-eol~
+        &Ctrl-Shift-Left=  $edit:select-left-word~
+        &Ctrl-Shift-Right= $edit:select-right-word~
     ])
 
     edit:command:binding = (edit:binding-table [
         &Default= $edit:command:default~
         &'$'=     $edit:move-dot-eol~
+        &'%'=     $edit:move-dot-matching-bracket~
         &0=       $edit:move-dot-sol~
         &D=       $edit:kill-line-right~
         &b=       $edit:move-dot-left-word~
@@ -68,7 +81,7 @@ fn install {
         &Enter=     $edit:completion:accept~
         &Shift-Tab= $edit:completion:up-cycle~
         &Ctrl-F=    $edit:completion:trigger-filter~
-        &'Ctrl-['=  $edit:insert:start~
+        &'Ctrl-['=  $edit:completion:close~
     ])
 
     edit:listing:binding = (edit:binding-table [
@@ -88,9 +101,13 @@ fn install {
     edit:histlist:binding = (edit:binding-table [
         &Ctrl-D= $edit:histlist:toggle-dedup~
         &Ctrl-G= $edit:histlist:toggle-case-sensitivity~
+        &Alt-c=  $edit:histlist:toggle-cwd-filter~
+        &Alt-s=  $edit:histlist:toggle-success-filter~
     ])
 
-    edit:location:binding = (edit:binding-table [&])
+    edit:location:binding = (edit:binding-table [
+        &Ctrl-D= $edit:location:remove~
+    ])
 
     edit:lastcmd:binding = (edit:binding-table [
         &Default= $edit:lastcmd:alt-default~
@@ -110,6 +127,16 @@ fn install {
         &Alt-Enter= $edit:navigation:insert-selected~
         &Ctrl-F=    $edit:navigation:trigger-filter~
         &Ctrl-H=    $edit:navigation:trigger-shown-hidden~
+        &Alt-m=     $edit:navigation:toggle-mark~
+        &Alt-u=     $edit:navigation:clear-marks~
+        &Alt-r=     $edit:navigation:rename~
+        &Alt-d=     $edit:navigation:delete~
+        &Alt-n=     $edit:navigation:mkdir~
+        &Alt-c=     $edit:navigation:copy-marked~
+        &Alt-v=     $edit:navigation:move-marked~
+        &Alt-a=     $edit:navigation:sort-by-name~
+        &Alt-s=     $edit:navigation:sort-by-size~
+        &Alt-t=     $edit:navigation:sort-by-mtime~
         &'Ctrl-['=  $edit:insert:start~
     ])
 
@@ -42,7 +42,7 @@ fn location {
 
   edit:-narrow-read {
     put $@candidates
-  } [arg]{
+  } [arg @_]{
     cd $arg[content]
     for hook $after-location { $hook }
   } &modeline="[narrow] Location " &ignore-case=$true
@@ -59,8 +59,8 @@ fn history {
 
   edit:-narrow-read {
     put $@candidates
-  } [arg]{
-    edit:replace-input $arg[content]
+  } [@args]{
+    edit:replace-input (joins "\n" [(for arg $args { put $arg[content] })])
     for hook $after-history { $hook }
   } &modeline="[narrow] History " &keep-bottom=$true &ignore-case=$true
 }
@@ -84,8 +84,8 @@ fn lastcmd {
   })]
   edit:-narrow-read {
     put $@candidates
-  } [arg]{
-    edit:insert-at-dot $arg[content]
+  } [@args]{
+    edit:insert-at-dot (joins " " [(for arg $args { put $arg[content] })])
     for hook $after-lastcmd { $hook }
   } &modeline="[narrow] Lastcmd " &auto-commit=$true &bindings=[&M-1={ edit:narrow:accept-close }] &ignore-case=$true
 }
@@ -116,7 +116,7 @@ fn bind-trigger-keys [&location=C-l &history=C-r &lastcmd=M-1]{
 -bind PageUp    $edit:narrow:page-up~
 -bind Down      $edit:narrow:down~
 -bind PageDown  $edit:narrow:page-down~
--bind Tab       $edit:narrow:down-cycle~
+-bind Tab       $edit:narrow:toggle-mark~
 -bind S-Tab     $edit:narrow:up-cycle~
 -bind Backspace $edit:narrow:backspace~
 -bind Enter     $edit:narrow:accept-close~
@@ -0,0 +1,102 @@
+package daemon
+
+import (
+	"strconv"
+
+	"github.com/elves/elvish/daemon"
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
+)
+
+// Admin builtins. daemon:status, daemon:clients and daemon:db-stats output
+// maps describing the daemon, its connections and its database. daemon:compact
+// compacts the database and outputs its sizes before and after. daemon:shutdown
+// asks the daemon to quit; it is respawned when the shell next needs it.
+
+func daemonStatus(client *daemon.Client) eval.BuiltinFnImpl {
+	return func(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+		eval.TakeNoArg(args)
+		eval.TakeNoOpt(opts)
+		status, err := client.Status()
+		maybeThrow(err)
+		ec.OutputChan() <- makeMap(map[string]types.Value{
+			"version":     types.String(strconv.Itoa(status.Version)),
+			"pid":         types.String(strconv.Itoa(status.Pid)),
+			"started":     nsToSeconds(status.Started),
+			"sock":        types.String(status.SockPath),
+			"db":          types.String(status.DbPath),
+			"clients":     types.String(strconv.Itoa(status.Clients)),
+			"store-error": types.String(status.StoreError),
+		})
+	}
+}
+
+func daemonClients(client *daemon.Client) eval.BuiltinFnImpl {
+	return func(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+		eval.TakeNoArg(args)
+		eval.TakeNoOpt(opts)
+		clients, err := client.Clients()
+		maybeThrow(err)
+		out := ec.OutputChan()
+		for _, c := range clients {
+			out <- makeMap(map[string]types.Value{
+				"id":        types.String(strconv.Itoa(c.ID)),
+				"connected": nsToSeconds(c.Connected),
+			})
+		}
+	}
+}
+
+func daemonDBStats(client *daemon.Client) eval.BuiltinFnImpl {
+	return func(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+		eval.TakeNoArg(args)
+		eval.TakeNoOpt(opts)
+		stats, err := client.DBStats()
+		maybeThrow(err)
+		entries := make(map[string]types.Value, len(stats.Entries))
+		for name, n := range stats.Entries {
+			entries[name] = types.String(strconv.Itoa(n))
+		}
+		ec.OutputChan() <- makeMap(map[string]types.Value{
+			"path":           types.String(stats.Path),
+			"size":           types.String(strconv.FormatInt(stats.Size, 10)),
+			"schema-version": types.String(strconv.Itoa(stats.SchemaVersion)),
+			"entries":        makeMap(entries),
+		})
+	}
+}
+
+func daemonCompact(client *daemon.Client) eval.BuiltinFnImpl {
+	return func(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+		eval.TakeNoArg(args)
+		eval.TakeNoOpt(opts)
+		before, after, err := client.Compact()
+		maybeThrow(err)
+		ec.OutputChan() <- makeMap(map[string]types.Value{
+			"before": types.String(strconv.FormatInt(before, 10)),
+			"after":  types.String(strconv.FormatInt(after, 10)),
+		})
+	}
+}
+
+func daemonShutdown(client *daemon.Client) eval.BuiltinFnImpl {
+	return func(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+		eval.TakeNoArg(args)
+		eval.TakeNoOpt(opts)
+		maybeThrow(client.Shutdown())
+	}
+}
+
+func makeMap(m map[string]types.Value) types.Map {
+	vm := make(map[types.Value]types.Value, len(m))
+	for k, v := range m {
+		vm[types.String(k)] = v
+	}
+	return types.MakeMap(vm)
+}
+
+// nsToSeconds converts nanoseconds since the Unix epoch to seconds, the unit
+// used by the hooks of the editor.
+func nsToSeconds(ns int64) types.String {
+	return types.String(strconv.FormatFloat(float64(ns)/1e9, 'f', -1, 64))
+}
@@ -13,6 +13,8 @@ import (
 	"github.com/elves/elvish/util"
 )
 
+var logger = util.GetLogger("[eval/daemon] ")
+
 // errDontKnowHowToSpawnDaemon is thrown by daemon:spawn when the Evaler's
 // DaemonSpawner field is nil.
 var errDontKnowHowToSpawnDaemon = errors.New("don't know how to spawn daemon")
@@ -39,10 +41,22 @@ func Ns(daemon *daemon.Client, spawner *daemonp.Daemon) eval.Ns {
 			util.Throw(err)
 		}
 	}
+	w := &watches{client: daemon, stops: make(map[watchKey][]func())}
 	return eval.Ns{
 		"pid":  vartypes.NewRoCallback(daemonPid),
 		"sock": vartypes.NewRo(types.String(daemon.SockPath())),
 
-		"spawn" + eval.FnSuffix: vartypes.NewRo(&eval.BuiltinFn{"daemon:spawn", daemonSpawn}),
+		"spawn" + eval.FnSuffix:   vartypes.NewRo(&eval.BuiltinFn{"daemon:spawn", daemonSpawn}),
+		"watch" + eval.FnSuffix:   vartypes.NewRo(&eval.BuiltinFn{"daemon:watch", w.watch}),
+		"unwatch" + eval.FnSuffix: vartypes.NewRo(&eval.BuiltinFn{"daemon:unwatch", w.unwatch}),
+
+		"cas-shared-var" + eval.FnSuffix: vartypes.NewRo(&eval.BuiltinFn{"daemon:cas-shared-var", casSharedVar(daemon)}),
+		"inc-shared-var" + eval.FnSuffix: vartypes.NewRo(&eval.BuiltinFn{"daemon:inc-shared-var", incSharedVar(daemon)}),
+
+		"status" + eval.FnSuffix:   vartypes.NewRo(&eval.BuiltinFn{"daemon:status", daemonStatus(daemon)}),
+		"clients" + eval.FnSuffix:  vartypes.NewRo(&eval.BuiltinFn{"daemon:clients", daemonClients(daemon)}),
+		"db-stats" + eval.FnSuffix: vartypes.NewRo(&eval.BuiltinFn{"daemon:db-stats", daemonDBStats(daemon)}),
+		"compact" + eval.FnSuffix:  vartypes.NewRo(&eval.BuiltinFn{"daemon:compact", daemonCompact(daemon)}),
+		"shutdown" + eval.FnSuffix: vartypes.NewRo(&eval.BuiltinFn{"daemon:shutdown", daemonShutdown(daemon)}),
 	}
 }
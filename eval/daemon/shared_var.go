@@ -0,0 +1,66 @@
+package daemon
+
+import (
+	"github.com/elves/elvish/daemon"
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
+	"github.com/elves/elvish/util"
+)
+
+// Atomic operations on shared variables, for coordinating sessions:
+//
+//     daemon:cas-shared-var $name $old $new
+//
+// sets $shared:name to $new if it is $old, and outputs whether it did. A
+// nonexistent variable is considered to be an empty string.
+//
+//     daemon:inc-shared-var $name &by=1
+//
+// adds to the numeric value of $shared:name, which is considered to be 0 if it
+// does not exist, and outputs the new value.
+
+func init() {
+	eval.AddBuiltinOptNames(map[string][]string{
+		"daemon:inc-shared-var": {"by"},
+	})
+}
+
+func casSharedVar(client *daemon.Client) eval.BuiltinFnImpl {
+	return func(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+		var (
+			name     string
+			old, new types.Value
+		)
+		eval.ScanArgs(args, &name, &old, &new)
+		eval.TakeNoOpt(opts)
+
+		oldEncoded, err := eval.EncodeSharedValue(old)
+		maybeThrow(err)
+		newEncoded, err := eval.EncodeSharedValue(new)
+		maybeThrow(err)
+		swapped, err := client.CompareAndSwapSharedVar(name, oldEncoded, newEncoded)
+		maybeThrow(err)
+		ec.OutputChan() <- types.Bool(swapped)
+	}
+}
+
+func incSharedVar(client *daemon.Client) eval.BuiltinFnImpl {
+	return func(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+		var (
+			name string
+			by   float64
+		)
+		eval.ScanArgs(args, &name)
+		eval.ScanOpts(opts, eval.OptToScan{"by", &by, types.String("1")})
+
+		value, err := client.IncSharedVar(name, by)
+		maybeThrow(err)
+		ec.OutputChan() <- types.String(value)
+	}
+}
+
+func maybeThrow(err error) {
+	if err != nil {
+		util.Throw(err)
+	}
+}
@@ -0,0 +1,146 @@
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/elves/elvish/daemon"
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
+)
+
+// watches implements daemon:watch and daemon:unwatch, which let every shell
+// react to changes of shared variables made by any shell, e.g.:
+//
+//     daemon:watch ssh-auth-sock [c]{ E:SSH_AUTH_SOCK = $c[value] }
+//
+// The callback is called with a map with keys name, value and deleted, in the
+// background; its byte output and errors are shown as notifications when the
+// editor is active. With &prefix, changes to all shared variables whose names
+// start with the given name are watched.
+type watches struct {
+	client *daemon.Client
+	mutex  sync.Mutex
+	stops  map[watchKey][]func()
+}
+
+func init() {
+	eval.AddBuiltinOptNames(map[string][]string{
+		"daemon:watch":   {"prefix"},
+		"daemon:unwatch": {"prefix"},
+	})
+}
+
+type watchKey struct {
+	name   string
+	prefix bool
+}
+
+func (w *watches) watch(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+	var (
+		name     string
+		callback eval.Fn
+		prefix   bool
+	)
+	eval.ScanArgs(args, &name, &callback)
+	eval.ScanOpts(opts, eval.OptToScan{"prefix", &prefix, types.Bool(false)})
+
+	ev := ec.Evaler
+	stop := w.client.WatchSharedVars(name, prefix, func(c daemon.SharedVarChange) {
+		callWatchCallback(ev, callback, c)
+	})
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	key := watchKey{name, prefix}
+	w.stops[key] = append(w.stops[key], stop)
+}
+
+// unwatch stops all watches of the name with the same &prefix.
+func (w *watches) unwatch(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+	var (
+		name   string
+		prefix bool
+	)
+	eval.ScanArgs(args, &name)
+	eval.ScanOpts(opts, eval.OptToScan{"prefix", &prefix, types.Bool(false)})
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	key := watchKey{name, prefix}
+	for _, stop := range w.stops[key] {
+		stop()
+	}
+	delete(w.stops, key)
+}
+
+// callWatchCallback calls a watch callback with a change. Its byte output and
+// errors are shown with showWatchOutput; its value output is discarded.
+func callWatchCallback(ev *eval.Evaler, callback eval.Fn, c daemon.SharedVarChange) {
+	change, err := changeToMap(c)
+	if err != nil {
+		showWatchOutput(ev, os.Stderr, "shared variable watcher error: "+err.Error())
+		return
+	}
+	var out []byte
+	valuesCb := func(ch <-chan types.Value) {
+		for range ch {
+		}
+	}
+	bytesCb := func(r *os.File) {
+		var err error
+		out, err = ioutil.ReadAll(r)
+		if err != nil {
+			logger.Println("error reading watcher byte output:", err)
+		}
+	}
+	ports := []*eval.Port{
+		eval.DevNullClosedChan,
+		{}, // Will be replaced when capturing output
+		{File: os.Stderr, Chan: eval.BlackholeChan},
+	}
+	ec := eval.NewTopFrame(ev, eval.NewInternalSource("[shared variable watcher]"), ports)
+	err = ec.PCaptureOutputInner(callback, []types.Value{change}, eval.NoOpts, valuesCb, bytesCb)
+	if len(out) > 0 {
+		showWatchOutput(ev, os.Stdout, string(out))
+	}
+	if err != nil {
+		showWatchOutput(ev, os.Stderr, "shared variable watcher error: "+err.Error())
+	}
+}
+
+// showWatchOutput shows the output of a watch callback, which runs in the
+// background. When the editor is active, the output is shown as notifications,
+// since writing to the terminal would mess up the editor; otherwise it is
+// written to the file.
+func showWatchOutput(ev *eval.Evaler, file *os.File, text string) {
+	text = strings.TrimSuffix(text, "\n")
+	if ev.Editor != nil {
+		m := ev.Editor.ActiveMutex()
+		m.Lock()
+		defer m.Unlock()
+
+		if ev.Editor.Active() {
+			for _, line := range strings.Split(text, "\n") {
+				ev.Editor.Notify("%s", line)
+			}
+			return
+		}
+	}
+	file.WriteString(text + "\n")
+}
+
+// changeToMap converts a change to the map passed to watch callbacks, decoding
+// the new value.
+func changeToMap(c daemon.SharedVarChange) (types.Value, error) {
+	value, err := eval.DecodeSharedValue(c.Value)
+	if err != nil {
+		return nil, err
+	}
+	return types.MakeMap(map[types.Value]types.Value{
+		types.String("name"):    types.String(c.Name),
+		types.String("value"):   value,
+		types.String("deleted"): types.Bool(c.Deleted),
+	}), nil
+}
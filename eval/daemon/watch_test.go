@@ -0,0 +1,61 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/elves/elvish/daemon"
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
+	"github.com/elves/elvish/util"
+)
+
+func TestChangeToMap(t *testing.T) {
+	list := types.MakeList(types.String("a"), types.String("b"))
+	encoded, err := eval.EncodeSharedValue(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := changeToMap(daemon.SharedVarChange{Name: "x", Value: encoded})
+	if err != nil {
+		t.Fatalf("changeToMap -> error %v", err)
+	}
+	value := m.(types.Map).IndexOne(types.String("value"))
+	if !list.Equal(value) {
+		t.Errorf("value in change is %v, want %v", value, list)
+	}
+}
+
+// fakeEditor records notifications, and is always active.
+type fakeEditor struct {
+	mutex         sync.Mutex
+	notifications []string
+}
+
+func (ed *fakeEditor) Active() bool             { return true }
+func (ed *fakeEditor) ActiveMutex() *sync.Mutex { return &ed.mutex }
+func (ed *fakeEditor) Notify(format string, args ...interface{}) {
+	ed.notifications = append(ed.notifications, fmt.Sprintf(format, args...))
+}
+
+func TestCallWatchCallbackNotifies(t *testing.T) {
+	ev := eval.NewEvaler()
+	defer ev.Close()
+	ed := &fakeEditor{}
+	ev.Editor = ed
+	callback := &eval.BuiltinFn{"callback", func(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+		ec.OutputChan() <- types.String("discarded")
+		ec.OutputFile().WriteString("line 1\nline 2\n")
+		util.Throw(errors.New("oops"))
+	}}
+	encoded, _ := eval.EncodeSharedValue(types.String("v"))
+
+	callWatchCallback(ev, callback, daemon.SharedVarChange{Name: "x", Value: encoded})
+	want := []string{"line 1", "line 2", "shared variable watcher error: oops"}
+	if !reflect.DeepEqual(ed.notifications, want) {
+		t.Errorf("notifications are %q, want %q", ed.notifications, want)
+	}
+}
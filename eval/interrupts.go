@@ -7,6 +7,12 @@ func (ec *Frame) Interrupts() <-chan struct{} {
 	return ec.intCh
 }
 
+// SetInterrupts sets the channel returned by Interrupts. It also affects
+// Frames forked from this Frame afterwards, but not Frames forked before.
+func (ec *Frame) SetInterrupts(ch <-chan struct{}) {
+	ec.intCh = ch
+}
+
 var ErrInterrupted = errors.New("interrupted")
 
 // CheckInterrupts checks whether there has been an interrupt, and throws
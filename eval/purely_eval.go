@@ -85,3 +85,22 @@ func (ev *Evaler) PurelyEvalPrimary(pn *parse.Primary) types.Value {
 	}
 	return nil
 }
+
+// PurelyResolveFn resolves a command name to a function like the head of a
+// form, without causing any side effects. If the name does not resolve to a
+// function variable, it returns nil; unlike the evaluation of forms, it does
+// not fall back to external commands.
+func (ev *Evaler) PurelyResolveFn(name string) Fn {
+	explode, ns, name := ParseVariable(name)
+	// Resolving variables in shared: requires talking to the daemon.
+	if explode || ns == "shared" {
+		return nil
+	}
+	ec := NewTopFrame(ev, NewInternalSource("[purely eval]"), nil)
+	if variable := ec.ResolveVar(ns, name+FnSuffix); variable != nil {
+		if fn, ok := variable.Get().(Fn); ok {
+			return fn
+		}
+	}
+	return nil
+}
@@ -18,11 +18,20 @@ func Ns() eval.Ns {
 }
 
 var fns = []*eval.BuiltinFn{
-	{"quote", eval.WrapStringToString(regexp.QuoteMeta)},
-	{"match", match},
-	{"find", find},
-	{"replace", replace},
-	{"split", split},
+	{"re:quote", eval.WrapStringToString(regexp.QuoteMeta)},
+	{"re:match", match},
+	{"re:find", find},
+	{"re:replace", replace},
+	{"re:split", split},
+}
+
+func init() {
+	eval.AddBuiltinOptNames(map[string][]string{
+		"re:match":   {"posix"},
+		"re:find":    {"posix", "longest", "max"},
+		"re:replace": {"posix", "longest", "literal"},
+		"re:split":   {"posix", "longest", "max"},
+	})
 }
 
 func match(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
@@ -116,12 +116,7 @@ func ScanOptsToStruct(m map[string]types.Value, structPtr interface{}) {
 			continue
 		}
 
-		f := struc.Type().Field(i)
-		optName := f.Tag.Get("name")
-		if optName == "" {
-			optName = util.CamelToDashed(f.Name)
-		}
-		fieldIdxForOpt[optName] = i
+		fieldIdxForOpt[optNameOfField(struc.Type().Field(i))] = i
 	}
 
 	for k, v := range m {
@@ -132,3 +127,23 @@ func ScanOptsToStruct(m map[string]types.Value, structPtr interface{}) {
 		scanValueToGo(v, struc.Field(fieldIdx).Addr().Interface())
 	}
 }
+
+// StructOptNames returns the names of the options that ScanOptsToStruct
+// accepts for a struct, in the order of the fields.
+func StructOptNames(structPtr interface{}) []string {
+	struc := reflect.ValueOf(structPtr).Elem()
+	var names []string
+	for i := 0; i < struc.Type().NumField(); i++ {
+		if struc.Field(i).CanSet() {
+			names = append(names, optNameOfField(struc.Type().Field(i)))
+		}
+	}
+	return names
+}
+
+func optNameOfField(f reflect.StructField) string {
+	if optName := f.Tag.Get("name"); optName != "" {
+		return optName
+	}
+	return util.CamelToDashed(f.Name)
+}
@@ -211,3 +211,16 @@ func TestScanArg(t *testing.T) {
 func indirect(i interface{}) interface{} {
 	return reflect.Indirect(reflect.ValueOf(i)).Interface()
 }
+
+func TestStructOptNames(t *testing.T) {
+	var opts struct {
+		IgnoreCase bool
+		MaxLines   int
+		Sep        string `name:"separator"`
+		private    bool
+	}
+	want := []string{"ignore-case", "max-lines", "separator"}
+	if got := StructOptNames(&opts); !reflect.DeepEqual(got, want) {
+		t.Errorf("StructOptNames -> %v, want %v", got, want)
+	}
+}
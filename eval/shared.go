@@ -1,6 +1,9 @@
 package eval
 
 import (
+	"encoding/json"
+	"strings"
+
 	"github.com/elves/elvish/daemon"
 	"github.com/elves/elvish/eval/types"
 )
@@ -11,11 +14,49 @@ type sharedVariable struct {
 }
 
 func (sv sharedVariable) Set(val types.Value) error {
-	return sv.store.SetSharedVar(sv.name, types.ToString(val))
+	encoded, err := EncodeSharedValue(val)
+	if err != nil {
+		return err
+	}
+	return sv.store.SetSharedVar(sv.name, encoded)
 }
 
 func (sv sharedVariable) Get() types.Value {
 	value, err := sv.store.SharedVar(sv.name)
 	maybeThrow(err)
-	return types.String(value)
+	decoded, err := DecodeSharedValue(value)
+	maybeThrow(err)
+	return decoded
+}
+
+// Shared variables are stored as strings. Strings are stored as they are, so
+// that they can be read by older versions of Elvish; other values, like lists
+// and maps, are stored as JSON after sharedJSONPrefix. Strings that start with
+// a NUL byte are also stored as JSON, so that they are not mistaken for
+// encoded values.
+const sharedJSONPrefix = "\x00json:"
+
+// EncodeSharedValue encodes a value for storing in a shared variable.
+func EncodeSharedValue(v types.Value) (string, error) {
+	if s, ok := v.(types.String); ok && !strings.HasPrefix(string(s), "\x00") {
+		return string(s), nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return sharedJSONPrefix + string(data), nil
+}
+
+// DecodeSharedValue decodes a value stored in a shared variable.
+func DecodeSharedValue(s string) (types.Value, error) {
+	if !strings.HasPrefix(s, sharedJSONPrefix) {
+		return types.String(s), nil
+	}
+	var data interface{}
+	err := json.Unmarshal([]byte(s[len(sharedJSONPrefix):]), &data)
+	if err != nil {
+		return nil, err
+	}
+	return FromJSONInterface(data), nil
 }
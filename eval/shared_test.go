@@ -0,0 +1,36 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/elves/elvish/eval/types"
+)
+
+var sharedValueTests = []struct {
+	value   types.Value
+	encoded string
+}{
+	{types.String("foo"), "foo"},
+	{types.String("\x00x"), sharedJSONPrefix + `"\u0000x"`},
+	{types.MakeList(types.String("a"), types.Bool(true)), sharedJSONPrefix + `["a",true]`},
+	{types.MakeMap(map[types.Value]types.Value{types.String("k"): types.String("v")}),
+		sharedJSONPrefix + `{"k":"v"}`},
+}
+
+func TestEncodeSharedValue(t *testing.T) {
+	for _, test := range sharedValueTests {
+		encoded, err := EncodeSharedValue(test.value)
+		if encoded != test.encoded || err != nil {
+			t.Errorf("EncodeSharedValue(%v) -> (%q, %v), want (%q, nil)",
+				test.value, encoded, err, test.encoded)
+		}
+		decoded, err := DecodeSharedValue(encoded)
+		if !test.value.Equal(decoded) || err != nil {
+			t.Errorf("DecodeSharedValue(%q) -> (%v, %v), want (%v, nil)",
+				encoded, decoded, err, test.value)
+		}
+	}
+	if _, err := DecodeSharedValue(sharedJSONPrefix + "["); err == nil {
+		t.Errorf("DecodeSharedValue of bad JSON -> nil error")
+	}
+}
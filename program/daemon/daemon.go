@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"github.com/elves/elvish/store"
 )
 
 // Daemon keeps configurations for the daemon sub-program. It can be used both
@@ -16,7 +18,8 @@ type Daemon struct {
 	// BinPath is the path to the Elvish binary itself, used when forking. This
 	// field is optional only when spawning the daemon.
 	BinPath string
-	// DbPath is the path to the database.
+	// DbPath is the path to the database. It may be prefixed with a scheme
+	// like "log://" to select the storage backend.
 	DbPath string
 	// SockPath is the path to the socket on which the daemon will serve
 	// requests.
@@ -68,7 +71,12 @@ func (d *Daemon) Spawn() error {
 		return absPath
 	}
 	binPath = abs("BinPath", binPath)
-	dbPath := abs("DbPath", d.DbPath)
+	// DbPath may have a scheme selecting the storage backend, which is kept.
+	dbScheme, dbPath := store.SplitDBURL(d.DbPath)
+	dbPath = abs("DbPath", dbPath)
+	if dbScheme != "" {
+		dbPath = dbScheme + "://" + dbPath
+	}
 	sockPath := abs("SockPath", d.SockPath)
 	logPathPrefix := abs("LogPathPrefix", d.LogPathPrefix)
 	if pathError != nil {
@@ -34,7 +34,7 @@ type flagSet struct {
 
 	Help, Version, BuildInfo, JSON bool
 
-	CodeInArg, CompileOnly bool
+	CodeInArg, CompileOnly, Private bool
 
 	Web  bool
 	Port int
@@ -63,6 +63,7 @@ func newFlagSet() *flagSet {
 
 	f.BoolVar(&f.CodeInArg, "c", false, "take first argument as code to execute")
 	f.BoolVar(&f.CompileOnly, "compileonly", false, "Parse/Compile but do not execute")
+	f.BoolVar(&f.Private, "private", false, "keep command history in this session only")
 
 	f.BoolVar(&f.Web, "web", false, "run backend of web interface")
 	f.IntVar(&f.Port, "port", defaultWebPort, "the port of the web backend")
@@ -70,7 +71,7 @@ func newFlagSet() *flagSet {
 	f.BoolVar(&f.Daemon, "daemon", false, "run daemon instead of shell")
 
 	f.StringVar(&f.Bin, "bin", "", "path to the elvish binary")
-	f.StringVar(&f.DB, "db", "", "path to the database")
+	f.StringVar(&f.DB, "db", "", "path to the database, optionally prefixed with log:// to use an append-only log file instead of a Bolt database")
 	f.StringVar(&f.Sock, "sock", "", "path to the daemon socket")
 
 	return &f
@@ -154,6 +155,8 @@ func FindProgram(flag *flagSet) Program {
 		}
 		return web.New(flag.Bin, flag.Sock, flag.DB, flag.Port)
 	default:
-		return shell.New(flag.Bin, flag.Sock, flag.DB, flag.CodeInArg, flag.CompileOnly)
+		sh := shell.New(flag.Bin, flag.Sock, flag.DB, flag.CodeInArg, flag.CompileOnly)
+		sh.Private = flag.Private
+		return sh
 	}
 }
@@ -25,6 +25,9 @@ var findProgramTests = []struct {
 	{[]string{"-compileonly"}, func(p Program) bool {
 		return p.(*shell.Shell).CompileOnly
 	}},
+	{[]string{"-private"}, func(p Program) bool {
+		return p.(*shell.Shell).Private
+	}},
 	{[]string{"-web"}, isWeb},
 	{[]string{"-web", "x"}, isShowCorrectUsage},
 	{[]string{"-web", "-c"}, isShowCorrectUsage},
@@ -16,13 +16,17 @@ import (
 	"github.com/elves/elvish/util"
 )
 
-func interact(ev *eval.Evaler, dataDir string) {
+func interact(ev *eval.Evaler, dataDir string, private bool) {
 	// Build Editor.
 	var ed editor
 	if sys.IsATTY(os.Stdin) {
 		sigch := make(chan os.Signal)
 		signal.Notify(sigch, syscall.SIGHUP, syscall.SIGINT, sys.SIGWINCH)
-		ed = edit.NewEditor(os.Stdin, os.Stderr, sigch, ev)
+		fullEd := edit.NewEditor(os.Stdin, os.Stderr, sigch, ev)
+		if private {
+			fullEd.SetHistoryPrivate(true)
+		}
+		ed = fullEd
 	} else {
 		ed = newMinEditor(os.Stdin, os.Stderr)
 	}
@@ -72,10 +76,13 @@ func interact(ev *eval.Evaler, dataDir string) {
 		// No error; reset cooldown.
 		cooldown = time.Second
 
+		start := time.Now()
 		err = ev.SourceText(eval.NewInteractiveSource(line))
+		duration := time.Since(start)
 		if err != nil {
 			util.PprintError(err)
 		}
+		ed.AfterCommand(line, start, duration, err)
 	}
 }
 
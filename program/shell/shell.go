@@ -21,10 +21,12 @@ type Shell struct {
 	DbPath      string
 	Cmd         bool
 	CompileOnly bool
+	// If true, the command history of the interactive session is not stored.
+	Private bool
 }
 
 func New(binpath, sockpath, dbpath string, cmd, compileonly bool) *Shell {
-	return &Shell{binpath, sockpath, dbpath, cmd, compileonly}
+	return &Shell{binpath, sockpath, dbpath, cmd, compileonly, false}
 }
 
 // Main runs Elvish using the default terminal interface. It blocks until Elvish
@@ -44,7 +46,7 @@ func (sh *Shell) Main(args []string) int {
 			return 2
 		}
 	} else {
-		interact(ev, dataDir)
+		interact(ev, dataDir, sh.Private)
 	}
 
 	return 0
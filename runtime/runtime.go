@@ -87,7 +87,11 @@ func InitRuntime(binpath, sockpath, dbpath string) (*eval.Evaler, string) {
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "Cannot connect to daemon:", err)
 			fmt.Fprintln(os.Stderr, daemonWontWorkMsg)
+		} else {
+			reportSchemaUpgrade(client)
 		}
+		// Respawn the daemon when it goes away during the session.
+		client.SetSpawner(spawner.Spawn)
 		// Even if error is not nil, we install daemon-related functionalities
 		// anyway. Daemon may eventually come online and become functional.
 		ev.InstallDaemonClient(client)
@@ -167,6 +171,28 @@ func connectToDaemon(sockpath string, spawner *daemonp.Daemon) (*daemon.Client,
 	return cl, fmt.Errorf("daemon unreachable after waiting for %s", daemonWaitLoops*daemonWaitPerLoop)
 }
 
+// reportSchemaUpgrade reports the upgrade of the database schema done by the
+// daemon, if any.
+func reportSchemaUpgrade(cl *daemon.Client) {
+	upgrade, err := cl.SchemaUpgrade()
+	if err != nil {
+		logger.Println("failed to get schema upgrade:", err)
+		return
+	}
+	if upgrade == nil || upgrade.From == 0 {
+		// Nothing to report for new databases.
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Database upgraded from schema version %d to %d.\n",
+		upgrade.From, upgrade.To)
+	for _, step := range upgrade.Steps {
+		fmt.Fprintln(os.Stderr, "  "+step)
+	}
+	if upgrade.Backup != "" {
+		fmt.Fprintln(os.Stderr, "The old database is backed up to", upgrade.Backup)
+	}
+}
+
 func detectDaemon(sockpath string, cl *daemon.Client) (daemonStatus, error) {
 	_, err := os.Stat(sockpath)
 	if err != nil {
@@ -176,10 +202,10 @@ func detectDaemon(sockpath string, cl *daemon.Client) (daemonStatus, error) {
 		return sockfileOtherError, err
 	}
 
-	version, err := cl.Version()
+	_, err = cl.Version()
 	if err != nil {
 		switch {
-		case err == rpc.ErrShutdown:
+		case err == rpc.ErrShutdown || err == daemon.ErrDaemonUnreachable:
 			return connectionShutdown, err
 		case err.Error() == bolt.ErrInvalid.Error():
 			return daemonInvalidDB, err
@@ -187,7 +213,7 @@ func detectDaemon(sockpath string, cl *daemon.Client) (daemonStatus, error) {
 			return connectionOtherError, err
 		}
 	}
-	if version < daemon.Version {
+	if !cl.Compatible() {
 		return daemonOutdated, nil
 	}
 	return daemonOK, nil
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"os"
+
+	"github.com/boltdb/bolt"
+	"github.com/elves/elvish/store/storedefs"
+)
+
+// DBStats returns statistics about the database.
+func (s *Store) DBStats() (storedefs.DBStats, error) {
+	stats := storedefs.DBStats{Entries: make(map[string]int)}
+	err := s.view(func(tx *bolt.Tx) error {
+		stats.Path = tx.DB().Path()
+		stats.Size = tx.Size()
+		version, err := schemaVersion(tx)
+		if err != nil {
+			return err
+		}
+		stats.SchemaVersion = version
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			stats.Entries[string(name)] = b.Stats().KeyN
+			return nil
+		})
+	})
+	return stats, err
+}
+
+// Compact rewrites the database into a new file, reclaiming the space of
+// deleted entries, and returns the sizes of the database file before and
+// after. Other operations on the Store wait until it is done.
+func (s *Store) Compact() (before, after int64, err error) {
+	s.dbMutex.Lock()
+	defer s.dbMutex.Unlock()
+
+	path := s.db.Path()
+	tmpPath := path + ".compact"
+	os.Remove(tmpPath)
+	dst, err := DefaultDB(tmpPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	err = s.db.View(func(tx *bolt.Tx) error {
+		before = tx.Size()
+		return dst.Update(func(dstTx *bolt.Tx) error {
+			return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+				dstBucket, err := dstTx.CreateBucket(name)
+				if err != nil {
+					return err
+				}
+				return copyBucket(dstBucket, b)
+			})
+		})
+	})
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return 0, 0, err
+	}
+
+	err = s.db.Close()
+	if err != nil {
+		return 0, 0, err
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		logger.Println("failed to replace database with compacted one:", err)
+	}
+	// Reopen the database even if the renaming failed, so that the Store
+	// remains usable.
+	db, openErr := DefaultDB(path)
+	if openErr != nil {
+		return 0, 0, openErr
+	}
+	s.db = db
+	if err != nil {
+		return 0, 0, err
+	}
+	err = s.db.View(func(tx *bolt.Tx) error {
+		after = tx.Size()
+		return nil
+	})
+	return before, after, err
+}
+
+// copyBucket copies all the entries and nested buckets of src to dst,
+// preserving the sequence number used for new keys.
+func copyBucket(dst, src *bolt.Bucket) error {
+	err := dst.SetSequence(src.Sequence())
+	if err != nil {
+		return err
+	}
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+		// A nil value indicates a nested bucket.
+		dstNested, err := dst.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+		return copyBucket(dstNested, src.Bucket(k))
+	})
+}
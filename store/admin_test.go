@@ -0,0 +1,71 @@
+package store
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestDBStatsAndCompact(t *testing.T) {
+	testBackends(t, testDBStatsAndCompact)
+}
+
+func testDBStatsAndCompact(t *testing.T, st Backend) {
+	for i := 0; i < 100; i++ {
+		st.AddCmd("echo")
+	}
+	st.RemoveCmdsMatching("")
+	st.AddCmd("kept")
+	st.SetSharedVar("x", "y")
+
+	stats, err := st.DBStats()
+	if err != nil {
+		t.Fatalf("DBStats -> error %v", err)
+	}
+	wantVersion := SchemaVersion
+	if _, ok := st.(*LogStore); ok {
+		wantVersion = LogFormatVersion
+	}
+	if stats.SchemaVersion != wantVersion || stats.Entries[BucketCmd] != 1 ||
+		stats.Entries[BucketSharedVar] != 1 {
+		t.Errorf("DBStats -> %v", stats)
+	}
+
+	before, after, err := st.Compact()
+	if err != nil {
+		t.Fatalf("Compact -> error %v", err)
+	}
+	if after > before {
+		t.Errorf("Compact grew database from %d to %d bytes", before, after)
+	}
+	// Contents and sequence numbers are kept.
+	if cmds, _ := st.Cmds(0, 200); !reflect.DeepEqual(cmds, []string{"kept"}) {
+		t.Errorf("after Compact, Cmds -> %v", cmds)
+	}
+	if seq, _ := st.NextCmdSeq(); seq != 102 {
+		t.Errorf("after Compact, NextCmdSeq -> %d, want 102", seq)
+	}
+	if v, _ := st.SharedVar("x"); v != "y" {
+		t.Errorf("after Compact, shared variable x = %q, want y", v)
+	}
+}
+
+func TestCompactDropsRemovedCmds(t *testing.T) {
+	testBackends(t, func(t *testing.T, st Backend) {
+		st.AddCmd("echo kept")
+		st.AddCmd("echo hunter2")
+		st.RemoveCmdsMatching("hunter2")
+		if _, _, err := st.Compact(); err != nil {
+			t.Fatalf("Compact -> error %v", err)
+		}
+		stats, _ := st.DBStats()
+		content, err := ioutil.ReadFile(stats.Path)
+		if err != nil {
+			t.Fatalf("ReadFile -> error %v", err)
+		}
+		if bytes.Contains(content, []byte("hunter2")) {
+			t.Errorf("removed command still in %s after Compact", stats.Path)
+		}
+	})
+}
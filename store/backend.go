@@ -0,0 +1,72 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/elves/elvish/store/storedefs"
+)
+
+// Backend is a storage backend that can be opened with Open.
+type Backend interface {
+	storedefs.Store
+	// SchemaUpgrade returns the schema upgrade done when the backend was
+	// opened, or nil if there was none.
+	SchemaUpgrade() *storedefs.SchemaUpgrade
+	Close() error
+}
+
+var (
+	_ Backend = (*Store)(nil)
+	_ Backend = (*LogStore)(nil)
+)
+
+// Schemes of database URLs.
+const (
+	// SchemeBolt selects Store, backed by a Bolt database. It is the default
+	// when the URL has no scheme.
+	SchemeBolt = "bolt"
+	// SchemeLog selects LogStore, backed by an append-only log file. Unlike
+	// Bolt, it does not rely on file locking, which misbehaves on some network
+	// filesystems.
+	SchemeLog = "log"
+)
+
+// SplitDBURL splits a database URL of the form scheme://path into its scheme
+// and path. If dbURL does not have a scheme, the scheme is empty and the path
+// is dbURL itself.
+func SplitDBURL(dbURL string) (scheme, path string) {
+	i := strings.Index(dbURL, "://")
+	if i <= 0 || strings.ContainsAny(dbURL[:i], `/\`) {
+		return "", dbURL
+	}
+	return dbURL[:i], dbURL[i+3:]
+}
+
+// Open opens the storage backend specified by dbURL, which is either a path to
+// a Bolt database, or a path prefixed with a scheme like "log://".
+func Open(dbURL string) (Backend, error) {
+	var (
+		st  Backend
+		err error
+	)
+	// The results of the constructors are only converted to Backend when
+	// there is no error, so that a failure gives a nil Backend.
+	switch scheme, path := SplitDBURL(dbURL); scheme {
+	case "", SchemeBolt:
+		var bolt *Store
+		bolt, err = NewStore(path)
+		if err == nil {
+			st = bolt
+		}
+	case SchemeLog:
+		var log *LogStore
+		log, err = NewLogStore(path)
+		if err == nil {
+			st = log
+		}
+	default:
+		err = fmt.Errorf("unknown database scheme %q", scheme)
+	}
+	return st, err
+}
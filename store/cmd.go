@@ -3,26 +3,36 @@ package store
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
+	"regexp"
 
 	"github.com/boltdb/bolt"
 	"github.com/elves/elvish/store/storedefs"
 )
 
 func init() {
-	initDB["initialize command history table"] = func(db *bolt.DB) error {
-		return db.Update(func(tx *bolt.Tx) error {
-			_, err := tx.CreateBucketIfNotExists([]byte(BucketCmd))
-			return err
-		})
-	}
+	addMigration(1, "create command history table", func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(BucketCmd))
+		return err
+	})
+	addMigration(3, "create command metadata table", func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(BucketCmdMeta))
+		return err
+	})
 }
 
-const BucketCmd = "cmd"
+// BucketCmd stores the text of commands, and BucketCmdMeta stores their
+// metadata encoded in JSON. Both are keyed by sequence numbers; commands added
+// without metadata have no entry in BucketCmdMeta.
+const (
+	BucketCmd     = "cmd"
+	BucketCmdMeta = "cmdmeta"
+)
 
 // NextCmdSeq returns the next sequence number of the command history.
 func (s *Store) NextCmdSeq() (int, error) {
 	var seq uint64
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err := s.view(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketCmd))
 		seq = b.Sequence() + 1
 		return nil
@@ -32,34 +42,183 @@ func (s *Store) NextCmdSeq() (int, error) {
 
 // AddCmd adds a new command to the command history.
 func (s *Store) AddCmd(cmd string) (int, error) {
+	return s.addCmd(cmd, nil)
+}
+
+// AddCmdWithMeta adds a new command to the command history, together with its
+// metadata.
+func (s *Store) AddCmdWithMeta(cmd string, meta storedefs.CmdMeta) (int, error) {
+	return s.addCmd(cmd, &meta)
+}
+
+func (s *Store) addCmd(cmd string, meta *storedefs.CmdMeta) (int, error) {
 	var (
 		seq uint64
 		err error
 	)
-	err = s.db.Update(func(tx *bolt.Tx) error {
+	err = s.update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketCmd))
 		seq, err = b.NextSequence()
 		if err != nil {
 			return err
 		}
-		return b.Put(marshalSeq(seq), []byte(cmd))
+		err = b.Put(marshalSeq(seq), []byte(cmd))
+		if err != nil || meta == nil {
+			return err
+		}
+		return putCmdMeta(tx, seq, *meta)
 	})
+	if err == nil {
+		c := storedefs.Cmd{Seq: int(seq), Text: cmd}
+		if meta != nil {
+			c.CmdMeta = *meta
+		}
+		s.updateIndex(func(idx *cmdIndex) { idx.add(c) })
+	}
 	return int(seq), err
 }
 
+// AddCmds adds commands with their metadata to the command history in one
+// transaction, in the given order. The Seq fields of the commands are ignored.
+func (s *Store) AddCmds(cmds []storedefs.Cmd) error {
+	added := make([]storedefs.Cmd, len(cmds))
+	err := s.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketCmd))
+		for i, cmd := range cmds {
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			err = b.Put(marshalSeq(seq), []byte(cmd.Text))
+			if err != nil {
+				return err
+			}
+			err = putCmdMeta(tx, seq, cmd.CmdMeta)
+			if err != nil {
+				return err
+			}
+			cmd.Seq = int(seq)
+			added[i] = cmd
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.updateIndex(func(idx *cmdIndex) {
+		for _, cmd := range added {
+			idx.add(cmd)
+		}
+	})
+	return nil
+}
+
+// FinishCmd records the duration and the exception summary of a command that
+// has finished.
+func (s *Store) FinishCmd(seq int, duration float64, exception string) error {
+	err := s.update(func(tx *bolt.Tx) error {
+		key := marshalSeq(uint64(seq))
+		if tx.Bucket([]byte(BucketCmd)).Get(key) == nil {
+			return storedefs.ErrNoMatchingCmd
+		}
+		meta, err := getCmdMeta(tx, key)
+		if err != nil {
+			return err
+		}
+		meta.Finished = true
+		meta.Duration = duration
+		meta.Exception = exception
+		return putCmdMeta(tx, uint64(seq), meta)
+	})
+	if err != nil {
+		return err
+	}
+	s.updateIndex(func(idx *cmdIndex) { idx.finish(seq, duration, exception) })
+	return nil
+}
+
 // RemoveCmd removes a command from command history referenced by
 // sequence.
 func (s *Store) RemoveCmd(seq int) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
+	err := s.update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketCmd))
-		return b.Delete(marshalSeq(uint64(seq)))
+		err := b.Delete(marshalSeq(uint64(seq)))
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(BucketCmdMeta)).Delete(marshalSeq(uint64(seq)))
+	})
+	if err != nil {
+		return err
+	}
+	s.updateIndex(func(idx *cmdIndex) { idx.remove(seq) })
+	return nil
+}
+
+// RemoveCmdsMatching removes all commands matching the regular expression
+// pattern from the command history, and returns their sequence numbers.
+func (s *Store) RemoveCmdsMatching(pattern string) ([]int, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var seqs []int
+	err = s.update(func(tx *bolt.Tx) error {
+		var keys [][]byte
+		c := tx.Bucket([]byte(BucketCmd)).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if re.Match(v) {
+				keys = append(keys, k)
+			}
+		}
+		// Keys are deleted after iterating, since deleting while iterating
+		// with a cursor skips entries.
+		for _, k := range keys {
+			if err := tx.Bucket([]byte(BucketCmd)).Delete(k); err != nil {
+				return err
+			}
+			if err := tx.Bucket([]byte(BucketCmdMeta)).Delete(k); err != nil {
+				return err
+			}
+			seqs = append(seqs, int(unmarshalSeq(k)))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.updateIndex(func(idx *cmdIndex) {
+		for _, seq := range seqs {
+			idx.remove(seq)
+		}
 	})
+	return seqs, nil
+}
+
+func putCmdMeta(tx *bolt.Tx, seq uint64, meta storedefs.CmdMeta) error {
+	v, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket([]byte(BucketCmdMeta)).Put(marshalSeq(seq), v)
+}
+
+// getCmdMeta returns the metadata of a command, or the zero value if it has
+// none.
+func getCmdMeta(tx *bolt.Tx, key []byte) (storedefs.CmdMeta, error) {
+	var meta storedefs.CmdMeta
+	v := tx.Bucket([]byte(BucketCmdMeta)).Get(key)
+	if v == nil {
+		return meta, nil
+	}
+	err := json.Unmarshal(v, &meta)
+	return meta, err
 }
 
 // Cmd queries the command history item with the specified sequence number.
 func (s *Store) Cmd(seq int) (string, error) {
 	var cmd string
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err := s.view(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketCmd))
 		if v := b.Get(marshalSeq(uint64(seq))); v == nil {
 			return storedefs.ErrNoMatchingCmd
@@ -74,7 +233,7 @@ func (s *Store) Cmd(seq int) (string, error) {
 // IterateCmds iterates all the commands in the specified range, and calls the
 // callback with the content of each command sequentially.
 func (s *Store) IterateCmds(from, upto int, f func(string) bool) error {
-	return s.db.View(func(tx *bolt.Tx) error {
+	return s.view(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketCmd))
 		c := b.Cursor()
 		for k, v := c.Seek(marshalSeq(uint64(from))); k != nil && unmarshalSeq(k) < uint64(upto); k, v = c.Next() {
@@ -96,6 +255,25 @@ func (s *Store) Cmds(from, upto int) ([]string, error) {
 	return cmds, err
 }
 
+// CmdsWithMeta returns all commands within the specified range, with their
+// metadata.
+func (s *Store) CmdsWithMeta(from, upto int) ([]storedefs.Cmd, error) {
+	var cmds []storedefs.Cmd
+	err := s.view(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(BucketCmd)).Cursor()
+		for k, v := c.Seek(marshalSeq(uint64(from))); k != nil && unmarshalSeq(k) < uint64(upto); k, v = c.Next() {
+			meta, err := getCmdMeta(tx, k)
+			if err != nil {
+				return err
+			}
+			cmds = append(cmds, storedefs.Cmd{
+				Seq: int(unmarshalSeq(k)), Text: string(v), CmdMeta: meta})
+		}
+		return nil
+	})
+	return cmds, err
+}
+
 // NextCmd finds the first command after the given sequence number (inclusive)
 // with the given prefix.
 func (s *Store) NextCmd(from int, prefix string) (int, string, error) {
@@ -104,7 +282,7 @@ func (s *Store) NextCmd(from int, prefix string) (int, string, error) {
 		cmd   string
 		found bool
 	)
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err := s.view(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketCmd))
 		c := b.Cursor()
 		p := []byte(prefix)
@@ -135,7 +313,7 @@ func (s *Store) PrevCmd(upto int, prefix string) (int, string, error) {
 		found bool
 	)
 
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err := s.view(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketCmd))
 		c := b.Cursor()
 		p := []byte(prefix)
@@ -0,0 +1,204 @@
+package store
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/boltdb/bolt"
+	"github.com/elves/elvish/store/storedefs"
+)
+
+// cmdIndex is an in-memory index of the command history for searching. It
+// keeps all the commands with their metadata, and a trigram index of their
+// lowercased text, which narrows down the commands to check for queries that
+// require a literal substring.
+//
+// The index is built on the first search, and kept up to date by the methods
+// that change the command history afterwards.
+type cmdIndex struct {
+	mutex sync.RWMutex
+	cmds  map[int]*storedefs.Cmd
+	// Sequence numbers of all commands, in ascending order. It may contain
+	// removed commands, which are skipped when searching.
+	seqs     []int
+	trigrams map[string][]int
+}
+
+func newCmdIndex() *cmdIndex {
+	return &cmdIndex{cmds: make(map[int]*storedefs.Cmd), trigrams: make(map[string][]int)}
+}
+
+// add adds a command to the index, or updates it if it is already in the index.
+func (idx *cmdIndex) add(cmd storedefs.Cmd) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	if _, ok := idx.cmds[cmd.Seq]; ok {
+		idx.cmds[cmd.Seq] = &cmd
+		return
+	}
+	idx.cmds[cmd.Seq] = &cmd
+	idx.seqs = insertSeq(idx.seqs, cmd.Seq)
+	for _, t := range trigramsOf(strings.ToLower(cmd.Text)) {
+		idx.trigrams[t] = insertSeq(idx.trigrams[t], cmd.Seq)
+	}
+}
+
+func (idx *cmdIndex) finish(seq int, duration float64, exception string) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	if cmd, ok := idx.cmds[seq]; ok {
+		cmd.Finished, cmd.Duration, cmd.Exception = true, duration, exception
+	}
+}
+
+func (idx *cmdIndex) remove(seq int) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	delete(idx.cmds, seq)
+}
+
+func (idx *cmdIndex) search(q storedefs.CmdQuery) ([]storedefs.Cmd, error) {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+	candidates := idx.seqs
+	if lit := requiredLiteral(q); len(lit) >= 3 {
+		candidates = idx.candidates(strings.ToLower(lit))
+	}
+	if q.Before > 0 {
+		// Skip the newer commands without looking at them, so that getting
+		// each page of results costs the same.
+		candidates = candidates[:sort.SearchInts(candidates, q.Before)]
+	}
+	return q.Search(len(candidates), func(i int) *storedefs.Cmd {
+		return idx.cmds[candidates[i]]
+	})
+}
+
+// candidates returns the sequence numbers of commands that contain all the
+// trigrams of s.
+func (idx *cmdIndex) candidates(s string) []int {
+	var result []int
+	for i, t := range trigramsOf(s) {
+		if i == 0 {
+			result = idx.trigrams[t]
+		} else {
+			result = intersectSeqs(result, idx.trigrams[t])
+		}
+		if len(result) == 0 {
+			break
+		}
+	}
+	return result
+}
+
+// requiredLiteral returns a string that all the commands matching the query
+// must contain, ignoring case.
+func requiredLiteral(q storedefs.CmdQuery) string {
+	switch q.Mode {
+	case storedefs.SearchSubstring, "":
+		return q.Pattern
+	case storedefs.SearchRegex:
+		re, err := regexp.Compile(q.Pattern)
+		if err != nil {
+			return ""
+		}
+		lit, _ := re.LiteralPrefix()
+		return lit
+	}
+	return ""
+}
+
+// trigramsOf returns all the distinct 3-byte substrings of s.
+func trigramsOf(s string) []string {
+	var trigrams []string
+	seen := make(map[string]bool)
+	for i := 0; i+3 <= len(s); i++ {
+		t := s[i : i+3]
+		if !seen[t] {
+			seen[t] = true
+			trigrams = append(trigrams, t)
+		}
+	}
+	return trigrams
+}
+
+// insertSeq inserts seq into the sorted slice seqs. Commands are usually added
+// in order, so this is normally an append.
+func insertSeq(seqs []int, seq int) []int {
+	n := len(seqs)
+	if n == 0 || seqs[n-1] < seq {
+		return append(seqs, seq)
+	}
+	i := sort.SearchInts(seqs, seq)
+	if i < n && seqs[i] == seq {
+		return seqs
+	}
+	seqs = append(seqs, 0)
+	copy(seqs[i+1:], seqs[i:])
+	seqs[i] = seq
+	return seqs
+}
+
+func intersectSeqs(a, b []int) []int {
+	var result []int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// SearchCmds searches the command history. The index used for searching is
+// built on the first call.
+func (s *Store) SearchCmds(q storedefs.CmdQuery) ([]storedefs.Cmd, error) {
+	idx, err := s.cmdIndex()
+	if err != nil {
+		return nil, err
+	}
+	return idx.search(q)
+}
+
+func (s *Store) cmdIndex() (*cmdIndex, error) {
+	s.indexMutex.Lock()
+	defer s.indexMutex.Unlock()
+	if s.index != nil {
+		return s.index, nil
+	}
+	idx := newCmdIndex()
+	err := s.view(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(BucketCmd)).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			meta, err := getCmdMeta(tx, k)
+			if err != nil {
+				return err
+			}
+			idx.add(storedefs.Cmd{Seq: int(unmarshalSeq(k)), Text: string(v), CmdMeta: meta})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.index = idx
+	return idx, nil
+}
+
+// updateIndex calls f with the index if it has been built. It is called after
+// changes to the command history have been committed.
+func (s *Store) updateIndex(f func(*cmdIndex)) {
+	s.indexMutex.Lock()
+	defer s.indexMutex.Unlock()
+	if s.index != nil {
+		f(s.index)
+	}
+}
@@ -1,6 +1,8 @@
 package store
 
 import (
+	"reflect"
+	"strconv"
 	"testing"
 
 	"github.com/elves/elvish/store/storedefs"
@@ -30,39 +32,43 @@ var (
 )
 
 func TestCmd(t *testing.T) {
-	startSeq, err := tStore.NextCmdSeq()
+	testBackends(t, testCmd)
+}
+
+func testCmd(t *testing.T, st Backend) {
+	startSeq, err := st.NextCmdSeq()
 	if startSeq != 1 || err != nil {
-		t.Errorf("tStore.NextCmdSeq() => (%v, %v), want (1, nil)",
+		t.Errorf("st.NextCmdSeq() => (%v, %v), want (1, nil)",
 			startSeq, err)
 	}
 	for i, cmd := range cmds {
 		wantSeq := startSeq + i
-		seq, err := tStore.AddCmd(cmd)
+		seq, err := st.AddCmd(cmd)
 		if seq != wantSeq || err != nil {
-			t.Errorf("tStore.AddCmd(%v) => (%v, %v), want (%v, nil)",
+			t.Errorf("st.AddCmd(%v) => (%v, %v), want (%v, nil)",
 				cmd, seq, err, wantSeq)
 		}
 	}
-	endSeq, err := tStore.NextCmdSeq()
+	endSeq, err := st.NextCmdSeq()
 	wantedEndSeq := startSeq + len(cmds)
 	if endSeq != wantedEndSeq || err != nil {
-		t.Errorf("tStore.NextCmdSeq() => (%v, %v), want (%v, nil)",
+		t.Errorf("st.NextCmdSeq() => (%v, %v), want (%v, nil)",
 			endSeq, err, wantedEndSeq)
 	}
 	for i, wantedCmd := range cmds {
 		seq := i + startSeq
-		cmd, err := tStore.Cmd(seq)
+		cmd, err := st.Cmd(seq)
 		if cmd != wantedCmd || err != nil {
-			t.Errorf("tStore.Cmd(%v) => (%v, %v), want (%v, nil)",
+			t.Errorf("st.Cmd(%v) => (%v, %v), want (%v, nil)",
 				seq, cmd, err, wantedCmd)
 		}
 	}
 	for _, tt := range searches {
-		f := tStore.PrevCmd
-		funcname := "tStore.PrevCmd"
+		f := st.PrevCmd
+		funcname := "st.PrevCmd"
 		if tt.next {
-			f = tStore.NextCmd
-			funcname = "tStore.NextCmd"
+			f = st.NextCmd
+			funcname = "st.NextCmd"
 		}
 		seq, cmd, err := f(tt.seq, tt.prefix)
 		if seq != tt.wantedSeq || cmd != tt.wantedCmd || err != tt.wantedErr {
@@ -73,11 +79,145 @@ func TestCmd(t *testing.T) {
 		}
 	}
 
-	if err := tStore.RemoveCmd(1); err != nil {
+	if err := st.RemoveCmd(1); err != nil {
 		t.Error("Failed to remove cmd")
 	}
-	if seq, err := tStore.Cmd(1); err != storedefs.ErrNoMatchingCmd {
+	if seq, err := st.Cmd(1); err != storedefs.ErrNoMatchingCmd {
 		t.Errorf("Cmd(1) => (%v, %v), want (%v, %v)",
 			seq, err, "", storedefs.ErrNoMatchingCmd)
 	}
 }
+
+func TestCmdMeta(t *testing.T) {
+	testBackends(t, testCmdMeta)
+}
+
+func testCmdMeta(t *testing.T, st Backend) {
+	meta := storedefs.CmdMeta{Dir: "/tmp", Start: 1, Host: "host", Session: "s"}
+	seq, err := st.AddCmdWithMeta("make", meta)
+	if err != nil {
+		t.Fatalf("AddCmdWithMeta -> error %v", err)
+	}
+	plainSeq, _ := st.AddCmd("plain")
+
+	if err := st.FinishCmd(seq, 1.5, "make exited with 2"); err != nil {
+		t.Errorf("FinishCmd -> error %v", err)
+	}
+	if err := st.FinishCmd(plainSeq+1, 1, ""); err != storedefs.ErrNoMatchingCmd {
+		t.Errorf("FinishCmd of nonexistent command -> error %v, want %v",
+			err, storedefs.ErrNoMatchingCmd)
+	}
+
+	cmds, err := st.CmdsWithMeta(seq, plainSeq+1)
+	meta.Finished, meta.Duration, meta.Exception = true, 1.5, "make exited with 2"
+	want := []storedefs.Cmd{
+		{Seq: seq, Text: "make", CmdMeta: meta},
+		{Seq: plainSeq, Text: "plain"},
+	}
+	if !reflect.DeepEqual(cmds, want) || err != nil {
+		t.Errorf("CmdsWithMeta -> (%v, %v), want (%v, nil)", cmds, err, want)
+	}
+}
+
+func TestAddCmdsAndRemoveCmdsMatching(t *testing.T) {
+	testBackends(t, testAddCmdsAndRemoveCmdsMatching)
+}
+
+func testAddCmdsAndRemoveCmdsMatching(t *testing.T, st Backend) {
+	start, _ := st.NextCmdSeq()
+	err := st.AddCmds([]storedefs.Cmd{
+		{Text: "export TOKEN=secret", CmdMeta: storedefs.CmdMeta{Start: 1}},
+		{Text: "ls"},
+		{Text: "export TOKEN=other"},
+	})
+	if err != nil {
+		t.Fatalf("AddCmds -> error %v", err)
+	}
+	cmds, _ := st.CmdsWithMeta(start, start+3)
+	if len(cmds) != 3 || cmds[0].Start != 1 || cmds[1].Text != "ls" {
+		t.Errorf("CmdsWithMeta after AddCmds -> %v", cmds)
+	}
+
+	seqs, err := st.RemoveCmdsMatching("^export TOKEN=")
+	if want := []int{start, start + 2}; !reflect.DeepEqual(seqs, want) || err != nil {
+		t.Errorf("RemoveCmdsMatching -> (%v, %v), want (%v, nil)", seqs, err, want)
+	}
+	if cmds, _ := st.Cmds(start, start+3); !reflect.DeepEqual(cmds, []string{"ls"}) {
+		t.Errorf("Cmds after RemoveCmdsMatching -> %v", cmds)
+	}
+	if _, err := st.RemoveCmdsMatching("("); err == nil {
+		t.Errorf("RemoveCmdsMatching with bad pattern -> nil error")
+	}
+}
+
+func TestSearchCmds(t *testing.T) {
+	testBackends(t, testSearchCmds)
+}
+
+func testSearchCmds(t *testing.T, st Backend) {
+	st.AddCmd("git status")
+	st.AddCmdWithMeta("make test", storedefs.CmdMeta{Dir: "/src"})
+
+	search := func(q storedefs.CmdQuery) []string {
+		cmds, err := st.SearchCmds(q)
+		if err != nil {
+			t.Errorf("SearchCmds(%v) -> error %v", q, err)
+		}
+		var texts []string
+		for _, cmd := range cmds {
+			texts = append(texts, cmd.Text)
+		}
+		return texts
+	}
+
+	// The first search builds the index, which is then updated by later
+	// changes.
+	if got := search(storedefs.CmdQuery{Pattern: "stat"}); !reflect.DeepEqual(got, []string{"git status"}) {
+		t.Errorf("search before changes -> %v", got)
+	}
+	seq, _ := st.AddCmd("git STASH")
+	st.AddCmds([]storedefs.Cmd{{Text: "git push"}})
+	got := search(storedefs.CmdQuery{Pattern: "git sta", IgnoreCase: true})
+	if want := []string{"git STASH", "git status"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("search after adding -> %v, want %v", got, want)
+	}
+	got = search(storedefs.CmdQuery{Pattern: "^git p", Mode: storedefs.SearchRegex})
+	if want := []string{"git push"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("regex search -> %v, want %v", got, want)
+	}
+
+	st.RemoveCmd(seq)
+	got = search(storedefs.CmdQuery{Pattern: "git sta", IgnoreCase: true})
+	if want := []string{"git status"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("search after removing -> %v, want %v", got, want)
+	}
+
+	st.FinishCmd(2, 1, "make exited with 2")
+	got = search(storedefs.CmdQuery{Dir: "/src", SucceededOnly: true})
+	if len(got) != 0 {
+		t.Errorf("search for succeeded commands -> %v, want none", got)
+	}
+}
+
+// BenchmarkSearchCmdsPages measures paging through a large command history
+// with a fuzzy pattern, like the history listing does.
+func BenchmarkSearchCmdsPages(b *testing.B) {
+	idx := newCmdIndex()
+	for i := 1; i <= 200000; i++ {
+		idx.add(storedefs.Cmd{Seq: i, Text: "echo number " + strconv.Itoa(i)})
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q := storedefs.CmdQuery{Pattern: "ecnu", Mode: storedefs.SearchFuzzy, Limit: 1000}
+		for {
+			page, err := idx.search(q)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if len(page) < q.Limit {
+				break
+			}
+			q.Before = page[len(page)-1].Seq
+		}
+	}
+}
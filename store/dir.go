@@ -1,81 +1,133 @@
 package store
 
 import (
+	"bytes"
 	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/elves/elvish/store/storedefs"
 )
 
 const (
-	scoreDecay     = 0.986 // roughly 0.5^(1/50)
-	scoreIncrement = 10
 	scorePrecision = 6
+	// maxDirVisits is the number of most recent visits kept for each
+	// directory.
+	maxDirVisits = 20
 )
 
 const BucketDir = "dir"
 
+// now returns the current time. It is a variable so that it can be replaced in
+// tests.
+var now = time.Now
+
 func init() {
-	initDB["initialize directory history table"] = func(db *bolt.DB) error {
-		return db.Update(func(tx *bolt.Tx) error {
-			_, err := tx.CreateBucketIfNotExists([]byte(BucketDir))
+	addMigration(1, "create directory history table", func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(BucketDir))
+		return err
+	})
+	addMigration(2, "convert directory scores to visits", func(tx *bolt.Tx) error {
+		return convertDirScores(tx.Bucket([]byte(BucketDir)))
+	})
+}
+
+// convertDirScores converts directory records that only have a score, which
+// were written by older versions, into records of visits. The score becomes a
+// single visit happening now.
+func convertDirScores(b *bolt.Bucket) error {
+	converted := map[string][]storedefs.DirVisit{}
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if !strings.Contains(string(v), ":") {
+			score, _ := strconv.ParseFloat(string(v), 64)
+			converted[string(k)] = []storedefs.DirVisit{
+				{now().Unix(), score / storedefs.DirScoreIncrement}}
+		}
+	}
+	for d, visits := range converted {
+		err := b.Put([]byte(d), marshalVisits(visits))
+		if err != nil {
 			return err
-		})
+		}
 	}
+	return nil
 }
 
-func marshalScore(score float64) []byte {
-	return []byte(strconv.FormatFloat(score, 'E', scorePrecision, 64))
+// marshalVisits encodes visits as space-separated "time:weight" pairs.
+func marshalVisits(visits []storedefs.DirVisit) []byte {
+	var buf bytes.Buffer
+	for i, visit := range visits {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(strconv.FormatInt(visit.Time, 10))
+		buf.WriteByte(':')
+		buf.WriteString(strconv.FormatFloat(visit.Weight, 'E', scorePrecision, 64))
+	}
+	return buf.Bytes()
 }
-func unmarshalScore(data []byte) float64 {
-	f, _ := strconv.ParseFloat(string(data), 64)
-	return f
+
+func unmarshalVisits(data []byte) []storedefs.DirVisit {
+	var visits []storedefs.DirVisit
+	for _, field := range strings.Fields(string(data)) {
+		i := strings.IndexByte(field, ':')
+		if i == -1 {
+			continue
+		}
+		t, _ := strconv.ParseInt(field[:i], 10, 64)
+		weight, _ := strconv.ParseFloat(field[i+1:], 64)
+		visits = append(visits, storedefs.DirVisit{t, weight})
+	}
+	return visits
 }
 
-// AddDir adds a directory to the directory history.
+// AddDir records a visit to a directory in the directory history. The weight
+// of the visit is incFactor.
 func (s *Store) AddDir(d string, incFactor float64) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketDir))
 
-		c := b.Cursor()
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			score := unmarshalScore(v) * scoreDecay
-			b.Put(k, marshalScore(score))
-		}
-
 		k := []byte(d)
-		score := float64(0)
-		if v := b.Get(k); v != nil {
-			score = unmarshalScore(v)
+		visits := unmarshalVisits(b.Get(k))
+		visits = append(visits, storedefs.DirVisit{now().Unix(), incFactor})
+		if len(visits) > maxDirVisits {
+			visits = visits[len(visits)-maxDirVisits:]
 		}
-		score = score + scoreIncrement*incFactor
-		return b.Put(k, marshalScore(score))
+		return b.Put(k, marshalVisits(visits))
 	})
 }
 
-// AddDir adds a directory and its score to history.
+// AddDirRaw adds a directory to history with the given score, as if it was
+// visited just now.
 func (s *Store) AddDirRaw(d string, score float64) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketDir))
-		return b.Put([]byte(d), marshalScore(score))
+		visits := []storedefs.DirVisit{
+			{now().Unix(), score / storedefs.DirScoreIncrement}}
+		return b.Put([]byte(d), marshalVisits(visits))
 	})
 }
 
 // RemoveDir removes a directory record from history.
 func (s *Store) RemoveDir(d string) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketDir))
 		return b.Delete([]byte(d))
 	})
 }
 
 // Dirs lists all directories in the directory history whose names are not
-// in the blacklist. The results are ordered by scores in descending order.
+// in the blacklist, along with their visits. The scores are calculated with
+// storedefs.DefaultDirHalfLife, and the results are ordered by scores in
+// descending order.
 func (s *Store) Dirs(blacklist map[string]struct{}) ([]storedefs.Dir, error) {
 	var dirs []storedefs.Dir
+	t := now().Unix()
 
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err := s.view(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketDir))
 		c := b.Cursor()
 		for k, v := c.First(); k != nil; k, v = c.Next() {
@@ -83,9 +135,11 @@ func (s *Store) Dirs(blacklist map[string]struct{}) ([]storedefs.Dir, error) {
 			if _, ok := blacklist[d]; ok {
 				continue
 			}
+			visits := unmarshalVisits(v)
 			dirs = append(dirs, storedefs.Dir{
-				Path:  d,
-				Score: unmarshalScore(v),
+				Path:   d,
+				Score:  storedefs.Frecency(visits, t, storedefs.DefaultDirHalfLife),
+				Visits: visits,
 			})
 		}
 		sort.Sort(sort.Reverse(dirList(dirs)))
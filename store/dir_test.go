@@ -3,6 +3,7 @@ package store
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/elves/elvish/store/storedefs"
 )
@@ -11,21 +12,44 @@ var (
 	dirsToAdd  = []string{"/usr/local", "/usr", "/usr/bin", "/usr"}
 	black      = map[string]struct{}{"/usr/local": {}}
 	wantedDirs = []storedefs.Dir{
-		{"/usr", scoreIncrement*scoreDecay*scoreDecay + scoreIncrement},
-		{"/usr/bin", scoreIncrement * scoreDecay}}
+		{"/usr", 2 * storedefs.DirScoreIncrement,
+			[]storedefs.DirVisit{{1000, 1}, {1000, 1}}},
+		{"/usr/bin", storedefs.DirScoreIncrement,
+			[]storedefs.DirVisit{{1000, 1}}}}
 )
 
 func TestDir(t *testing.T) {
+	testBackends(t, testDir)
+}
+
+func testDir(t *testing.T, st Backend) {
+	defer func(f func() time.Time) { now = f }(now)
+	now = func() time.Time { return time.Unix(1000, 0) }
+
 	for _, path := range dirsToAdd {
-		err := tStore.AddDir(path, 1)
+		err := st.AddDir(path, 1)
 		if err != nil {
-			t.Errorf("tStore.AddDir(%q) => %v, want <nil>", path, err)
+			t.Errorf("st.AddDir(%q) => %v, want <nil>", path, err)
 		}
 	}
 
-	dirs, err := tStore.Dirs(black)
+	dirs, err := st.Dirs(black)
 	if err != nil || !reflect.DeepEqual(dirs, wantedDirs) {
-		t.Errorf(`tStore.ListDirs() => (%v, %v), want (%v, <nil>)`,
+		t.Errorf(`st.ListDirs() => (%v, %v), want (%v, <nil>)`,
 			dirs, err, wantedDirs)
 	}
+
+	// Scores decay with time.
+	now = func() time.Time { return time.Unix(1000+storedefs.DefaultDirHalfLife, 0) }
+	dirs, err = st.Dirs(black)
+	if err != nil || len(dirs) != 2 || dirs[0].Score != storedefs.DirScoreIncrement {
+		t.Errorf("after one half-life, st.Dirs() => (%v, %v)", dirs, err)
+	}
+}
+
+func TestDirVisitsMarshal(t *testing.T) {
+	visits := []storedefs.DirVisit{{100, 1}, {200, 0.5}}
+	if got := unmarshalVisits(marshalVisits(visits)); !reflect.DeepEqual(got, visits) {
+		t.Errorf("visits -> %v after marshalling, want %v", got, visits)
+	}
 }
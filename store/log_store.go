@@ -0,0 +1,691 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/elves/elvish/store/storedefs"
+)
+
+// LogFormatVersion is the version of the format of log files written by
+// LogStore.
+const LogFormatVersion = 1
+
+// LogStore is a storage backend that keeps all the data in memory, and
+// persists changes by appending them to a log file, one JSON record per line.
+// The log file is replayed when it is opened, and rewritten by Compact.
+//
+// LogStore does not lock the log file, so it is suitable for filesystems where
+// file locking is unreliable. Instead, it creates a lock file next to the log
+// file that records its owner as host:pid, and refuses to open a log file
+// whose lock file is owned by another process, unless that process is known to
+// have exited.
+type LogStore struct {
+	// Protects all the fields below. The methods that change the data hold it
+	// while writing to the log file, so that records are written in the
+	// same order as the changes are applied.
+	mutex    sync.RWMutex
+	path     string
+	lockPath string
+	file     *os.File
+
+	// Commands are kept in the index used for searching.
+	cmds    *cmdIndex
+	lastSeq int
+	dirs    map[string][]storedefs.DirVisit
+	vars    map[string]string
+}
+
+// logRecord is a record in the log file. Which fields are used depends on Op.
+type logRecord struct {
+	Op string `json:"op"`
+
+	Version   int                  `json:",omitempty"`
+	Seq       int                  `json:",omitempty"`
+	Text      string               `json:",omitempty"`
+	Meta      *storedefs.CmdMeta   `json:",omitempty"`
+	Duration  float64              `json:",omitempty"`
+	Exception string               `json:",omitempty"`
+	Name      string               `json:",omitempty"`
+	Value     string               `json:",omitempty"`
+	Visits    []storedefs.DirVisit `json:",omitempty"`
+}
+
+// Operations of log records.
+const (
+	// The first record of a log file, with the format version.
+	opVersion = "version"
+	// Sets the last sequence number of the command history. It is used when
+	// compacting, when the last commands may have been removed.
+	opSeq       = "seq"
+	opAddCmd    = "cmd"
+	opFinishCmd = "finish"
+	opRemoveCmd = "rmcmd"
+	// Sets all the visits of a directory.
+	opSetDir    = "dir"
+	opRemoveDir = "rmdir"
+	opSetVar    = "var"
+	opDelVar    = "rmvar"
+)
+
+// NewLogStore creates a new LogStore backed by the log file at path, which is
+// created if it does not exist.
+func NewLogStore(path string) (*LogStore, error) {
+	logger.Println("initializing log store")
+	defer logger.Println("initialized log store")
+	lockPath := path + ".lock"
+	err := acquireLogLock(lockPath)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		os.Remove(lockPath)
+		return nil, err
+	}
+	s := &LogStore{path: path, lockPath: lockPath, file: file, cmds: newCmdIndex(),
+		dirs: make(map[string][]storedefs.DirVisit), vars: make(map[string]string)}
+	err = s.replay()
+	if err != nil {
+		file.Close()
+		os.Remove(lockPath)
+		return nil, fmt.Errorf("cannot load %s: %v", path, err)
+	}
+	return s, nil
+}
+
+// acquireLogLock creates a lock file recording this process as its owner. If
+// the lock file exists and its owner is a process on this host that has
+// exited, it is taken over; otherwise an error is returned.
+func acquireLogLock(lockPath string) error {
+	hostname, _ := os.Hostname()
+	owner := hostname + ":" + strconv.Itoa(os.Getpid())
+	for {
+		f, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = f.WriteString(owner)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(lockPath)
+			}
+			return err
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		content, err := ioutil.ReadFile(lockPath)
+		if err != nil {
+			return err
+		}
+		other := string(content)
+		if !staleLogLock(other, hostname) {
+			return fmt.Errorf("log file is in use by %s; remove %s if it is not", other, lockPath)
+		}
+		logger.Printf("taking over lock file %s of exited process %s", lockPath, other)
+		err = os.Remove(lockPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+}
+
+// staleLogLock returns whether the owner of a lock file, in the form of
+// host:pid, is a process on this host that has exited.
+func staleLogLock(owner, hostname string) bool {
+	i := strings.LastIndexByte(owner, ':')
+	if i == -1 || owner[:i] != hostname {
+		return false
+	}
+	pid, err := strconv.Atoi(owner[i+1:])
+	return err == nil && !processExists(pid)
+}
+
+// replay reads all the records in the log file and applies them. A log file
+// that is empty gets the version record. A partial record at the end, left by
+// a write that was interrupted, is discarded.
+func (s *LogStore) replay() error {
+	r := bufio.NewReader(s.file)
+	var offset int64
+	for lineno := 1; ; lineno++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				logger.Printf("discarding partial record at line %d", lineno)
+				if err := s.file.Truncate(offset); err != nil {
+					return err
+				}
+			}
+			break
+		} else if err != nil {
+			return err
+		}
+		offset += int64(len(line))
+
+		var rec logRecord
+		err = json.Unmarshal(line, &rec)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", lineno, err)
+		}
+		if lineno == 1 {
+			if rec.Op != opVersion {
+				return fmt.Errorf("not a log file of elvish")
+			}
+			if rec.Version > LogFormatVersion {
+				return fmt.Errorf("log format version %d is newer than supported version %d", rec.Version, LogFormatVersion)
+			}
+		}
+		s.apply(rec)
+	}
+	if offset == 0 {
+		return s.write(logRecord{Op: opVersion, Version: LogFormatVersion})
+	}
+	return nil
+}
+
+// apply applies a record to the data in memory.
+func (s *LogStore) apply(rec logRecord) {
+	switch rec.Op {
+	case opSeq:
+		s.lastSeq = rec.Seq
+	case opAddCmd:
+		cmd := storedefs.Cmd{Seq: rec.Seq, Text: rec.Text}
+		if rec.Meta != nil {
+			cmd.CmdMeta = *rec.Meta
+		}
+		s.cmds.add(cmd)
+		if rec.Seq > s.lastSeq {
+			s.lastSeq = rec.Seq
+		}
+	case opFinishCmd:
+		s.cmds.finish(rec.Seq, rec.Duration, rec.Exception)
+	case opRemoveCmd:
+		s.cmds.remove(rec.Seq)
+	case opSetDir:
+		s.dirs[rec.Name] = rec.Visits
+	case opRemoveDir:
+		delete(s.dirs, rec.Name)
+	case opSetVar:
+		s.vars[rec.Name] = rec.Value
+	case opDelVar:
+		delete(s.vars, rec.Name)
+	}
+}
+
+// write appends records to the log file.
+func (s *LogStore) write(recs ...logRecord) error {
+	return writeRecords(s.file, recs...)
+}
+
+// writeRecords writes records to a file in a single write, and syncs the file.
+func writeRecords(f *os.File, recs ...logRecord) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, rec := range recs {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	_, err := f.Write(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// commit writes records to the log file, and applies them if the writing
+// succeeds. It must be called with the mutex locked.
+func (s *LogStore) commit(recs ...logRecord) error {
+	err := s.write(recs...)
+	if err != nil {
+		return err
+	}
+	for _, rec := range recs {
+		s.apply(rec)
+	}
+	return nil
+}
+
+// SchemaUpgrade always returns nil, since the log format has no schema to
+// upgrade.
+func (s *LogStore) SchemaUpgrade() *storedefs.SchemaUpgrade {
+	return nil
+}
+
+// Close closes the log file, and removes the lock file.
+func (s *LogStore) Close() error {
+	if s == nil || s.file == nil {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	err := s.file.Close()
+	os.Remove(s.lockPath)
+	return err
+}
+
+// NextCmdSeq returns the next sequence number of the command history.
+func (s *LogStore) NextCmdSeq() (int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.lastSeq + 1, nil
+}
+
+// AddCmd adds a new command to the command history.
+func (s *LogStore) AddCmd(text string) (int, error) {
+	return s.addCmd(text, nil)
+}
+
+// AddCmdWithMeta adds a new command to the command history, together with its
+// metadata.
+func (s *LogStore) AddCmdWithMeta(text string, meta storedefs.CmdMeta) (int, error) {
+	return s.addCmd(text, &meta)
+}
+
+func (s *LogStore) addCmd(text string, meta *storedefs.CmdMeta) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	seq := s.lastSeq + 1
+	err := s.commit(logRecord{Op: opAddCmd, Seq: seq, Text: text, Meta: meta})
+	if err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+// AddCmds adds commands with their metadata to the command history in one
+// write, in the given order. The Seq fields of the commands are ignored.
+func (s *LogStore) AddCmds(cmds []storedefs.Cmd) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	recs := make([]logRecord, len(cmds))
+	for i, cmd := range cmds {
+		meta := cmd.CmdMeta
+		recs[i] = logRecord{Op: opAddCmd, Seq: s.lastSeq + 1 + i, Text: cmd.Text, Meta: &meta}
+	}
+	return s.commit(recs...)
+}
+
+// FinishCmd records the duration and the exception summary of a command that
+// has finished.
+func (s *LogStore) FinishCmd(seq int, duration float64, exception string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.cmds.cmds[seq]; !ok {
+		return storedefs.ErrNoMatchingCmd
+	}
+	return s.commit(logRecord{Op: opFinishCmd, Seq: seq, Duration: duration, Exception: exception})
+}
+
+// RemoveCmd removes a command from command history referenced by
+// sequence. The log file is compacted afterwards, so that the text of the
+// command does not stay in it.
+func (s *LogStore) RemoveCmd(seq int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.cmds.cmds[seq]; !ok {
+		return nil
+	}
+	err := s.commit(logRecord{Op: opRemoveCmd, Seq: seq})
+	if err != nil {
+		return err
+	}
+	_, _, err = s.compact()
+	return err
+}
+
+// RemoveCmdsMatching removes all commands matching the regular expression
+// pattern from the command history, and returns their sequence numbers. Like
+// RemoveCmd, it compacts the log file afterwards.
+func (s *LogStore) RemoveCmdsMatching(pattern string) ([]int, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var (
+		seqs []int
+		recs []logRecord
+	)
+	s.eachCmd(0, func(cmd *storedefs.Cmd) bool {
+		if re.MatchString(cmd.Text) {
+			seqs = append(seqs, cmd.Seq)
+			recs = append(recs, logRecord{Op: opRemoveCmd, Seq: cmd.Seq})
+		}
+		return true
+	})
+	if len(recs) == 0 {
+		return nil, nil
+	}
+	err = s.commit(recs...)
+	if err != nil {
+		return nil, err
+	}
+	_, _, err = s.compact()
+	if err != nil {
+		return nil, err
+	}
+	return seqs, nil
+}
+
+// eachCmd calls f with each command whose sequence number is at least from, in
+// ascending order, until f returns false.
+func (s *LogStore) eachCmd(from int, f func(*storedefs.Cmd) bool) {
+	seqs := s.cmds.seqs
+	for i := sort.SearchInts(seqs, from); i < len(seqs); i++ {
+		if cmd, ok := s.cmds.cmds[seqs[i]]; ok && !f(cmd) {
+			return
+		}
+	}
+}
+
+// Cmd queries the command history item with the specified sequence number.
+func (s *LogStore) Cmd(seq int) (string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	cmd, ok := s.cmds.cmds[seq]
+	if !ok {
+		return "", storedefs.ErrNoMatchingCmd
+	}
+	return cmd.Text, nil
+}
+
+// Cmds returns the contents of all commands within the specified range.
+func (s *LogStore) Cmds(from, upto int) ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var cmds []string
+	s.eachCmd(from, func(cmd *storedefs.Cmd) bool {
+		if cmd.Seq >= upto {
+			return false
+		}
+		cmds = append(cmds, cmd.Text)
+		return true
+	})
+	return cmds, nil
+}
+
+// CmdsWithMeta returns all commands within the specified range, with their
+// metadata.
+func (s *LogStore) CmdsWithMeta(from, upto int) ([]storedefs.Cmd, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var cmds []storedefs.Cmd
+	s.eachCmd(from, func(cmd *storedefs.Cmd) bool {
+		if cmd.Seq >= upto {
+			return false
+		}
+		cmds = append(cmds, *cmd)
+		return true
+	})
+	return cmds, nil
+}
+
+// SearchCmds searches the command history.
+func (s *LogStore) SearchCmds(q storedefs.CmdQuery) ([]storedefs.Cmd, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.cmds.search(q)
+}
+
+// NextCmd finds the first command after the given sequence number (inclusive)
+// with the given prefix.
+func (s *LogStore) NextCmd(from int, prefix string) (int, string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var found *storedefs.Cmd
+	s.eachCmd(from, func(cmd *storedefs.Cmd) bool {
+		if strings.HasPrefix(cmd.Text, prefix) {
+			found = cmd
+			return false
+		}
+		return true
+	})
+	if found == nil {
+		return 0, "", storedefs.ErrNoMatchingCmd
+	}
+	return found.Seq, found.Text, nil
+}
+
+// PrevCmd finds the last command before the given sequence number (exclusive)
+// with the given prefix.
+func (s *LogStore) PrevCmd(upto int, prefix string) (int, string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	seqs := s.cmds.seqs
+	for i := sort.SearchInts(seqs, upto) - 1; i >= 0; i-- {
+		cmd, ok := s.cmds.cmds[seqs[i]]
+		if ok && strings.HasPrefix(cmd.Text, prefix) {
+			return cmd.Seq, cmd.Text, nil
+		}
+	}
+	return 0, "", storedefs.ErrNoMatchingCmd
+}
+
+// AddDir records a visit to a directory in the directory history. The weight
+// of the visit is incFactor.
+func (s *LogStore) AddDir(d string, incFactor float64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	old := s.dirs[d]
+	visits := make([]storedefs.DirVisit, len(old), len(old)+1)
+	copy(visits, old)
+	visits = append(visits, storedefs.DirVisit{now().Unix(), incFactor})
+	if len(visits) > maxDirVisits {
+		visits = visits[len(visits)-maxDirVisits:]
+	}
+	return s.commit(logRecord{Op: opSetDir, Name: d, Visits: visits})
+}
+
+// RemoveDir removes a directory record from history.
+func (s *LogStore) RemoveDir(d string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.dirs[d]; !ok {
+		return nil
+	}
+	return s.commit(logRecord{Op: opRemoveDir, Name: d})
+}
+
+// Dirs lists all directories in the directory history whose names are not
+// in the blacklist, along with their visits. The scores are calculated with
+// storedefs.DefaultDirHalfLife, and the results are ordered by scores in
+// descending order.
+func (s *LogStore) Dirs(blacklist map[string]struct{}) ([]storedefs.Dir, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	paths := make([]string, 0, len(s.dirs))
+	for d := range s.dirs {
+		if _, ok := blacklist[d]; !ok {
+			paths = append(paths, d)
+		}
+	}
+	// Sort the names first, so that directories with the same score are
+	// always listed in the same order.
+	sort.Strings(paths)
+	t := now().Unix()
+	dirs := make([]storedefs.Dir, len(paths))
+	for i, d := range paths {
+		visits := s.dirs[d]
+		dirs[i] = storedefs.Dir{
+			Path:   d,
+			Score:  storedefs.Frecency(visits, t, storedefs.DefaultDirHalfLife),
+			Visits: visits,
+		}
+	}
+	sort.Stable(sort.Reverse(dirList(dirs)))
+	return dirs, nil
+}
+
+// SharedVar gets the value of a shared variable.
+func (s *LogStore) SharedVar(n string) (string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	v, ok := s.vars[n]
+	if !ok {
+		return "", ErrNoVar
+	}
+	return v, nil
+}
+
+// SetSharedVar sets the value of a shared variable.
+func (s *LogStore) SetSharedVar(n, v string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.commit(logRecord{Op: opSetVar, Name: n, Value: v})
+}
+
+// DelSharedVar deletes a shared variable.
+func (s *LogStore) DelSharedVar(n string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.vars[n]; !ok {
+		return nil
+	}
+	return s.commit(logRecord{Op: opDelVar, Name: n})
+}
+
+// CompareAndSwapSharedVar sets a shared variable to new if its value is old,
+// and returns whether it was set. A nonexistent variable is considered to have
+// an empty value.
+func (s *LogStore) CompareAndSwapSharedVar(n, old, new string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.vars[n] != old {
+		return false, nil
+	}
+	err := s.commit(logRecord{Op: opSetVar, Name: n, Value: new})
+	return err == nil, err
+}
+
+// IncSharedVar adds delta to the numeric value of a shared variable, and
+// returns the new value. A nonexistent variable is considered to be 0.
+func (s *LogStore) IncSharedVar(n string, delta float64) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	num := 0.0
+	if v, ok := s.vars[n]; ok {
+		var err error
+		num, err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			return "", fmt.Errorf("shared variable %s is not a number: %q", n, v)
+		}
+	}
+	value := strconv.FormatFloat(num+delta, 'f', -1, 64)
+	err := s.commit(logRecord{Op: opSetVar, Name: n, Value: value})
+	if err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// DBStats returns statistics about the log file. The entries are keyed by the
+// names of the corresponding buckets of Store.
+func (s *LogStore) DBStats() (storedefs.DBStats, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	info, err := s.file.Stat()
+	if err != nil {
+		return storedefs.DBStats{}, err
+	}
+	nCmds, nMetas := 0, 0
+	s.eachCmd(0, func(cmd *storedefs.Cmd) bool {
+		nCmds++
+		if cmd.CmdMeta != (storedefs.CmdMeta{}) {
+			nMetas++
+		}
+		return true
+	})
+	return storedefs.DBStats{
+		Path:          s.path,
+		Size:          info.Size(),
+		SchemaVersion: LogFormatVersion,
+		Entries: map[string]int{
+			BucketCmd:       nCmds,
+			BucketCmdMeta:   nMetas,
+			BucketDir:       len(s.dirs),
+			BucketSharedVar: len(s.vars),
+		},
+	}, nil
+}
+
+// Compact rewrites the log file with only the records needed to reproduce the
+// current data, and returns the sizes of the log file before and after. Other
+// operations on the LogStore wait until it is done.
+func (s *LogStore) Compact() (before, after int64, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.compact()
+}
+
+// compact implements Compact. It must be called with the mutex locked.
+func (s *LogStore) compact() (before, after int64, err error) {
+	info, err := s.file.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	before = info.Size()
+
+	recs := []logRecord{
+		{Op: opVersion, Version: LogFormatVersion},
+		{Op: opSeq, Seq: s.lastSeq},
+	}
+	s.eachCmd(0, func(cmd *storedefs.Cmd) bool {
+		rec := logRecord{Op: opAddCmd, Seq: cmd.Seq, Text: cmd.Text}
+		if cmd.CmdMeta != (storedefs.CmdMeta{}) {
+			meta := cmd.CmdMeta
+			rec.Meta = &meta
+		}
+		recs = append(recs, rec)
+		return true
+	})
+	for d, visits := range s.dirs {
+		recs = append(recs, logRecord{Op: opSetDir, Name: d, Visits: visits})
+	}
+	for n, v := range s.vars {
+		recs = append(recs, logRecord{Op: opSetVar, Name: n, Value: v})
+	}
+
+	tmpPath := s.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, 0, err
+	}
+	err = writeRecords(tmp, recs...)
+	if err == nil {
+		err = os.Rename(tmpPath, s.path)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return 0, 0, err
+	}
+	s.file.Close()
+	s.file = tmp
+
+	// Rebuild the index, dropping the removed commands it still keeps.
+	cmds := newCmdIndex()
+	s.eachCmd(0, func(cmd *storedefs.Cmd) bool {
+		cmds.add(*cmd)
+		return true
+	})
+	s.cmds = cmds
+
+	info, err = s.file.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	return before, info.Size(), nil
+}
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elves/elvish/util"
+)
+
+func TestLogStoreDiscardsPartialRecord(t *testing.T) {
+	util.WithTempDir(func(dir string) {
+		path := filepath.Join(dir, "db")
+		st, err := NewLogStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		st.AddCmd("echo")
+		st.Close()
+
+		// Simulate a write that was interrupted.
+		f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		f.WriteString(`{"op":"cmd","Seq":2,"Te`)
+		f.Close()
+
+		st, err = NewLogStore(path)
+		if err != nil {
+			t.Fatalf("NewLogStore with partial record -> error %v", err)
+		}
+		defer st.Close()
+		if seq, err := st.AddCmd("ls"); seq != 2 || err != nil {
+			t.Errorf("AddCmd -> (%v, %v), want (2, nil)", seq, err)
+		}
+		if cmds, _ := st.Cmds(0, 10); len(cmds) != 2 || cmds[1] != "ls" {
+			t.Errorf("Cmds -> %v", cmds)
+		}
+	})
+}
+
+func TestLogStoreRejectsOtherFiles(t *testing.T) {
+	util.WithTempDir(func(dir string) {
+		path := filepath.Join(dir, "db")
+		ioutil.WriteFile(path, []byte("{\"op\":\"cmd\"}\n"), 0644)
+		if _, err := NewLogStore(path); err == nil {
+			t.Errorf("NewLogStore with no version record -> nil error")
+		}
+		ioutil.WriteFile(path, []byte("{\"op\":\"version\",\"Version\":100}\n"), 0644)
+		if _, err := NewLogStore(path); err == nil {
+			t.Errorf("NewLogStore with newer version -> nil error")
+		}
+	})
+}
+
+func TestLogStoreLock(t *testing.T) {
+	util.WithTempDir(func(dir string) {
+		path := filepath.Join(dir, "db")
+		st, err := NewLogStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewLogStore(path); err == nil {
+			t.Errorf("NewLogStore while the log file is in use -> nil error")
+		}
+		st.Close()
+		st, err = NewLogStore(path)
+		if err != nil {
+			t.Fatalf("NewLogStore after closing -> error %v", err)
+		}
+		st.Close()
+
+		// Owners on other hosts cannot be checked.
+		ioutil.WriteFile(path+".lock", []byte("elvish-test-other-host:1"), 0644)
+		if _, err := NewLogStore(path); err == nil {
+			t.Errorf("NewLogStore with lock file of another host -> nil error")
+		}
+	})
+}
+
+func TestLogStoreRemoveCmdCompacts(t *testing.T) {
+	util.WithTempDir(func(dir string) {
+		path := filepath.Join(dir, "db")
+		st, err := NewLogStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer st.Close()
+		seq, _ := st.AddCmd("secret 1")
+		st.AddCmd("secret 2")
+		st.AddCmd("echo")
+
+		st.RemoveCmd(seq)
+		st.RemoveCmdsMatching("^secret")
+		content, _ := ioutil.ReadFile(path)
+		if strings.Contains(string(content), "secret") {
+			t.Errorf("log file still has removed commands: %s", content)
+		}
+		if cmds, _ := st.Cmds(0, 10); len(cmds) != 1 || cmds[0] != "echo" {
+			t.Errorf("after removing, Cmds -> %v", cmds)
+		}
+	})
+}
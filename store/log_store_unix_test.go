@@ -0,0 +1,38 @@
+// +build !windows,!plan9
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/elves/elvish/util"
+)
+
+func TestLogStoreTakesOverStaleLock(t *testing.T) {
+	// Find the pid of a process that has exited.
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skip("cannot run true:", err)
+	}
+	pid := cmd.Process.Pid
+
+	util.WithTempDir(func(dir string) {
+		path := filepath.Join(dir, "db")
+		hostname, _ := os.Hostname()
+		ioutil.WriteFile(path+".lock", []byte(hostname+":"+strconv.Itoa(pid)), 0644)
+		st, err := NewLogStore(path)
+		if err != nil {
+			t.Fatalf("NewLogStore with stale lock file -> error %v", err)
+		}
+		defer st.Close()
+		owner, _ := ioutil.ReadFile(path + ".lock")
+		if want := hostname + ":" + strconv.Itoa(os.Getpid()); string(owner) != want {
+			t.Errorf("owner of lock file is %q, want %q", owner, want)
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/boltdb/bolt"
+	"github.com/elves/elvish/store/storedefs"
+)
+
+// migration is a step of upgrading the database schema to a version.
+type migration struct {
+	version int
+	name    string
+	migrate func(*bolt.Tx) error
+}
+
+var migrations []migration
+
+// addMigration registers a migration step to the given schema version. It
+// should be called from init functions.
+//
+// All the steps to the same version run in one transaction, in the order they
+// are registered, and should not depend on each other. Steps should also be
+// idempotent, since databases written by older versions may have been partially
+// migrated.
+func addMigration(version int, name string, f func(*bolt.Tx) error) {
+	if version > SchemaVersion {
+		panic(fmt.Sprintf("migration %q to version %d is newer than SchemaVersion", name, version))
+	}
+	migrations = append(migrations, migration{version, name, f})
+}
+
+// migrate upgrades the database to SchemaVersion step by step, each version in
+// a transaction. Databases that are not empty are backed up into a file next to
+// them first. It returns a description of the upgrade, which is nil when the
+// database is already up to date.
+func migrate(db *bolt.DB) (*storedefs.SchemaUpgrade, error) {
+	var from int
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		from, err = schemaVersion(tx)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %v", err)
+	}
+	if from > SchemaVersion {
+		return nil, ErrSchemaTooNew
+	}
+	if from == SchemaVersion {
+		return nil, nil
+	}
+
+	upgrade := &storedefs.SchemaUpgrade{From: from, To: from}
+	if from > 0 {
+		backup := fmt.Sprintf("%s.v%d.bak", db.Path(), from)
+		logger.Printf("backing up database to %s", backup)
+		err := db.View(func(tx *bolt.Tx) error {
+			return tx.CopyFile(backup, 0600)
+		})
+		if err != nil {
+			return upgrade, fmt.Errorf("failed to back up database: %v", err)
+		}
+		upgrade.Backup = backup
+	}
+
+	steps := make([]migration, len(migrations))
+	copy(steps, migrations)
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].version < steps[j].version
+	})
+	for version := from + 1; version <= SchemaVersion; version++ {
+		var names []string
+		err := db.Update(func(tx *bolt.Tx) error {
+			for _, step := range steps {
+				if step.version != version {
+					continue
+				}
+				logger.Printf("migrating to schema version %d: %s", version, step.name)
+				err := step.migrate(tx)
+				if err != nil {
+					return fmt.Errorf("failed to %s: %v", step.name, err)
+				}
+				names = append(names, step.name)
+			}
+			return setSchemaVersion(tx, version)
+		})
+		if err != nil {
+			return upgrade, fmt.Errorf("failed to migrate to schema version %d: %v", version, err)
+		}
+		upgrade.To = version
+		upgrade.Steps = append(upgrade.Steps, names...)
+	}
+	return upgrade, nil
+}
@@ -0,0 +1,118 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/elves/elvish/store/storedefs"
+	"github.com/elves/elvish/util"
+)
+
+func TestMigrateLegacyDB(t *testing.T) {
+	util.WithTempDir(func(dir string) {
+		dbPath := filepath.Join(dir, "db")
+		db, err := DefaultDB(dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// A database written by older versions, which recorded the schema
+		// version under the wrong key and stored only scores of directories.
+		err = db.Update(func(tx *bolt.Tx) error {
+			for _, name := range []string{BucketCmd, BucketSharedVar} {
+				if _, err := tx.CreateBucket([]byte(name)); err != nil {
+					return err
+				}
+			}
+			b, _ := tx.CreateBucket([]byte(BucketSchema))
+			b.Put([]byte("schema"), []byte("1"))
+			b, _ = tx.CreateBucket([]byte(BucketDir))
+			return b.Put([]byte("/tmp"), []byte("20"))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		st, err := NewStoreDB(db)
+		if err != nil {
+			t.Fatalf("NewStoreDB -> error %v", err)
+		}
+		upgrade := st.SchemaUpgrade()
+		wantSteps := []string{"convert directory scores to visits", "create command metadata table"}
+		if upgrade == nil || upgrade.From != 1 || upgrade.To != SchemaVersion ||
+			!reflect.DeepEqual(upgrade.Steps, wantSteps) {
+			t.Errorf("SchemaUpgrade -> %v", upgrade)
+		}
+		if _, err := os.Stat(dbPath + ".v1.bak"); err != nil {
+			t.Errorf("backup not found: %v", err)
+		}
+		if !SchemaUpToDate(db) {
+			t.Errorf("schema not up to date after migration")
+		}
+		dirs, err := st.Dirs(nil)
+		if err != nil || len(dirs) != 1 || len(dirs[0].Visits) != 1 || dirs[0].Visits[0].Weight != 2 {
+			t.Errorf("Dirs -> (%v, %v), want one converted directory", dirs, err)
+		}
+
+		// Migrating again does nothing.
+		st, err = NewStoreDB(db)
+		if err != nil || st.SchemaUpgrade() != nil {
+			t.Errorf("NewStoreDB again -> upgrade %v, error %v", st.SchemaUpgrade(), err)
+		}
+		db.Close()
+	})
+}
+
+func TestMigrateDBWithCmdMeta(t *testing.T) {
+	util.WithTempDir(func(dir string) {
+		db, err := DefaultDB(filepath.Join(dir, "db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		// Some older versions already stored metadata of commands, but still
+		// recorded the schema version under the old key as 1.
+		err = db.Update(func(tx *bolt.Tx) error {
+			for _, name := range []string{BucketCmd, BucketCmdMeta, BucketDir, BucketSharedVar} {
+				if _, err := tx.CreateBucket([]byte(name)); err != nil {
+					return err
+				}
+			}
+			b, _ := tx.CreateBucket([]byte(BucketSchema))
+			return b.Put([]byte("schema"), []byte("1"))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		st, err := NewStoreDB(db)
+		if err != nil {
+			t.Fatalf("NewStoreDB -> error %v", err)
+		}
+		meta := storedefs.CmdMeta{Dir: "/tmp", Session: "s"}
+		seq, _ := st.AddCmdWithMeta("echo", meta)
+		if cmds, _ := st.CmdsWithMeta(seq, seq+1); len(cmds) != 1 || cmds[0].CmdMeta != meta {
+			t.Errorf("CmdsWithMeta after migration -> %v", cmds)
+		}
+		if !SchemaUpToDate(db) {
+			t.Errorf("schema not up to date after migration")
+		}
+	})
+}
+
+func TestMigrateNewerDB(t *testing.T) {
+	util.WithTempDir(func(dir string) {
+		db, err := DefaultDB(filepath.Join(dir, "db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		db.Update(func(tx *bolt.Tx) error {
+			return setSchemaVersion(tx, SchemaVersion+1)
+		})
+		if _, err := NewStoreDB(db); err != ErrSchemaTooNew {
+			t.Errorf("NewStoreDB -> error %v, want %v", err, ErrSchemaTooNew)
+		}
+	})
+}
@@ -0,0 +1,11 @@
+// +build !windows,!plan9
+
+package store
+
+import "syscall"
+
+// processExists returns whether there is a process with the given pid.
+func processExists(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,13 @@
+package store
+
+import "os"
+
+// processExists returns whether there is a process with the given pid.
+func processExists(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
@@ -1,47 +1,59 @@
 package store
 
 import (
+	"errors"
 	"strconv"
 
 	"github.com/boltdb/bolt"
 )
 
 // SchemaVersion is the current schema version. It should be bumped every time a
-// backwards-incompatible change has been made to the schema.
-const SchemaVersion = 1
+// change has been made to the schema, together with a migration to the new
+// version; see addMigration.
+const SchemaVersion = 3
 
 const BucketSchema = "schema"
 
-func init() {
-	initDB["record schema version"] = func(db *bolt.DB) error {
-		return db.Update(func(tx *bolt.Tx) error {
-			b, err := tx.CreateBucketIfNotExists([]byte(BucketSchema))
-			if err != nil {
-				return err
-			}
-			return b.Put([]byte("schema"), []byte(strconv.FormatUint(uint64(SchemaVersion), 10)))
-		})
-	}
-}
+// ErrSchemaTooNew is returned when the database has a schema newer than
+// SchemaVersion, which happens when it has been used by a newer Elvish.
+var ErrSchemaTooNew = errors.New("database schema is newer than supported")
 
 // SchemaUpToDate returns whether the database has the current or newer version
 // of the schema.
 func SchemaUpToDate(db *bolt.DB) bool {
-	var version uint64
+	var version int
 	err := db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(BucketSchema))
-		if b == nil {
-			return ErrInvalidBucket
-		}
-		if v := b.Get([]byte("version")); v != nil {
-			version, _ = strconv.ParseUint(string(v), 0, 0)
-		}
-		return nil
+		var err error
+		version, err = schemaVersion(tx)
+		return err
 	})
+	return err == nil && version >= SchemaVersion
+}
 
-	if err != nil {
-		return false
+// schemaVersion returns the schema version of the database, 0 if it has not
+// been initialized.
+func schemaVersion(tx *bolt.Tx) (int, error) {
+	b := tx.Bucket([]byte(BucketSchema))
+	if b == nil {
+		return 0, nil
 	}
+	v := b.Get([]byte("version"))
+	if v == nil {
+		if b.Get([]byte("schema")) != nil {
+			// Older versions recorded the schema version under this key, and
+			// never recorded anything but 1.
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return strconv.Atoi(string(v))
+}
 
-	return version == SchemaVersion
+func setSchemaVersion(tx *bolt.Tx, version int) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(BucketSchema))
+	if err != nil {
+		return err
+	}
+	b.Delete([]byte("schema"))
+	return b.Put([]byte("version"), []byte(strconv.Itoa(version)))
 }
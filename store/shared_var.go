@@ -2,6 +2,8 @@ package store
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
 
 	"github.com/boltdb/bolt"
 )
@@ -12,18 +14,16 @@ var ErrNoVar = errors.New("no such variable")
 const BucketSharedVar = "shared_var"
 
 func init() {
-	initDB["initialize shared variable table"] = func(db *bolt.DB) error {
-		return db.Update(func(tx *bolt.Tx) error {
-			_, err := tx.CreateBucketIfNotExists([]byte(BucketSharedVar))
-			return err
-		})
-	}
+	addMigration(1, "create shared variable table", func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(BucketSharedVar))
+		return err
+	})
 }
 
 // SharedVar gets the value of a shared variable.
 func (s *Store) SharedVar(n string) (string, error) {
 	var value string
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err := s.view(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketSharedVar))
 		if v := b.Get([]byte(n)); v == nil {
 			return ErrNoVar
@@ -37,7 +37,7 @@ func (s *Store) SharedVar(n string) (string, error) {
 
 // SetSharedVar sets the value of a shared variable.
 func (s *Store) SetSharedVar(n, v string) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketSharedVar))
 		return b.Put([]byte(n), []byte(v))
 	})
@@ -45,8 +45,44 @@ func (s *Store) SetSharedVar(n, v string) error {
 
 // DelSharedVar deletes a shared variable.
 func (s *Store) DelSharedVar(n string) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketSharedVar))
 		return b.Delete([]byte(n))
 	})
 }
+
+// CompareAndSwapSharedVar sets a shared variable to new if its value is old,
+// and returns whether it was set. A nonexistent variable is considered to have
+// an empty value.
+func (s *Store) CompareAndSwapSharedVar(n, old, new string) (bool, error) {
+	swapped := false
+	err := s.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketSharedVar))
+		if string(b.Get([]byte(n))) != old {
+			return nil
+		}
+		swapped = true
+		return b.Put([]byte(n), []byte(new))
+	})
+	return swapped && err == nil, err
+}
+
+// IncSharedVar adds delta to the numeric value of a shared variable, and
+// returns the new value. A nonexistent variable is considered to be 0.
+func (s *Store) IncSharedVar(n string, delta float64) (string, error) {
+	var value string
+	err := s.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketSharedVar))
+		num := 0.0
+		if v := b.Get([]byte(n)); v != nil {
+			var err error
+			num, err = strconv.ParseFloat(string(v), 64)
+			if err != nil {
+				return fmt.Errorf("shared variable %s is not a number: %q", n, v)
+			}
+		}
+		value = strconv.FormatFloat(num+delta, 'f', -1, 64)
+		return b.Put([]byte(n), []byte(value))
+	})
+	return value, err
+}
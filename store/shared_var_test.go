@@ -3,43 +3,80 @@ package store
 import "testing"
 
 func TestSharedVar(t *testing.T) {
+	testBackends(t, testSharedVar)
+}
+
+func testSharedVar(t *testing.T, st Backend) {
 	varname := "foo"
 	value1 := "lorem ipsum"
 	value2 := "o mores, o tempora"
 
 	// Getting an nonexistent variable should return ErrNoVar.
-	_, err := tStore.SharedVar(varname)
+	_, err := st.SharedVar(varname)
 	if err != ErrNoVar {
 		t.Error("want ErrNoVar, got", err)
 	}
 
 	// Setting a variable for the first time creates it.
-	err = tStore.SetSharedVar(varname, value1)
+	err = st.SetSharedVar(varname, value1)
 	if err != nil {
 		t.Error("want no error, got", err)
 	}
-	v, err := tStore.SharedVar(varname)
+	v, err := st.SharedVar(varname)
 	if v != value1 || err != nil {
 		t.Errorf("want %q and no error, got %q and %v", value1, v, err)
 	}
 
 	// Setting an existing variable updates its value.
-	err = tStore.SetSharedVar(varname, value2)
+	err = st.SetSharedVar(varname, value2)
 	if err != nil {
 		t.Error("want no error, got", err)
 	}
-	v, err = tStore.SharedVar(varname)
+	v, err = st.SharedVar(varname)
 	if v != value2 || err != nil {
 		t.Errorf("want %q and no error, got %q and %v", value2, v, err)
 	}
 
 	// After deleting a variable, access to it cause ErrNoVar.
-	err = tStore.DelSharedVar(varname)
+	err = st.DelSharedVar(varname)
 	if err != nil {
 		t.Error("want no error, got", err)
 	}
-	_, err = tStore.SharedVar(varname)
+	_, err = st.SharedVar(varname)
 	if err != ErrNoVar {
 		t.Error("want ErrNoVar, got", err)
 	}
 }
+
+func TestCompareAndSwapAndIncSharedVar(t *testing.T) {
+	testBackends(t, testCompareAndSwapAndIncSharedVar)
+}
+
+func testCompareAndSwapAndIncSharedVar(t *testing.T, st Backend) {
+	// A nonexistent variable is considered to be empty.
+	swapped, err := st.CompareAndSwapSharedVar("lock", "", "a")
+	if !swapped || err != nil {
+		t.Errorf("CAS of nonexistent variable -> (%v, %v), want (true, nil)", swapped, err)
+	}
+	swapped, err = st.CompareAndSwapSharedVar("lock", "", "b")
+	if swapped || err != nil {
+		t.Errorf("CAS with wrong old value -> (%v, %v), want (false, nil)", swapped, err)
+	}
+	if v, _ := st.SharedVar("lock"); v != "a" {
+		t.Errorf("after CAS, value is %q, want %q", v, "a")
+	}
+
+	// A nonexistent variable is considered to be 0.
+	for _, test := range []struct {
+		delta float64
+		want  string
+	}{{1, "1"}, {2.5, "3.5"}} {
+		v, err := st.IncSharedVar("counter", test.delta)
+		if v != test.want || err != nil {
+			t.Errorf("IncSharedVar -> (%q, %v), want (%q, nil)", v, err, test.want)
+		}
+	}
+	if _, err := st.IncSharedVar("lock", 1); err == nil {
+		t.Errorf("IncSharedVar of non-number -> nil error")
+	}
+}
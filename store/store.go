@@ -3,7 +3,6 @@ package store
 
 import (
 	"errors"
-	"fmt"
 	"sync"
 	"time"
 
@@ -14,7 +13,6 @@ import (
 )
 
 var logger = util.GetLogger("[store] ")
-var initDB = map[string](func(*bolt.DB) error){}
 
 var ErrInvalidBucket = errors.New("invalid bucket")
 
@@ -26,8 +24,15 @@ var ErrInvalidBucket = errors.New("invalid bucket")
 // call Waits.Done() in the spawned goroutine after the operation is finished.
 type Store struct {
 	db *bolt.DB
+	// Protects db from being replaced by Compact while it is in use.
+	dbMutex sync.RWMutex
 	// Waits is used for registering outstanding operations on the store.
 	waits sync.WaitGroup
+	// The schema upgrade done when opening the database, if any.
+	upgrade *storedefs.SchemaUpgrade
+	// The index for searching the command history, built on demand.
+	index      *cmdIndex
+	indexMutex sync.Mutex
 }
 
 var _ storedefs.Store = (*Store)(nil)
@@ -51,7 +56,7 @@ func NewStore(dbname string) (*Store, error) {
 }
 
 // NewStoreDB creates a new Store with a custom database. The database must be
-// a Bolt database.
+// a Bolt database. Its schema is upgraded to SchemaVersion if it is older.
 func NewStoreDB(db *bolt.DB) (*Store, error) {
 	logger.Println("initializing store")
 	defer logger.Println("initialized store")
@@ -60,20 +65,24 @@ func NewStoreDB(db *bolt.DB) (*Store, error) {
 		waits: sync.WaitGroup{},
 	}
 
-	if SchemaUpToDate(db) {
+	upgrade, err := migrate(db)
+	if err != nil {
+		return nil, err
+	}
+	if upgrade == nil {
 		logger.Println("DB schema up to date")
-	} else {
-		for name, fn := range initDB {
-			err := fn(db)
-			if err != nil {
-				return nil, fmt.Errorf("failed to %s: %v", name, err)
-			}
-		}
 	}
+	st.upgrade = upgrade
 
 	return st, nil
 }
 
+// SchemaUpgrade returns the schema upgrade done when the Store was created, or
+// nil if the schema was up to date.
+func (s *Store) SchemaUpgrade() *storedefs.SchemaUpgrade {
+	return s.upgrade
+}
+
 // Waits returns a WaitGroup used to register outstanding storage requests when
 // making calls asynchronously.
 func (s *Store) Waits() *sync.WaitGroup {
@@ -87,5 +96,21 @@ func (s *Store) Close() error {
 		return nil
 	}
 	s.waits.Wait()
+	s.dbMutex.Lock()
+	defer s.dbMutex.Unlock()
 	return s.db.Close()
 }
+
+// view runs a read-only transaction on the database.
+func (s *Store) view(f func(*bolt.Tx) error) error {
+	s.dbMutex.RLock()
+	defer s.dbMutex.RUnlock()
+	return s.db.View(f)
+}
+
+// update runs a read-write transaction on the database.
+func (s *Store) update(f func(*bolt.Tx) error) error {
+	s.dbMutex.RLock()
+	defer s.dbMutex.RUnlock()
+	return s.db.Update(f)
+}
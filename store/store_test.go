@@ -1,28 +1,103 @@
 package store
 
-// This file also sets up the test fixture.
+// This file also sets up the test fixture. Most tests are conformance tests
+// that are run against every storage backend with testBackends.
 
 import (
-	"fmt"
-	"io/ioutil"
-	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elves/elvish/util"
 )
 
-var tStore *Store
+// backends are all the storage backends, each with the database URL for a
+// database in a directory.
+var backends = []struct {
+	name  string
+	dbURL func(dir string) string
+}{
+	{"bolt", func(dir string) string { return filepath.Join(dir, "db") }},
+	{"log", func(dir string) string { return "log://" + filepath.Join(dir, "db") }},
+}
 
-func init() {
-	f, err := ioutil.TempFile("", "elvish.test")
-	if err != nil {
-		panic(fmt.Sprintf("Failed to open temp file: %v", err))
+// testBackends runs f as a subtest for each storage backend, with a new
+// database.
+func testBackends(t *testing.T, f func(*testing.T, Backend)) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			util.WithTempDir(func(dir string) {
+				st, err := Open(b.dbURL(dir))
+				if err != nil {
+					t.Fatalf("Open -> error %v", err)
+				}
+				defer st.Close()
+				f(t, st)
+			})
+		})
 	}
-	db, err := DefaultDB(f.Name())
-	if err != nil {
-		panic(fmt.Sprintf("Failed to create Store instance: %v", err))
+}
+
+func TestPersistence(t *testing.T) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			util.WithTempDir(func(dir string) {
+				st, err := Open(b.dbURL(dir))
+				if err != nil {
+					t.Fatalf("Open -> error %v", err)
+				}
+				seq, _ := st.AddCmd("echo")
+				st.FinishCmd(seq, 1, "")
+				st.AddCmd("removed")
+				st.RemoveCmd(seq + 1)
+				st.AddDir("/tmp", 1)
+				st.SetSharedVar("x", "y")
+				st.Close()
+
+				st, err = Open(b.dbURL(dir))
+				if err != nil {
+					t.Fatalf("Open again -> error %v", err)
+				}
+				defer st.Close()
+				if cmds, _ := st.CmdsWithMeta(0, 10); len(cmds) != 1 || cmds[0].Text != "echo" || !cmds[0].Succeeded() {
+					t.Errorf("after reopening, CmdsWithMeta -> %v", cmds)
+				}
+				if next, _ := st.NextCmdSeq(); next != seq+2 {
+					t.Errorf("after reopening, NextCmdSeq -> %d, want %d", next, seq+2)
+				}
+				if dirs, _ := st.Dirs(nil); len(dirs) != 1 || dirs[0].Path != "/tmp" {
+					t.Errorf("after reopening, Dirs -> %v", dirs)
+				}
+				if v, _ := st.SharedVar("x"); v != "y" {
+					t.Errorf("after reopening, shared variable x = %q, want y", v)
+				}
+			})
+		})
 	}
-	os.Remove(f.Name())
+}
+
+var splitDBURLTests = []struct {
+	dbURL, scheme, path string
+}{
+	{"/home/me/.elvish/db", "", "/home/me/.elvish/db"},
+	{"log:///home/me/.elvish/db", "log", "/home/me/.elvish/db"},
+	{"bolt://db", "bolt", "db"},
+	{`C:\Users\me\db`, "", `C:\Users\me\db`},
+	{"dir/a://b", "", "dir/a://b"},
+}
+
+func TestSplitDBURL(t *testing.T) {
+	for _, test := range splitDBURLTests {
+		scheme, path := SplitDBURL(test.dbURL)
+		if scheme != test.scheme || path != test.path {
+			t.Errorf("SplitDBURL(%q) -> (%q, %q), want (%q, %q)",
+				test.dbURL, scheme, path, test.scheme, test.path)
+		}
+	}
+}
 
-	tStore, err = NewStoreDB(db)
-	if err != nil {
-		panic(fmt.Sprintf("Failed to create Store instance: %v", err))
+func TestOpenUnknownScheme(t *testing.T) {
+	st, err := Open("sqlite:///tmp/db")
+	if st != nil || err == nil {
+		t.Errorf("Open with unknown scheme -> (%v, %v), want (nil, error)", st, err)
 	}
 }
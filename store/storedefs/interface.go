@@ -4,15 +4,28 @@ package storedefs
 type Store interface {
 	NextCmdSeq() (int, error)
 	AddCmd(text string) (int, error)
+	AddCmdWithMeta(text string, meta CmdMeta) (int, error)
+	AddCmds(cmds []Cmd) error
+	FinishCmd(seq int, duration float64, exception string) error
+	RemoveCmd(seq int) error
+	RemoveCmdsMatching(pattern string) ([]int, error)
 	Cmd(seq int) (string, error)
 	Cmds(from, upto int) ([]string, error)
+	CmdsWithMeta(from, upto int) ([]Cmd, error)
+	SearchCmds(q CmdQuery) ([]Cmd, error)
 	NextCmd(from int, prefix string) (int, string, error)
 	PrevCmd(upto int, prefix string) (int, string, error)
 
 	AddDir(dir string, incFactor float64) error
+	RemoveDir(dir string) error
 	Dirs(blacklist map[string]struct{}) ([]Dir, error)
 
 	SharedVar(name string) (string, error)
 	SetSharedVar(name, value string) error
 	DelSharedVar(name string) error
+	CompareAndSwapSharedVar(name, old, new string) (bool, error)
+	IncSharedVar(name string, delta float64) (string, error)
+
+	DBStats() (DBStats, error)
+	Compact() (before, after int64, err error)
 }
@@ -0,0 +1,124 @@
+package storedefs
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Modes of matching in CmdQuery.
+const (
+	SearchSubstring = "substring"
+	SearchRegex     = "regex"
+	SearchFuzzy     = "fuzzy"
+)
+
+var errUnknownSearchMode = errors.New("unknown search mode")
+
+// CmdQuery is a query for searching the command history.
+type CmdQuery struct {
+	// The pattern and how it is matched against commands. In SearchFuzzy
+	// mode, the runes of the pattern should appear in the command in order.
+	// The empty pattern matches all commands in all modes.
+	Pattern    string
+	Mode       string
+	IgnoreCase bool
+	// Only keep the newest one among commands with the same text.
+	Dedup bool
+	// Filters on metadata. If Dir is not empty, only commands run in it are
+	// kept.
+	Dir           string
+	SucceededOnly bool
+	// Results are ordered from the newest to the oldest. If Before is
+	// positive, only commands with sequence numbers smaller than it are
+	// searched, which can be used for getting the next page of results;
+	// deduplication across pages is then up to the caller. If Limit is
+	// positive, at most that many commands are returned.
+	Before int
+	Limit  int
+}
+
+// TextMatcher returns a function that matches the text of commands against the
+// pattern of the query.
+func (q CmdQuery) TextMatcher() (func(string) bool, error) {
+	if q.Pattern == "" {
+		return func(string) bool { return true }, nil
+	}
+	switch q.Mode {
+	case SearchSubstring, "":
+		if q.IgnoreCase {
+			p := strings.ToLower(q.Pattern)
+			return func(s string) bool {
+				return strings.Contains(strings.ToLower(s), p)
+			}, nil
+		}
+		return func(s string) bool { return strings.Contains(s, q.Pattern) }, nil
+	case SearchRegex:
+		pattern := q.Pattern
+		if q.IgnoreCase {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	case SearchFuzzy:
+		p := []rune(q.Pattern)
+		return func(s string) bool { return fuzzyContains(s, p, q.IgnoreCase) }, nil
+	}
+	return nil, errUnknownSearchMode
+}
+
+// fuzzyContains returns whether the runes of p appear in s in order.
+func fuzzyContains(s string, p []rune, ignoreCase bool) bool {
+	j := 0
+	for _, r := range s {
+		if j == len(p) {
+			break
+		}
+		if r == p[j] || (ignoreCase && unicode.ToLower(r) == unicode.ToLower(p[j])) {
+			j++
+		}
+	}
+	return j == len(p)
+}
+
+// Search searches n commands for those satisfying the query, calling cmd to get
+// the i-th command, which are ordered from the oldest to the newest. The cmd
+// function may return nil for commands that should be skipped.
+func (q CmdQuery) Search(n int, cmd func(i int) *Cmd) ([]Cmd, error) {
+	match, err := q.TextMatcher()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		results []Cmd
+		seen    map[string]bool
+	)
+	if q.Dedup {
+		seen = make(map[string]bool)
+	}
+	for i := n - 1; i >= 0; i-- {
+		c := cmd(i)
+		if c == nil ||
+			(q.Before > 0 && c.Seq >= q.Before) ||
+			(q.Dir != "" && c.Dir != q.Dir) ||
+			(q.SucceededOnly && !c.Succeeded()) ||
+			!match(c.Text) {
+			continue
+		}
+		if q.Dedup {
+			if seen[c.Text] {
+				continue
+			}
+			seen[c.Text] = true
+		}
+		results = append(results, *c)
+		if q.Limit > 0 && len(results) == q.Limit {
+			break
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,55 @@
+package storedefs
+
+import (
+	"reflect"
+	"testing"
+)
+
+var searchTests = []struct {
+	q    CmdQuery
+	want []int
+}{
+	{CmdQuery{}, []int{5, 4, 3, 2, 1}},
+	{CmdQuery{Pattern: "ls"}, []int{5, 3, 1}},
+	{CmdQuery{Pattern: "LS", IgnoreCase: true}, []int{5, 4, 3, 1}},
+	{CmdQuery{Pattern: "^ls$", Mode: SearchRegex}, []int{3, 1}},
+	{CmdQuery{Pattern: "gs", Mode: SearchFuzzy}, []int{2}},
+	{CmdQuery{Pattern: "ls", Dedup: true}, []int{5, 3}},
+	{CmdQuery{Dir: "/a"}, []int{3, 2}},
+	{CmdQuery{SucceededOnly: true}, []int{3}},
+	{CmdQuery{Limit: 2}, []int{5, 4}},
+	{CmdQuery{Before: 3}, []int{2, 1}},
+	// Commands after Before are not considered when deduplicating.
+	{CmdQuery{Pattern: "ls", Dedup: true, Before: 4}, []int{3}},
+}
+
+var searchCmds = []Cmd{
+	{Seq: 1, Text: "ls"},
+	{Seq: 2, Text: "git status", CmdMeta: CmdMeta{Dir: "/a", Finished: true, Exception: "git exited with 128"}},
+	{Seq: 3, Text: "ls", CmdMeta: CmdMeta{Dir: "/a", Finished: true}},
+	{Seq: 4, Text: "LS"},
+	{Seq: 5, Text: "ls -l"},
+}
+
+func TestSearch(t *testing.T) {
+	for _, test := range searchTests {
+		cmds, err := test.q.Search(len(searchCmds), func(i int) *Cmd {
+			return &searchCmds[i]
+		})
+		var seqs []int
+		for _, cmd := range cmds {
+			seqs = append(seqs, cmd.Seq)
+		}
+		if !reflect.DeepEqual(seqs, test.want) || err != nil {
+			t.Errorf("%v.Search -> (%v, %v), want (%v, nil)", test.q, seqs, err, test.want)
+		}
+	}
+}
+
+func TestSearchBadQuery(t *testing.T) {
+	for _, q := range []CmdQuery{{Pattern: "(", Mode: SearchRegex}, {Pattern: "x", Mode: "bad"}} {
+		if _, err := q.Search(0, nil); err == nil {
+			t.Errorf("%v.Search -> nil error", q)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 // Package storedefs contains definitions used by the store package.
 package storedefs
 
-import "errors"
+import (
+	"errors"
+	"math"
+)
 
 // NoBlacklist is an empty blacklist, to be used in GetDirs.
 var NoBlacklist = map[string]struct{}{}
@@ -10,8 +13,95 @@ var NoBlacklist = map[string]struct{}{}
 // completes with no result.
 var ErrNoMatchingCmd = errors.New("no matching command line")
 
+// SchemaUpgrade describes an upgrade of the database schema.
+type SchemaUpgrade struct {
+	// The versions before and after the upgrade. When the upgrade failed
+	// midway, To is the last version successfully upgraded to.
+	From, To int
+	// Names of the migration steps done.
+	Steps []string
+	// Path of the backup of the database before the upgrade, empty if there
+	// was nothing to back up.
+	Backup string
+}
+
+// DBStats contains statistics about the database.
+type DBStats struct {
+	Path string
+	// Size of the database file in bytes.
+	Size          int64
+	SchemaVersion int
+	// Number of entries in each bucket, keyed by the name of the bucket.
+	Entries map[string]int
+}
+
+// Cmd is an entry in the command history, with its metadata.
+type Cmd struct {
+	Seq  int
+	Text string
+	CmdMeta
+}
+
+// CmdMeta is the metadata of an entry in the command history. Entries added
+// without metadata have the zero value.
+type CmdMeta struct {
+	// Working directory when the command was run.
+	Dir string
+	// Start time, in nanoseconds since the Unix epoch.
+	Start int64
+	// Whether the command has finished, in which case Duration and Exception
+	// are known.
+	Finished bool
+	// Duration, in seconds.
+	Duration float64
+	// Summary of the exception thrown by the command, empty if it succeeded.
+	Exception string
+	// Host name of the machine and ID of the session that ran the command.
+	Host    string
+	Session string
+}
+
+// Succeeded returns whether the command is known to have succeeded.
+func (m CmdMeta) Succeeded() bool {
+	return m.Finished && m.Exception == ""
+}
+
 // Dir is an entry in the directory history.
 type Dir struct {
 	Path  string
 	Score float64
+	// Recent visits to the directory, from which Score is derived, oldest
+	// first.
+	Visits []DirVisit
+}
+
+// DirVisit is a visit to a directory.
+type DirVisit struct {
+	// Time of the visit, in seconds since the Unix epoch.
+	Time int64
+	// Weight of the visit; it is 1 for a normal visit.
+	Weight float64
+}
+
+// DefaultDirHalfLife is the default half-life of directory visits, in
+// seconds.
+const DefaultDirHalfLife = 7 * 24 * 60 * 60
+
+// DirScoreIncrement is the score that a visit with weight 1 contributes when it
+// has just happened.
+const DirScoreIncrement = 10
+
+// Frecency calculates the score of a directory from its visits at the given
+// time. The contribution of each visit decays exponentially with time, halving
+// every halfLife seconds.
+func Frecency(visits []DirVisit, now int64, halfLife float64) float64 {
+	score := 0.0
+	for _, visit := range visits {
+		age := float64(now - visit.Time)
+		if age < 0 {
+			age = 0
+		}
+		score += DirScoreIncrement * visit.Weight * math.Pow(0.5, age/halfLife)
+	}
+	return score
 }
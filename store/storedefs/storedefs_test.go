@@ -5,3 +5,15 @@ import "testing"
 func TestStoreDefs(t *testing.T) {
 	// TODO(xiaq): Add tests
 }
+
+func TestFrecency(t *testing.T) {
+	visits := []DirVisit{{Time: 0, Weight: 1}, {Time: 100, Weight: 2}}
+	// The first visit is one half-life old, the second is new.
+	want := DirScoreIncrement*0.5 + DirScoreIncrement*2
+	if got := Frecency(visits, 100, 100); got != want {
+		t.Errorf("Frecency -> %v, want %v", got, want)
+	}
+	if got := Frecency(nil, 100, 100); got != 0 {
+		t.Errorf("Frecency of no visits -> %v, want 0", got)
+	}
+}